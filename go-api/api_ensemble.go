@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ---------------- Ensemble / consensus ---------------- */
+
+// Model name consensus slips (and bets tracked from them) are attributed to.
+const consensusModel = "Consensus"
+
+// registeredModels are the personas promptForModel knows, used when an
+// ensemble request doesn't name its members.
+var registeredModels = []string{"narrative", "weird", "random", "contrarian", "micro", "pessimist", "heat-check"}
+
+type ensembleOptions struct {
+	Models   []string `json:"models,omitempty"`   // members; empty = registeredModels
+	MinAgree int      `json:"minAgree,omitempty"` // K: legs need this many models; 0 = simple majority
+}
+
+type legAgreement struct {
+	Count  int      `json:"count"`  // models that picked this leg
+	Of     int      `json:"of"`     // models that returned a slip
+	Models []string `json:"models"` // who agreed
+}
+
+type ensembleMember struct {
+	Model string   `json:"model"`
+	Slip  *betSlip `json:"slip,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+// generateConsensusSlip runs every ensemble member in parallel on the same
+// slate, clusters overlapping picks, and keeps legs at least K members agree on.
+// All members use one prompt version, which the consensus slip is credited to.
+func generateConsensusSlip(ctx context.Context, userKey string, f GenerateFilters) (betSlip, int, error) {
+	models := registeredModels
+	if len(f.Ensemble.Models) > 0 {
+		models = dedupeModels(f.Ensemble.Models)
+	}
+	if len(models) < 2 {
+		return betSlip{}, http.StatusBadRequest, errors.New("ensemble needs at least two models")
+	}
+	tpl := assignPromptTemplate(userKey, f)
+
+	members := make([]ensembleMember, len(models))
+	var wg sync.WaitGroup
+	for i, m := range models {
+		wg.Add(1)
+		go func(i int, model string) {
+			defer wg.Done()
+			mf := f
+			mf.Model = model
+			mf.Ensemble = nil
+			mf.PromptVersion = tpl.Version
+			members[i] = ensembleMember{Model: model}
+			slip, _, err := generateSlip(ctx, userKey, mf)
+			if err != nil {
+				members[i].Error = err.Error()
+				return
+			}
+			members[i].Slip = &slip
+		}(i, m)
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, m := range members {
+		if m.Slip != nil {
+			ok++
+		}
+	}
+	if ok == 0 {
+		if err := ctx.Err(); err != nil {
+			return betSlip{}, statusForUpstream(err), err
+		}
+		return betSlip{}, http.StatusBadGateway, errors.New("no ensemble member produced a slip")
+	}
+
+	k := f.Ensemble.MinAgree
+	if k <= 0 {
+		k = ok/2 + 1
+	}
+	if k < 2 {
+		k = 2
+	}
+
+	legs := consensusLegs(members, f.Games, k, ok)
+	if want := legsForMode(f); len(legs) > want {
+		legs = legs[:want]
+	}
+
+	slip := betSlip{
+		Title:     "Consensus SGP",
+		Legs:      legs,
+		Model:     consensusModel,
+		Members:   members,
+		CreatedAt: time.Now().UTC(),
+
+		PromptVersion: tpl.Version,
+	}
+	if len(legs) == 0 {
+		slip.Rationale = fmt.Sprintf("No pick was shared by %d of %d models.", k, ok)
+	} else {
+		slip.Rationale = fmt.Sprintf("Legs picked by at least %d of %d models.", k, ok)
+	}
+	slip.EstimatedPayout = computeSlipPayout(legs, f.Mode, f.BoostPct)
+	if slip.EstimatedPayout != nil {
+		slip.CombinedOdds = slip.EstimatedPayout.PreBoostAmerican
+	}
+	slip.Findings = detectLegFindings(viewsFromSlipLegs(legs, f.Games))
+	return slip, http.StatusOK, nil
+}
+
+func dedupeModels(in []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(in))
+	for _, m := range in {
+		k := strings.ToLower(strings.TrimSpace(m))
+		if k == "" || seen[k] {
+			continue
+		}
+		seen[k] = true
+		out = append(out, strings.TrimSpace(m))
+	}
+	return out
+}
+
+// samePick reports whether two normalized legs are the same selection
+// (same subject, market and side; spreads must also be on the same side of 0).
+func samePick(a, b legView) bool {
+	if a.Market != b.Market || a.PropKey != b.PropKey || a.Side != b.Side {
+		return false
+	}
+	switch {
+	case a.Market == mktTotal:
+		if !sameGame(a, b) {
+			return false
+		}
+	case a.IsTeam:
+		if !teamsMatch(a.Subject, b.Subject) {
+			return false
+		}
+	default:
+		if a.Subject == "" || a.Subject != b.Subject {
+			return false
+		}
+	}
+	if a.Market == mktSpread && a.HasLine && b.HasLine && (a.Line < 0) != (b.Line < 0) {
+		return false
+	}
+	return true
+}
+
+// consensusLegs clusters member legs and returns those with >= k distinct
+// models, most-agreed first. Each cluster is represented by its first leg.
+func consensusLegs(members []ensembleMember, games []GameDTO, k, of int) []slipLeg {
+	type cluster struct {
+		leg    slipLeg
+		view   legView
+		models []string
+		order  int
+	}
+	var clusters []*cluster
+
+	for _, m := range members {
+		if m.Slip == nil {
+			continue
+		}
+		views := viewsFromSlipLegs(m.Slip.Legs, games)
+		for i, v := range views {
+			var hit *cluster
+			for _, c := range clusters {
+				if samePick(c.view, v) {
+					hit = c
+					break
+				}
+			}
+			if hit == nil {
+				hit = &cluster{leg: m.Slip.Legs[i], view: v, order: len(clusters)}
+				clusters = append(clusters, hit)
+			}
+			if !containsFold(hit.models, m.Model) {
+				hit.models = append(hit.models, m.Model)
+			}
+		}
+	}
+
+	sort.SliceStable(clusters, func(i, j int) bool {
+		if len(clusters[i].models) != len(clusters[j].models) {
+			return len(clusters[i].models) > len(clusters[j].models)
+		}
+		return clusters[i].order < clusters[j].order
+	})
+
+	out := make([]slipLeg, 0)
+	for _, c := range clusters {
+		if len(c.models) < k {
+			break
+		}
+		lg := c.leg
+		lg.Agreement = &legAgreement{Count: len(c.models), Of: of, Models: c.models}
+		out = append(out, lg)
+	}
+	return out
+}
+
+func containsFold(list []string, s string) bool {
+	for _, x := range list {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
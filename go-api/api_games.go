@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -47,21 +48,18 @@ func handleListGames(w http.ResponseWriter, r *http.Request) {
 		out []GameDTO
 		err error
 	)
-	switch sport {
-	case "NBA":
-		out, err = fetchESPNGames("basketball/nba", "NBA", start, end)
-	case "NFL":
-		out, err = fetchESPNGames("football/nfl", "NFL", start, end)
-	case "NHL":
-		out, err = fetchESPNGames("hockey/nhl", "NHL", start, end)
-	case "MLB":
-		out, err = fetchESPNGames("baseball/mlb", "MLB", start, end)
-	default:
+	sportPath, ok := espnSportPath(sport)
+	if !ok {
 		errorJSON(w, http.StatusBadRequest, "unsupported sport (use NBA, NFL, NHL, MLB)")
 		return
 	}
+	out, err = fetchESPNGames(r.Context(), sportPath, sport, start, end)
 
 	if err != nil {
+		if outcome := upstreamOutcome(err); outcome != "error" {
+			errorJSON(w, statusForUpstream(err), "games request "+outcome)
+			return
+		}
 		log.Printf("[games] %s error: %v", sport, err)
 		errorJSON(w, http.StatusBadGateway, "failed to fetch games")
 		return
@@ -94,8 +92,7 @@ type espnScoreboard struct {
 	} `json:"events"`
 }
 
-func fetchESPNGames(sportPath, sportLabel string, start, end time.Time) ([]GameDTO, error) {
-	client := &http.Client{Timeout: 15 * time.Second}
+func fetchESPNGames(ctx context.Context, sportPath, sportLabel string, start, end time.Time) ([]GameDTO, error) {
 	byID := make(map[string]GameDTO)
 	hadErr := false
 
@@ -113,15 +110,22 @@ func fetchESPNGames(sportPath, sportLabel string, start, end time.Time) ([]GameD
 
 	day := start.Truncate(24 * time.Hour)
 	for !day.After(end) {
+		// Stop early if the caller gave up; partial results aren't wanted.
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		ds := day.Format("20060102") // YYYYMMDD
 		urlStr := buildURL(ds)
 
-		req, _ := http.NewRequest("GET", urlStr, nil)
+		req, _ := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
 		req.Header.Set("User-Agent", "PropPicks/1.0 (+https://proppicks.local)")
 		req.Header.Set("Accept", "application/json")
 
-		resp, err := client.Do(req)
-		if err != nil {
+		resp, err := espnHTTPClient.Do(req)
+		if recordUpstream("espn", err) != "ok" {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
 			hadErr = true
 			log.Printf("[espn] %s request failed for %s: %v", sportLabel, ds, err)
 			day = day.Add(24 * time.Hour)
@@ -224,6 +228,21 @@ func fetchESPNGames(sportPath, sportLabel string, start, end time.Time) ([]GameD
 
 /* ---------- helpers ---------- */
 
+// espnSportPath maps our sport label (NBA/NFL/NHL/MLB) to ESPN's URL path.
+func espnSportPath(sport string) (string, bool) {
+	switch strings.ToUpper(strings.TrimSpace(sport)) {
+	case "NBA":
+		return "basketball/nba", true
+	case "NFL":
+		return "football/nfl", true
+	case "NHL":
+		return "hockey/nhl", true
+	case "MLB":
+		return "baseball/mlb", true
+	}
+	return "", false
+}
+
 // parseESPNTime tries common ESPN formats: RFC3339 with/without seconds,
 // with optional fractional seconds, and Z or offset timezones.
 func parseESPNTime(s string) (time.Time, bool) {
@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -19,15 +21,27 @@ type generateSlipRequest struct {
 }
 
 type GenerateFilters struct {
-	Sport    string  `json:"sport"`    // e.g., "NFL", "MLB"
-	Mode     string  `json:"mode"`     // "Single" | "SGP" | "SGP+"
-	Legs     int     `json:"legs"`     // desired legs (ignored when Single)
-	Slips    int     `json:"slips"`    // requested count; we still produce one best slip
-	MinOdds  float64 `json:"minOdds"`  // if >= +100, treat as overall payout lower bound
-	MaxOdds  float64 `json:"maxOdds"`  // if >= +100, treat as overall payout upper bound
-	Model    string  `json:"model"`    // exactly one selected model
-	BoostPct float64 `json:"boostPct"` // e.g., 0, 30, 50 (percentage)
+	Sport    string    `json:"sport"`    // e.g., "NFL", "MLB"
+	Mode     string    `json:"mode"`     // "Single" | "SGP" | "SGP+"
+	Legs     int       `json:"legs"`     // desired legs (ignored when Single)
+	Slips    int       `json:"slips"`    // requested count; we still produce one best slip
+	MinOdds  float64   `json:"minOdds"`  // if >= +100, treat as overall payout lower bound
+	MaxOdds  float64   `json:"maxOdds"`  // if >= +100, treat as overall payout upper bound
+	Model    string    `json:"model"`    // exactly one selected model
+	BoostPct float64   `json:"boostPct"` // e.g., 0, 30, 50 (percentage)
 	Games    []GameDTO `json:"games"`
+
+	PromptVersion string `json:"promptVersion,omitempty"` // pin a prompt template; empty = experiment assignment
+	UseTools      *bool  `json:"useTools,omitempty"`      // run the tool-calling loop; nil = GENERATE_TOOLS env
+
+	Ensemble *ensembleOptions `json:"ensemble,omitempty"` // run several models and return a consensus slip
+	Cache    bool             `json:"cache,omitempty"`    // reuse an identical recent result (see slip_cache.go)
+	Stake    *stakeOptions    `json:"stake,omitempty"`    // ask for a win probability and return a suggestedStake (see staking.go)
+
+	// Controlled Randomness only: replay a previous selection. The draw is
+	// only reproducible from the same pool, so a seed requires the pool too.
+	Seed          *int64    `json:"seed,omitempty"`          // PRNG seed returned on an earlier slip
+	CandidatePool []slipLeg `json:"candidatePool,omitempty"` // pool returned on that slip (skips the LLM call)
 }
 
 /* ---------------- Model Output ---------------- */
@@ -38,42 +52,86 @@ type slipLeg struct {
 	Line   string `json:"line,omitempty"`
 	Odds   string `json:"odds,omitempty"`
 	Notes  string `json:"notes,omitempty"`
+
+	Agreement *legAgreement `json:"agreement,omitempty"` // consensus slips only
+}
+
+type slipPayout struct {
+	PreBoostMultiple  float64 `json:"preBoostMultiple"`
+	PreBoostAmerican  string  `json:"preBoostAmerican"`
+	PostBoostMultiple float64 `json:"postBoostMultiple"`
+	PostBoostAmerican string  `json:"postBoostAmerican"`
+	Assumptions       string  `json:"assumptions"`
 }
 
 type betSlip struct {
-	Title           string    `json:"title"`
-	Event           string    `json:"event"`
-	Legs            []slipLeg `json:"legs"`
-	CombinedOdds    string    `json:"combinedOdds,omitempty"`
-	EstimatedPayout *struct {
-		PreBoostMultiple  float64 `json:"preBoostMultiple"`
-		PreBoostAmerican  string  `json:"preBoostAmerican"`
-		PostBoostMultiple float64 `json:"postBoostMultiple"`
-		PostBoostAmerican string  `json:"postBoostAmerican"`
-		Assumptions       string  `json:"assumptions"`
-	} `json:"estimatedPayout,omitempty"`
-	Rationale string    `json:"rationale,omitempty"`
-	CreatedAt time.Time `json:"createdAt"`
+	Title           string      `json:"title"`
+	Event           string      `json:"event"`
+	Legs            []slipLeg   `json:"legs"`
+	CombinedOdds    string      `json:"combinedOdds,omitempty"`
+	EstimatedPayout *slipPayout `json:"estimatedPayout,omitempty"`
+	Rationale       string      `json:"rationale,omitempty"`
+	Model           string      `json:"model,omitempty"`  // model to attribute the bet to when tracked
+	Cached          bool        `json:"cached,omitempty"` // served from the generation cache
+	PromptVersion   string      `json:"promptVersion"`
+	CreatedAt       time.Time   `json:"createdAt"`
+
+	// Contradictions, redundancies and correlations between legs (advisory).
+	Findings []legFinding `json:"findings,omitempty"`
+
+	// Consensus slips only: what each ensemble member produced.
+	Members []ensembleMember `json:"members,omitempty"`
+
+	// Tool calls the LLM made while building this slip (tool loop only).
+	ToolTranscript []toolStep `json:"toolTranscript,omitempty"`
+
+	// Staking requested only: the model's win estimate and the sizing built on it.
+	WinProbability *float64     `json:"winProbability,omitempty"`
+	SuggestedStake *stakeAdvice `json:"suggestedStake,omitempty"`
+
+	// Controlled Randomness only: everything needed to replay the pick.
+	Seed          *int64    `json:"seed,omitempty"`
+	CandidatePool []slipLeg `json:"candidatePool,omitempty"`
 }
 
 /* ---------------- OpenAI payloads ---------------- */
 
 type openAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role       string           `json:"role"`
+	Content    string           `json:"content"`
+	ToolCalls  []openAIToolCall `json:"tool_calls,omitempty"`   // assistant asking for tools
+	ToolCallID string           `json:"tool_call_id,omitempty"` // role "tool": which call this answers
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"` // always "function"
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"` // JSON-encoded object
+	} `json:"function"`
+}
+
+type openAITool struct {
+	Type     string `json:"type"` // always "function"
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
 }
 
 type openAIChatReq struct {
 	Model       string          `json:"model"`
 	Messages    []openAIMessage `json:"messages"`
 	Temperature float32         `json:"temperature,omitempty"`
+	Tools       []openAITool    `json:"tools,omitempty"`
+	ToolChoice  string          `json:"tool_choice,omitempty"` // "auto" | "none"
 }
 
 type openAIChatResp struct {
 	Choices []struct {
-		Message struct {
-			Content string `json:"content"`
-		} `json:"message"`
+		Message openAIMessage `json:"message"`
 	} `json:"choices"`
 }
 
@@ -93,13 +151,139 @@ func handleGenerateSlip(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	prompt := buildPromptFromFilters(req.Filters)
+	userKey := userKeyFromRequest(r)
+	f := req.Filters
+	var cacheKey string
+	if f.Cache && slipCacheable(f) {
+		// Pin the experiment arm first so the key covers the prompt version.
+		f.PromptVersion = assignPromptTemplate(userKey, f).Version
+		cacheKey = slipCacheKey(callerScope(r), f)
+		if slip, ok := getCachedSlip(cacheKey); ok {
+			slip.Cached = true
+			// bankroll-dependent, so never served from the cache
+			if err := suggestSlipStake(r, userKey, f, &slip); err != nil {
+				errorJSON(w, http.StatusInternalServerError, "db error")
+				return
+			}
+			writeJSON(w, http.StatusOK, slip)
+			return
+		}
+	}
+
+	var (
+		slip   betSlip
+		status int
+		err    error
+	)
+	if f.Ensemble != nil {
+		slip, status, err = generateConsensusSlip(r.Context(), userKey, f)
+	} else {
+		slip, status, err = generateSlip(r.Context(), userKey, f)
+	}
+	if err != nil {
+		errorJSON(w, status, err.Error())
+		return
+	}
+
+	if cacheKey != "" {
+		putCachedSlip(cacheKey, slip)
+	}
+	if err := suggestSlipStake(r, userKey, f, &slip); err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, slip)
+}
+
+// generateSlip runs the full single-model pipeline: prompt, LLM (or tool
+// loop), parse, seeded draw for Controlled Randomness, and leg findings.
+func generateSlip(ctx context.Context, userKey string, f GenerateFilters) (betSlip, int, error) {
+	tpl := assignPromptTemplate(userKey, f)
+
+	// Replaying a Controlled Randomness slip needs no LLM call at all.
+	if isControlledRandom(f.Model) && f.Seed != nil {
+		if len(f.CandidatePool) == 0 {
+			return betSlip{}, http.StatusBadRequest, errors.New("seed needs the candidatePool returned with it")
+		}
+		slip := betSlip{Title: "Controlled Random SGP", Model: f.Model, PromptVersion: tpl.Version, CreatedAt: time.Now().UTC()}
+		applySeededSelection(&slip, f.CandidatePool, f)
+		slip.Findings = detectLegFindings(viewsFromSlipLegs(slip.Legs, f.Games))
+		return slip, http.StatusOK, nil
+	}
+
+	prompt := buildPromptFromFilters(f, tpl)
+
+	var (
+		content    string
+		transcript []toolStep
+		status     int
+		err        error
+	)
+	if toolsEnabled(f) {
+		content, transcript, status, err = runToolLoop(ctx, prompt, loadToolLoopConfig())
+	} else {
+		content, status, err = callOpenAIChat(ctx, prompt)
+	}
+	if err != nil {
+		return betSlip{}, status, err
+	}
+
+	// Parse model JSON -> betSlip
+	var slip betSlip
+	if err := json.Unmarshal([]byte(content), &slip); err != nil {
+		// Fallback: still return something so UI can render
+		log.Printf("[generate-slip] JSON parse failed; returning raw content as a single-leg slip")
+		slip = betSlip{
+			Title:     "Generated Slip",
+			Event:     "",
+			Legs:      []slipLeg{{Market: "Raw", Pick: content}},
+			CreatedAt: time.Now().UTC(),
+		}
+	} else {
+		slip.CreatedAt = time.Now().UTC()
+		if isControlledRandom(f.Model) {
+			// The LLM returned a candidate pool; the actual pick happens here.
+			applySeededSelection(&slip, slip.Legs, f)
+		}
+	}
+
+	slip.Model = f.Model
+	slip.PromptVersion = tpl.Version
+	slip.ToolTranscript = transcript
+	slip.Findings = detectLegFindings(viewsFromSlipLegs(slip.Legs, f.Games))
+	return slip, http.StatusOK, nil
+}
+
+/* ---------------- OpenAI client ---------------- */
+
+// System message shared by every generation call.
+const jsonOnlySystemPrompt = "You must output valid JSON only. Never include markdown code fences."
+
+// callOpenAIChat sends one user prompt to the chat completions API and returns
+// the trimmed content of the first choice. On failure the returned status is
+// the HTTP status the handler should answer with.
+func callOpenAIChat(ctx context.Context, prompt string) (string, int, error) {
+	msg, status, err := openAIChatCompletion(ctx, openAIChatReq{
+		Messages: []openAIMessage{
+			{Role: "system", Content: jsonOnlySystemPrompt},
+			{Role: "user", Content: prompt},
+		},
+	})
+	if err != nil {
+		return "", status, err
+	}
+	return strings.TrimSpace(msg.Content), http.StatusOK, nil
+}
 
+// openAIChatCompletion performs one chat completions round-trip and returns
+// the first choice's message. body.Model and body.Temperature are filled from
+// the environment; everything else is sent as given. The call is abandoned as
+// soon as ctx is done (client disconnect or route deadline).
+func openAIChatCompletion(ctx context.Context, body openAIChatReq) (openAIMessage, int, error) {
 	// Env/config
 	key := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
 	if key == "" {
-		errorJSON(w, http.StatusInternalServerError, "server missing OPENAI_API_KEY")
-		return
+		return openAIMessage{}, http.StatusInternalServerError, errors.New("server missing OPENAI_API_KEY")
 	}
 	apiModel := strings.TrimSpace(os.Getenv("OPENAI_MODEL"))
 	if apiModel == "" {
@@ -112,76 +296,59 @@ func handleGenerateSlip(w http.ResponseWriter, r *http.Request) {
 	org := strings.TrimSpace(os.Getenv("OPENAI_ORG")) // optional
 
 	// Build request
-	body := openAIChatReq{
-		Model: apiModel,
-		Messages: []openAIMessage{
-			{Role: "system", Content: "You must output valid JSON only. Never include markdown code fences."},
-			{Role: "user", Content: prompt},
-		},
-		Temperature: 1, // gpt-5-mini only supports the default (1)
-	}
+	body.Model = apiModel
+	body.Temperature = 1 // gpt-5-mini only supports the default (1)
 	payload, _ := json.Marshal(body)
 
-	httpReq, _ := http.NewRequest("POST", base+"/v1/chat/completions", bytes.NewReader(payload))
+	httpReq, _ := http.NewRequestWithContext(ctx, "POST", base+"/v1/chat/completions", bytes.NewReader(payload))
 	httpReq.Header.Set("Authorization", "Bearer "+key)
 	httpReq.Header.Set("Content-Type", "application/json")
 	if org != "" {
 		httpReq.Header.Set("OpenAI-Organization", org)
 	}
 
-	client := &http.Client{Timeout: 120 * time.Second}
-	resp, err := client.Do(httpReq)
+	resp, err := openAIHTTPClient.Do(httpReq)
 	if err != nil {
+		switch recordUpstream("openai", err) {
+		case "canceled":
+			return openAIMessage{}, statusClientClosed, errors.New("request canceled")
+		case "deadline":
+			return openAIMessage{}, http.StatusGatewayTimeout, errors.New("timed out waiting for OpenAI")
+		}
 		log.Printf("[generate-slip] upstream error: %v", err)
-		errorJSON(w, http.StatusBadGateway, "upstream error contacting OpenAI")
-		return
+		return openAIMessage{}, http.StatusBadGateway, errors.New("upstream error contacting OpenAI")
 	}
 	defer resp.Body.Close()
 
-	slurp, _ := io.ReadAll(resp.Body)
+	slurp, err := io.ReadAll(resp.Body)
+	if err != nil {
+		recordUpstream("openai", err)
+		return openAIMessage{}, statusForUpstream(err), errors.New("error reading OpenAI response")
+	}
+	recordUpstream("openai", nil)
 
 	if resp.StatusCode/100 != 2 {
 		log.Printf("[generate-slip] openai non-2xx: status=%d", resp.StatusCode)
-		errorJSON(w, http.StatusBadGateway, strings.TrimSpace(string(slurp)))
-		return
+		return openAIMessage{}, http.StatusBadGateway, errors.New(strings.TrimSpace(string(slurp)))
 	}
 
 	var ai openAIChatResp
 	if err := json.Unmarshal(slurp, &ai); err != nil {
 		log.Printf("[generate-slip] decode error: %v; raw preserved above", err)
-		errorJSON(w, http.StatusBadGateway, "bad openai response")
-		return
+		return openAIMessage{}, http.StatusBadGateway, errors.New("bad openai response")
 	}
 	if len(ai.Choices) == 0 {
-		errorJSON(w, http.StatusBadGateway, "no choices from openai")
-		return
+		return openAIMessage{}, http.StatusBadGateway, errors.New("no choices from openai")
 	}
 
-	content := strings.TrimSpace(ai.Choices[0].Message.Content)
-
-	// Parse model JSON -> betSlip
-	var slip betSlip
-	if err := json.Unmarshal([]byte(content), &slip); err != nil {
-		// Fallback: still return something so UI can render
-		log.Printf("[generate-slip] JSON parse failed; returning raw content as a single-leg slip")
-		slip = betSlip{
-			Title:     "Generated Slip",
-			Event:     "",
-			Legs:      []slipLeg{{Market: "Raw", Pick: content}},
-			CreatedAt: time.Now().UTC(),
-		}
-	} else {
-		slip.CreatedAt = time.Now().UTC()
-	}
-
-	writeJSON(w, http.StatusOK, slip)
+	return ai.Choices[0].Message, http.StatusOK, nil
 }
 
 /* ---------------- Prompt Builder (model-aware) ---------------- */
 
-func buildPromptFromFilters(f GenerateFilters) string {
-	
-	// Legs based on mode
+// legsForMode returns the leg count a slip should have: 1 for Single, else the
+// requested count (default 3).
+func legsForMode(f GenerateFilters) int {
 	legsWanted := 3
 	switch strings.ToLower(strings.TrimSpace(f.Mode)) {
 	case "single":
@@ -191,6 +358,11 @@ func buildPromptFromFilters(f GenerateFilters) string {
 			legsWanted = f.Legs
 		}
 	}
+	return legsWanted
+}
+
+func buildPromptFromFilters(f GenerateFilters, tpl promptTemplate) string {
+	legsWanted := legsForMode(f)
 
 	// Single model & sport
 	model := strings.TrimSpace(f.Model)
@@ -199,24 +371,12 @@ func buildPromptFromFilters(f GenerateFilters) string {
 	}
 	sport := strings.TrimSpace(f.Sport)
 
-	// Current time in America/Toronto to gate out already-started games
-	loc, _ := time.LoadLocation("America/Toronto")
-	now := time.Now().In(loc).Format("Mon Jan 2 2006 15:04 MST")
-
 	var sb strings.Builder
 
 	// >>> Add these lines at the very start of the prompt <<<
-	sb.WriteString(fmt.Sprintf("Current time (America/Toronto): %s\n", now))
-	sb.WriteString("Only use markets for games that have NOT started as of the current time above. Do not use in-play or finished games.\n")
+	sb.WriteString(promptClock())
 	sb.WriteString("Populate \"event\" with the matchup plus local start date/time for the relevant game(s). For SGP+, list all games used separated by '; '.\n\n")
-
-	if len(f.Games) > 0 {
-		sb.WriteString("- Restrict all selections to these upcoming games:\n")
-		for _, g := range f.Games {
-			sb.WriteString(fmt.Sprintf("  • [%s] %s @ %s — starts %s (id=%s)\n",
-				g.Sport, g.Away, g.Home, g.Start, g.ID))
-		}
-	}
+	sb.WriteString(promptGameList(f.Games))
 
 	// JSON schema your UI expects (unchanged)
 	sb.WriteString("Return ONLY JSON with this schema:\n")
@@ -236,16 +396,41 @@ func buildPromptFromFilters(f GenerateFilters) string {
   },
   "rationale": "string(optional)"
 }` + "\n\n")
+	if f.Stake != nil {
+		sb.WriteString("Also include \"winProbability\": your honest estimate (0-1) that the whole slip wins, as a number.\n\n")
+	}
 
 	// Model-specific instructions (sport-aware + payout-aware + SGP/SGP+ rules)
-	sb.WriteString(promptForModel(model, legsWanted, sport, f.MinOdds, f.MaxOdds, f.BoostPct, f.Mode))
+	modeRules := tpl.Rules(f.Mode)
+	payoutBlock := tpl.Payout(f.MinOdds, f.MaxOdds, f.BoostPct, legsWanted, sport)
+	sb.WriteString(promptForModel(model, legsWanted, sport, modeRules, payoutBlock))
 	return sb.String()
 }
 
-func promptForModel(model string, legsWanted int, sport string, minOdds, maxOdds, boostPct float64, mode string) string {
+// promptClock states the current time in America/Toronto to gate out already-started games.
+func promptClock() string {
+	loc, _ := time.LoadLocation("America/Toronto")
+	now := time.Now().In(loc).Format("Mon Jan 2 2006 15:04 MST")
+	return fmt.Sprintf("Current time (America/Toronto): %s\n", now) +
+		"Only use markets for games that have NOT started as of the current time above. Do not use in-play or finished games.\n"
+}
+
+// promptGameList restricts selections to the user's slate (empty when no games were sent).
+func promptGameList(games []GameDTO) string {
+	if len(games) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("- Restrict all selections to these upcoming games:\n")
+	for _, g := range games {
+		sb.WriteString(fmt.Sprintf("  • [%s] %s @ %s — starts %s (id=%s)\n",
+			g.Sport, g.Away, g.Home, g.Start, g.ID))
+	}
+	return sb.String()
+}
+
+func promptForModel(model string, legsWanted int, sport string, modeRules, payoutBlock string) string {
 	modelKey := strings.ToLower(strings.TrimSpace(model))
-	modeRules := sgpRules(mode)
-	payoutBlock := payoutGuidance(minOdds, maxOdds, boostPct, legsWanted, sport)
 
 	switch modelKey {
 	case "narrative", "correlated", "narrative / correlated story":
@@ -272,10 +457,11 @@ Title: "Weird Angles SGP".
 		return fmt.Sprintf(
 			`You are the "Controlled Randomness" model for the sport: %s.
 %s
-From ~15 recent article-backed picks (Action Network / Covers / Oddshark / Hero Sports), transparently randomize to choose exactly %d leg(s).
-Exclude in-play, heavy juice (<−140), or conflicting markets. In "notes", include selection index/seed and a quick sanity check.
+Do NOT pick the final legs yourself. Return a candidate pool of ~%d recent article-backed picks (Action Network / Covers / Oddshark / Hero Sports) in "legs";
+the server draws exactly %d leg(s) from that pool with a seeded PRNG and recomputes the payout.
+Exclude in-play, heavy juice (<−140), or markets that conflict with each other. Every candidate needs "odds"; put a quick sanity check in "notes".
 Title: "Controlled Random SGP".
-%s`, sport, modeRules, legsWanted, payoutBlock)
+%s`, sport, modeRules, randomPoolSize, legsWanted, payoutBlock)
 
 	case "contrarian", "market-based", "market-based / contrarian (fade the crowd)":
 		return fmt.Sprintf(
@@ -1,19 +1,29 @@
 package main
 
 import (
+	"context"
 	"net/http"
+	"sort"
 	"strings"
+	"time"
+
+	"example.com/go-api/odds"
 )
 
 type statRow struct {
-	Model   string  `json:"model"`
-	Sport   string  `json:"sport"`
-	Bets    int     `json:"bets"`
-	Wins    int     `json:"wins"`
-	Losses  int     `json:"losses"`
-	Pushes  int     `json:"pushes"`
-	Units   float64 `json:"units"`
-	RoiPct  float64 `json:"roiPct"`
+	Model  string   `json:"model"`
+	Sport  string   `json:"sport"`
+	Bets   int      `json:"bets"`
+	Wins   int      `json:"wins"`
+	Losses int      `json:"losses"`
+	Pushes int      `json:"pushes"`
+	Units  float64  `json:"units"`
+	RoiPct float64  `json:"roiPct"`
+	Money  *float64 `json:"money,omitempty"` // P/L in money via the bankroll unit sizes; omitted without a unit size
+
+	ClvBets        int      `json:"clvBets,omitempty"`        // bets with both prices, graded or not (see clv.go)
+	AvgClvProbPts  *float64 `json:"avgClvProbPts,omitempty"`  // mean implied-probability gain vs the close
+	AvgClvPricePct *float64 `json:"avgClvPricePct,omitempty"` // mean price gain vs the close
 }
 
 // GET /api/model-stats?mode=Single|SGP|SGP+|ALL
@@ -23,11 +33,6 @@ func handleModelStats(w http.ResponseWriter, r *http.Request) {
 		errorJSON(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
-	if DB == nil {
-		errorJSON(w, http.StatusInternalServerError, "db not initialized")
-		return
-	}
-
 	mode := strings.TrimSpace(r.URL.Query().Get("mode"))
 	switch strings.ToUpper(mode) {
 	case "SINGLE":
@@ -40,16 +45,22 @@ func handleModelStats(w http.ResponseWriter, r *http.Request) {
 		mode = "ALL"
 	}
 
-	var rows []UserModelStat
-	if err := DB.Where("user_key = ? AND mode = ?", userKey, mode).
-		Find(&rows).Error; err != nil {
+	rows, err := store.ModelStats(r.Context(), userKey, mode)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	money, clv, err := statsSums(r.Context(), userKey, mode)
+	if err != nil {
 		errorJSON(w, http.StatusInternalServerError, "db error")
 		return
 	}
 
 	out := make([]statRow, 0, len(rows))
+	seen := map[[2]string]bool{}
 	for _, s := range rows {
-		out = append(out, statRow{
+		row := statRow{
 			Model:  s.Model,
 			Sport:  s.Sport,
 			Bets:   s.Bets,
@@ -58,8 +69,431 @@ func handleModelStats(w http.ResponseWriter, r *http.Request) {
 			Pushes: s.Pushes,
 			Units:  s.Units,
 			RoiPct: s.RoiPct,
+			Money:  money.total(s.Model, s.Sport),
+		}
+		row.ClvBets, row.AvgClvProbPts, row.AvgClvPricePct = clv.total(s.Model, s.Sport)
+		out = append(out, row)
+		seen[[2]string{s.Model, s.Sport}] = true
+	}
+	// CLV needs no result, so models with only ungraded bets still get a row.
+	added := false
+	for k := range clv {
+		if !seen[k] {
+			row := statRow{Model: k[0], Sport: k[1], Money: money.total(k[0], k[1])}
+			row.ClvBets, row.AvgClvProbPts, row.AvgClvPricePct = clv.total(k[0], k[1])
+			out = append(out, row)
+			added = true
+		}
+	}
+	if added {
+		sort.Slice(out, func(i, j int) bool {
+			if out[i].Model != out[j].Model {
+				return out[i].Model < out[j].Model
+			}
+			return out[i].Sport < out[j].Sport
 		})
 	}
 
 	writeJSON(w, http.StatusOK, map[string]any{"stats": out})
 }
+
+// modelMoney is money P/L by model and sport; nil when no unit size is set.
+type modelMoney map[[2]string]float64
+
+func (m modelMoney) total(model, sport string) *float64 {
+	if m == nil {
+		return nil
+	}
+	var v float64
+	for k, x := range m {
+		if k[0] == model && (sport == "ALL" || k[1] == sport) {
+			v += x
+		}
+	}
+	v = round2(v)
+	return &v
+}
+
+// statsSums reads money P/L and CLV by model and sport in one streamed pass
+// over the bet records. Neither can be kept in UserModelStat: unit sizes may
+// be edited later, and closing prices entered after grading (CLV counts
+// ungraded bets too). money is nil when no unit size is set.
+func statsSums(ctx context.Context, userKey, mode string) (modelMoney, modelCLV, error) {
+	ledger, err := loadLedger(ctx, userKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	var money modelMoney
+	if ledger.unitSizeAt(time.Now()) != 0 {
+		money = modelMoney{}
+	}
+	clv := modelCLV{}
+	err = store.EachBetRecord(ctx, userKey, pastBetQuery{Type: modeType(mode)}, func(b PastBetRecord) error {
+		k := [2]string{b.Model, b.Sport}
+		if money != nil && b.Result != nil && b.ResultUnits != nil {
+			if m := ledger.money(*b.ResultUnits, b.Date); m != nil {
+				money[k] += *m
+			}
+		}
+		clv.add(k, clvOf(b.OddsDecimal, b.ClosingDecimal))
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return money, clv, nil
+}
+
+// modeType is the bet type filter for a stats mode ("" for ALL).
+func modeType(mode string) string {
+	if mode == "ALL" {
+		return ""
+	}
+	return mode
+}
+
+// statsQuery reads the model and mode filters the breakdown endpoints share.
+func statsQuery(r *http.Request) pastBetQuery {
+	return pastBetQuery{
+		Model: strings.TrimSpace(r.URL.Query().Get("model")),
+		Type:  modeType(normMode(r.URL.Query().Get("mode"))),
+	}
+}
+
+// gradedBets collects the user's graded bets matching q.
+func gradedBets(ctx context.Context, userKey string, q pastBetQuery) ([]betRow, error) {
+	q.Result = "graded"
+	var out []betRow
+	err := store.EachBet(ctx, userKey, q, func(rows []betRow) error {
+		out = append(out, rows...)
+		return nil
+	})
+	return out, err
+}
+
+type promptVersionRow struct {
+	Model         string  `json:"model"`
+	PromptVersion string  `json:"promptVersion"`
+	Bets          int     `json:"bets"`
+	Wins          int     `json:"wins"`
+	Losses        int     `json:"losses"`
+	Pushes        int     `json:"pushes"`
+	Units         float64 `json:"units"`
+	RoiPct        float64 `json:"roiPct"`
+	HitRatePct    float64 `json:"hitRatePct"` // wins / (wins + losses)
+}
+
+// GET /api/model-stats/prompt-versions?model=...&mode=Single|SGP|SGP+|ALL
+// Compares graded results between prompt versions of each model.
+// Bets logged without a prompt version are left out.
+func handlePromptVersionStats(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	rows, err := gradedBets(r.Context(), userKey, statsQuery(r))
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	type key struct{ Model, Version string }
+	m := map[key]*promptVersionRow{}
+	var order []key
+	for _, rw := range rows {
+		b := rw.Rec
+		if b.PromptVersion == "" {
+			continue
+		}
+		k := key{b.Model, b.PromptVersion}
+		row := m[k]
+		if row == nil {
+			row = &promptVersionRow{Model: b.Model, PromptVersion: b.PromptVersion}
+			m[k] = row
+			order = append(order, k)
+		}
+		var units float64
+		if b.ResultUnits != nil {
+			units = *b.ResultUnits
+		}
+		row.Bets++
+		switch tallyOf(*b.Result, units) {
+		case "win":
+			row.Wins++
+		case "loss":
+			row.Losses++
+		default:
+			row.Pushes++
+		}
+		row.Units += units
+	}
+
+	sort.Slice(order, func(i, j int) bool {
+		if order[i].Model != order[j].Model {
+			return order[i].Model < order[j].Model
+		}
+		return order[i].Version < order[j].Version
+	})
+	out := make([]promptVersionRow, 0, len(order))
+	for _, k := range order {
+		row := m[k]
+		row.RoiPct = (row.Units / float64(row.Bets)) * 100.0
+		if decided := row.Wins + row.Losses; decided > 0 {
+			row.HitRatePct = float64(row.Wins) / float64(decided) * 100.0
+		}
+		out = append(out, *row)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"stats": out})
+}
+
+type promoRow struct {
+	PromoType  string   `json:"promoType"`
+	Bets       int      `json:"bets"` // graded bets with this promo
+	Units      float64  `json:"units"`
+	AddedUnits float64  `json:"addedUnits"`           // units the promo added over the plain price
+	AddedMoney *float64 `json:"addedMoney,omitempty"` // same in money, when a unit size is set
+}
+
+// GET /api/model-stats/promos?model=...&mode=Single|SGP|SGP+|ALL
+// How much each promo type (boosts, bonus bets, no-sweat) added to graded results.
+func handlePromoStats(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	rows, err := gradedBets(r.Context(), userKey, statsQuery(r))
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	ledger, err := loadLedger(r.Context(), userKey)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	m := map[string]*promoRow{}
+	for _, rw := range rows {
+		b := rw.Rec
+		if b.PromoType == "" {
+			continue
+		}
+		row := m[b.PromoType]
+		if row == nil {
+			row = &promoRow{PromoType: b.PromoType}
+			m[b.PromoType] = row
+		}
+		added := promoUnitsFor(b)
+		row.Bets++
+		if b.ResultUnits != nil {
+			row.Units += *b.ResultUnits
+		}
+		row.AddedUnits += added
+		if money := ledger.money(added, b.Date); money != nil {
+			if row.AddedMoney == nil {
+				row.AddedMoney = new(float64)
+			}
+			*row.AddedMoney += *money
+		}
+	}
+
+	out := make([]promoRow, 0, len(m))
+	for _, row := range m {
+		row.Units, row.AddedUnits = round2(row.Units), round2(row.AddedUnits)
+		if row.AddedMoney != nil {
+			*row.AddedMoney = round2(*row.AddedMoney)
+		}
+		out = append(out, *row)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].PromoType < out[j].PromoType })
+	writeJSON(w, http.StatusOK, map[string]any{"promos": out})
+}
+
+type bookRow struct {
+	Model       string   `json:"model"`
+	Sportsbook  string   `json:"sportsbook"` // "" = unattributed
+	Bets        int      `json:"bets"`       // graded bets
+	Staked      float64  `json:"staked"`     // units
+	Units       float64  `json:"units"`
+	RoiPct      float64  `json:"roiPct"`                // units / staked
+	AvgOdds     string   `json:"avgOdds,omitempty"`     // mean decimal price paid, as American
+	AvgHoldPct  *float64 `json:"avgHoldPct,omitempty"`  // see legHold
+	HoldSamples int      `json:"holdSamples,omitempty"` // legs behind avgHoldPct
+}
+
+// legHold estimates the book's hold on a price assuming the other side of a
+// two-way market was priced the same (-110/-110 → 4.55%). Only prices at or
+// shorter than even money say anything under that assumption.
+func legHold(p odds.Price) (float64, bool) {
+	if !p.Valid() || p.Decimal > 2 {
+		return 0, false
+	}
+	return 1 - p.Decimal/2, true
+}
+
+// GET /api/model-stats/books?model=...&mode=Single|SGP|SGP+|ALL
+// Volume, ROI, average price and estimated hold per (model, sportsbook).
+func handleBookStats(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	rows, err := gradedBets(r.Context(), userKey, statsQuery(r))
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+
+	type key struct{ Model, Book string }
+	type acc struct {
+		row     bookRow
+		decSum  float64
+		priced  int
+		holdSum float64
+	}
+	m := map[key]*acc{}
+	for _, rw := range rows {
+		b := rw.Rec
+		k := key{b.Model, b.Sportsbook}
+		a := m[k]
+		if a == nil {
+			a = &acc{row: bookRow{Model: b.Model, Sportsbook: b.Sportsbook}}
+			m[k] = a
+		}
+		a.row.Bets++
+		a.row.Staked += b.Stake
+		if b.ResultUnits != nil {
+			a.row.Units += *b.ResultUnits
+		}
+		if b.OddsDecimal > 1 {
+			a.decSum += b.OddsDecimal
+			a.priced++
+		}
+		// hold from leg prices when the bet has legs, else from the bet's own price
+		prices := []odds.Price{{Decimal: b.OddsDecimal}}
+		if len(rw.Legs) > 0 {
+			prices = prices[:0]
+			for _, l := range rw.Legs {
+				if p, ok := legPrice(l); ok {
+					prices = append(prices, p)
+				}
+			}
+		}
+		for _, p := range prices {
+			if h, ok := legHold(p); ok {
+				a.holdSum += h
+				a.row.HoldSamples++
+			}
+		}
+	}
+
+	out := make([]bookRow, 0, len(m))
+	for _, a := range m {
+		row := a.row
+		row.Staked, row.Units = round2(row.Staked), round2(row.Units)
+		if row.Staked > 0 {
+			row.RoiPct = round2(row.Units / row.Staked * 100)
+		}
+		if a.priced > 0 {
+			row.AvgOdds = odds.Price{Decimal: a.decSum / float64(a.priced)}.American()
+		}
+		if row.HoldSamples > 0 {
+			h := round2(a.holdSum / float64(row.HoldSamples) * 100)
+			row.AvgHoldPct = &h
+		}
+		out = append(out, row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Model != out[j].Model {
+			return out[i].Model < out[j].Model
+		}
+		return out[i].Sportsbook < out[j].Sportsbook
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"books": out})
+}
+
+type tagStatRow struct {
+	Tag    string  `json:"tag"`
+	Model  string  `json:"model"`
+	Bets   int     `json:"bets"`
+	Wins   int     `json:"wins"`
+	Losses int     `json:"losses"`
+	Pushes int     `json:"pushes"`
+	Units  float64 `json:"units"`
+	RoiPct float64 `json:"roiPct"` // units / bets, as in UserModelStat
+}
+
+// GET /api/model-stats/tags?model=...&mode=Single|SGP|SGP+|ALL&tag=...
+// Graded results per (tag, model). A bet counts once under each of its tags.
+func handleTagStats(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	q := statsQuery(r)
+	tag := normTagName(r.URL.Query().Get("tag"))
+	if tag != "" {
+		q.Tags = []string{tag}
+	}
+	rows, err := gradedBets(r.Context(), userKey, q)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	type tagged struct {
+		Tag, Model, Result string
+		ResultUnits        *float64
+	}
+	var bets []tagged
+	for _, b := range rows {
+		for _, t := range b.Tags {
+			if tag == "" || t == tag {
+				bets = append(bets, tagged{t, b.Rec.Model, *b.Rec.Result, b.Rec.ResultUnits})
+			}
+		}
+	}
+
+	type key struct{ Tag, Model string }
+	m := map[key]*tagStatRow{}
+	for _, b := range bets {
+		k := key{b.Tag, b.Model}
+		row := m[k]
+		if row == nil {
+			row = &tagStatRow{Tag: b.Tag, Model: b.Model}
+			m[k] = row
+		}
+		var units float64
+		if b.ResultUnits != nil {
+			units = *b.ResultUnits
+		}
+		row.Bets++
+		switch tallyOf(b.Result, units) {
+		case "win":
+			row.Wins++
+		case "loss":
+			row.Losses++
+		default:
+			row.Pushes++
+		}
+		row.Units += units
+	}
+
+	out := make([]tagStatRow, 0, len(m))
+	for _, row := range m {
+		row.Units = round2(row.Units)
+		row.RoiPct = round2(row.Units / float64(row.Bets) * 100)
+		out = append(out, *row)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Tag != out[j].Tag {
+			return out[i].Tag < out[j].Tag
+		}
+		return out[i].Model < out[j].Model
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"stats": out})
+}
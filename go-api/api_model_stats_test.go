@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestModelStatsMoneyAndCLV(t *testing.T) {
+	useMemStore(t)
+	ctx := t.Context()
+	day := time.Now().UTC().AddDate(0, 0, -3)
+	if err := store.AddBankrollEntry(ctx, &BankrollEntry{ID: newID(), UserKey: "stats-user", Kind: entryUnitSize, Amount: 10, At: day.AddDate(0, 0, -1)}); err != nil {
+		t.Fatal(err)
+	}
+	win, units := "win", 1.5
+	bet := func(model, sport string, taken, closing float64) betRow {
+		return betRow{Rec: PastBetRecord{ID: newID(), UserKey: "stats-user", Type: "Single", Date: day,
+			Model: model, Sport: sport, Odds: "+150", OddsDecimal: taken, ClosingDecimal: closing, Stake: 1}}
+	}
+	graded := bet("Model A", "NBA", 2.5, 2.2)
+	graded.Rec.Result, graded.Rec.ResultUnits = &win, &units
+	if err := store.CreateBets(ctx, []betRow{
+		graded,
+		bet("Model A", "NBA", 2.0, 0),   // no close: no CLV
+		bet("Model B", "NFL", 2.2, 2.5), // ungraded, CLV only
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/model-stats", nil)
+	req.Header.Set("X-PP-User", "stats-user")
+	w := httptest.NewRecorder()
+	handleModelStats(w, req)
+	var res struct{ Stats []statRow }
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("status %d: %s", w.Code, w.Body.String())
+	}
+	if len(res.Stats) != 2 {
+		t.Fatalf("got rows %+v, want Model A/NBA and Model B/NFL", res.Stats)
+	}
+	a, b := res.Stats[0], res.Stats[1]
+	if a.Model != "Model A" || a.Bets != 1 || a.Money == nil || *a.Money != 15 || a.ClvBets != 1 || a.AvgClvPricePct == nil || *a.AvgClvPricePct != 13.64 {
+		t.Errorf("Model A row: %+v", a)
+	}
+	if b.Model != "Model B" || b.Sport != "NFL" || b.Bets != 0 || b.ClvBets != 1 || b.AvgClvProbPts == nil || *b.AvgClvProbPts >= 0 {
+		t.Errorf("CLV-only row: %+v", b)
+	}
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"example.com/go-api/odds"
+	"github.com/go-chi/chi/v5"
+)
+
+/* ===================== HTTP: edit / delete a past bet ====================== */
+
+// pastBetPatch holds the editable fields; nil means "leave as is".
+type pastBetPatch struct {
+	Type          *string  `json:"type"`
+	Date          *string  `json:"date"`
+	Model         *string  `json:"model"`
+	Sport         *string  `json:"sport"`
+	Event         *string  `json:"event"`
+	Odds          *string  `json:"odds"`
+	Units         *float64 `json:"units"` // stake
+	PromptVersion *string  `json:"promptVersion"`
+	Sportsbook    *string  `json:"sportsbook"`
+	PromoType     *string  `json:"promoType"`
+	BoostPct      *float64 `json:"boostPct"`
+	PromoMaxWin   *float64 `json:"promoMaxWin"` // send with promoType/boostPct; absent clears the cap
+	ClosingOdds   *string  `json:"closingOdds"` // "" falls back to the legs' closing prices
+	Notes         *string  `json:"notes"`
+	Tags          []string `json:"tags"` // replaces all tags when present; [] clears
+}
+
+func (p pastBetPatch) apply(rec *PastBetRecord) error {
+	if p.Type != nil {
+		t, err := normBetType(*p.Type)
+		if err != nil {
+			return err
+		}
+		rec.Type = t
+	}
+	if p.Date != nil {
+		if strings.TrimSpace(*p.Date) == "" {
+			return errors.New("date cannot be empty")
+		}
+		d, err := parseBetDate(*p.Date)
+		if err != nil {
+			return err
+		}
+		rec.Date = d
+	}
+	if p.Model != nil {
+		if strings.TrimSpace(*p.Model) == "" {
+			return errors.New("model cannot be empty")
+		}
+		rec.Model = normBetModel(*p.Model)
+	}
+	if p.Sport != nil {
+		if strings.TrimSpace(*p.Sport) == "" {
+			return errors.New("sport cannot be empty")
+		}
+		rec.Sport = strings.TrimSpace(*p.Sport)
+	}
+	if p.Event != nil {
+		rec.Event = strings.TrimSpace(*p.Event)
+	}
+	if p.Odds != nil {
+		rec.Odds, rec.OddsDecimal = canonicalOdds(*p.Odds)
+	}
+	if p.Units != nil {
+		if *p.Units <= 0 {
+			return errors.New("units must be > 0")
+		}
+		rec.Stake = *p.Units
+	}
+	if p.PromptVersion != nil {
+		rec.PromptVersion = strings.TrimSpace(*p.PromptVersion)
+	}
+	if p.Sportsbook != nil {
+		book, ok := normSportsbook(*p.Sportsbook)
+		if !ok {
+			return errors.New("unknown sportsbook (see GET /api/sportsbooks)")
+		}
+		rec.Sportsbook = book
+	}
+	if p.PromoType != nil || p.BoostPct != nil || p.PromoMaxWin != nil {
+		pb := PastBet{PromoType: rec.PromoType, BoostPct: rec.BoostPct, PromoMaxWin: p.PromoMaxWin}
+		if p.PromoType != nil {
+			pb.PromoType = *p.PromoType
+		}
+		if p.BoostPct != nil {
+			pb.BoostPct = *p.BoostPct
+		}
+		if err := normBetPromo(&pb); err != nil {
+			return err
+		}
+		rec.PromoType, rec.BoostPct, rec.PromoMaxWin = pb.PromoType, pb.BoostPct, pb.PromoMaxWin
+	}
+	if p.Notes != nil {
+		rec.Notes = strings.TrimSpace(*p.Notes)
+	}
+	if p.ClosingOdds != nil {
+		rec.ClosingOdds, rec.ClosingDecimal = canonicalOdds(*p.ClosingOdds)
+		rec.ClosingSource = ""
+		if rec.ClosingOdds != "" {
+			rec.ClosingSource = closingManual
+		}
+	}
+	return nil
+}
+
+// regradeUnits recomputes a graded bet's units after an edit of its price,
+// stake or promo. Cash-outs keep the amount paid back; bets graded per leg
+// are re-settled from their legs.
+func regradeUnits(rec PastBetRecord, old PastBetRecord, legs []PastBetLeg) float64 {
+	if rec.Result == nil {
+		return 0
+	}
+	var oldUnits float64
+	if rec.ResultUnits != nil {
+		oldUnits = *rec.ResultUnits
+	}
+	stake := rec.Stake
+	if stake <= 0 {
+		stake = 1
+	}
+	if needsReturnAmount(*rec.Result) {
+		returned := oldUnits + old.Stake
+		if old.PromoType == odds.PromoBonusBet {
+			returned = oldUnits
+		}
+		return unitsForOutcome(rec.Odds, *rec.Result, stake, returned, rec.promo())
+	}
+	for _, l := range legs {
+		if l.Result != nil {
+			if _, units, ok := settleParlay(legs, rec.Odds, stake, rec.promo()); ok {
+				return units
+			}
+			return 0
+		}
+	}
+	return unitsForOutcome(rec.Odds, *rec.Result, stake, 0, rec.promo())
+}
+
+// PATCH /api/past-bets/{id}
+//
+//	{ "odds": "+120", "units": 2, "model": "...", "sport": "...", "type": "...", "date": "...", "event": "...",
+//	  "closingOdds": "+105", "notes": "...", "tags": ["boosted"] }
+//
+// Only the fields present change. A graded bet's units are recomputed, and
+// the store moves its old contribution out of the old (model, sport, mode)
+// stats rows and into the new ones.
+func handlePastBetUpdate(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	id := chi.URLParam(r, "id")
+	var p pastBetPatch
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		errorJSON(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	var tags []string
+	if p.Tags != nil {
+		var err error
+		if tags, err = normTags(p.Tags); err != nil {
+			errorJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	b, err := store.UpdateBet(r.Context(), userKey, id, func(b *betRow) error {
+		old := b.Rec
+		if err := p.apply(&b.Rec); err != nil {
+			return &badRequestError{err.Error()}
+		}
+		deriveClosing(&b.Rec, b.Legs)
+		if b.Rec.Result != nil {
+			units := regradeUnits(b.Rec, old, b.Legs)
+			b.Rec.ResultUnits = &units
+		}
+		if p.Tags != nil {
+			b.Tags = tags
+		}
+		return nil
+	})
+	var bad *badRequestError
+	switch {
+	case errors.Is(err, errNotFound):
+		errorJSON(w, http.StatusNotFound, "not found")
+		return
+	case errors.As(err, &bad):
+		errorJSON(w, http.StatusBadRequest, bad.msg)
+		return
+	case err != nil:
+		errorJSON(w, http.StatusInternalServerError, "db update error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "bet": b.public()})
+}
+
+// DELETE /api/past-bets/{id}
+//
+// Removes the bet, its legs and tag links and takes a graded bet out of its stats rows.
+func handlePastBetDelete(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	id := chi.URLParam(r, "id")
+	switch err := store.DeleteBet(r.Context(), userKey, id); {
+	case errors.Is(err, errNotFound):
+		errorJSON(w, http.StatusNotFound, "not found")
+		return
+	case err != nil:
+		errorJSON(w, http.StatusInternalServerError, "db delete error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
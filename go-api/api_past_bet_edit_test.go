@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPatchType(t *testing.T) {
+	for in, want := range map[string]string{"single": "Single", " sgp ": "SGP", "Sgp+": "SGP+"} {
+		rec := PastBetRecord{Type: "Single"}
+		if err := (pastBetPatch{Type: &in}).apply(&rec); err != nil || rec.Type != want {
+			t.Errorf("type %q: got %q, %v; want %q", in, rec.Type, err, want)
+		}
+	}
+	for _, in := range []string{"ALL", "parlay", ""} {
+		rec := PastBetRecord{Type: "Single"}
+		if err := (pastBetPatch{Type: &in}).apply(&rec); err == nil {
+			t.Errorf("type %q: accepted as %q", in, rec.Type)
+		}
+	}
+}
+
+func TestPatchDate(t *testing.T) {
+	rec := PastBetRecord{}
+	bad := "yesterday"
+	if err := (pastBetPatch{Date: &bad}).apply(&rec); err == nil {
+		t.Errorf("invalid date accepted as %v", rec.Date)
+	}
+	good := "2025-01-31T19:00:00Z"
+	if err := (pastBetPatch{Date: &good}).apply(&rec); err != nil || rec.Date.Format(time.RFC3339) != good {
+		t.Errorf("date %q: got %v, %v", good, rec.Date, err)
+	}
+}
+
+func TestCreateValidates(t *testing.T) {
+	useMemStore(t)
+	post := func(body string) (int, PastBet) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/api/past-bets", strings.NewReader(body))
+		req.Header.Set("X-PP-User", "create-user")
+		w := httptest.NewRecorder()
+		handlePastBets(w, req)
+		var out struct{ Bet PastBet }
+		_ = json.Unmarshal(w.Body.Bytes(), &out)
+		return w.Code, out.Bet
+	}
+	for _, body := range []string{
+		`{"type":"ALL","model":"m","sport":"NBA","odds":"+100"}`,
+		`{"type":"parlay","model":"m","sport":"NBA","odds":"+100"}`,
+		`{"type":"Single","date":"last night","model":"m","sport":"NBA","odds":"+100"}`,
+		`{"type":"SGP","model":"m","sport":"NBA","odds":"+100","legs":[{"market":"ML","result":"won"}]}`,
+	} {
+		if code, _ := post(body); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d, want 400", body, code)
+		}
+	}
+	code, bet := post(`{"type":" sgp ","model":"m","sport":"NBA","odds":"+100","legs":[{"market":"ML","result":" WIN "},{"market":"ML","result":""}]}`)
+	if code != http.StatusOK {
+		t.Fatalf("valid bet: status %d", code)
+	}
+	if bet.Type != "SGP" || len(bet.Legs) != 2 || bet.Legs[0].Result == nil || *bet.Legs[0].Result != "win" || bet.Legs[1].Result != nil {
+		t.Errorf("stored %+v", bet)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* ---------------- Request / Response ---------------- */
+
+type rerollLegRequest struct {
+	Filters  GenerateFilters `json:"filters"`  // the filters the slip was generated with
+	Slip     betSlip         `json:"slip"`     // the slip as last returned to the client
+	LegIndex int             `json:"legIndex"` // 0-based leg to replace
+	// Locked lists legs that must be kept verbatim. When omitted every leg
+	// except LegIndex is kept; when given, unlocked legs are re-rolled too.
+	Locked []int `json:"locked,omitempty"`
+}
+
+type rerollLegResponse struct {
+	Slip             betSlip `json:"slip"`
+	Replaced         []int   `json:"replaced"`         // leg indexes that changed
+	WithinOddsWindow bool    `json:"withinOddsWindow"` // post-boost payout inside [minOdds, maxOdds]
+}
+
+/* ---------------- Handler ---------------- */
+
+// POST /api/generate-slip/reroll
+// Replaces one leg (plus any unlocked legs) of an existing slip using the
+// slip's model, keeps the rest, and recomputes payout and findings.
+func handleRerollLeg(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		errorJSON(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req rerollLegRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		errorJSON(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	legs := req.Slip.Legs
+	if req.LegIndex < 0 || req.LegIndex >= len(legs) {
+		errorJSON(w, http.StatusBadRequest, "legIndex out of range")
+		return
+	}
+	for _, i := range req.Locked {
+		if i < 0 || i >= len(legs) {
+			errorJSON(w, http.StatusBadRequest, "locked index out of range")
+			return
+		}
+	}
+
+	replace := rerollTargets(len(legs), req.LegIndex, req.Locked)
+	kept := make([]slipLeg, 0, len(legs))
+	old := make([]slipLeg, 0, len(replace))
+	for i, lg := range legs {
+		if replace[i] {
+			old = append(old, lg)
+		} else {
+			kept = append(kept, lg)
+		}
+	}
+
+	f := req.Filters
+	slip := req.Slip
+	var fresh []slipLeg
+	if isControlledRandom(f.Model) && len(slip.CandidatePool) > 0 {
+		fresh = redrawFromPool(slip, legs, len(old))
+	} else {
+		tpl, ok := promptTemplates[slip.PromptVersion]
+		if !ok {
+			tpl = assignPromptTemplate(userKeyFromRequest(r), f)
+		}
+		slip.PromptVersion = tpl.Version
+
+		content, status, err := callOpenAIChat(r.Context(), buildRerollPrompt(f, tpl, kept, old))
+		if err != nil {
+			errorJSON(w, status, err.Error())
+			return
+		}
+		var parsed struct {
+			Legs []slipLeg `json:"legs"`
+		}
+		if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+			log.Printf("[reroll] JSON parse failed: %v", err)
+			errorJSON(w, http.StatusBadGateway, "bad replacement from model")
+			return
+		}
+		fresh = parsed.Legs
+		if isControlledRandom(f.Model) {
+			// The model sent a fresh pool; the pick itself stays seeded.
+			fresh = redrawFromPool(betSlip{CandidatePool: fresh, Seed: slip.Seed}, legs, len(old))
+		}
+	}
+	if len(fresh) < len(old) {
+		msg := fmt.Sprintf("model returned %d replacement leg(s), need %d", len(fresh), len(old))
+		if isControlledRandom(f.Model) {
+			msg = fmt.Sprintf("candidate pool ran out: %d unused leg(s) left, need %d", len(fresh), len(old))
+		}
+		errorJSON(w, http.StatusBadGateway, msg)
+		return
+	}
+
+	// Splice replacements back into their original positions.
+	out := make([]slipLeg, len(legs))
+	replaced := make([]int, 0, len(old))
+	next := 0
+	for i := range legs {
+		if replace[i] {
+			out[i] = fresh[next]
+			next++
+			replaced = append(replaced, i)
+		} else {
+			out[i] = legs[i]
+		}
+	}
+
+	slip.Legs = out
+	slip.EstimatedPayout = computeSlipPayout(out, f.Mode, f.BoostPct)
+	slip.CombinedOdds = ""
+	if slip.EstimatedPayout != nil {
+		slip.CombinedOdds = slip.EstimatedPayout.PreBoostAmerican
+	}
+	slip.Findings = detectLegFindings(viewsFromSlipLegs(out, f.Games))
+	slip.CreatedAt = time.Now().UTC()
+
+	writeJSON(w, http.StatusOK, rerollLegResponse{
+		Slip:             slip,
+		Replaced:         replaced,
+		WithinOddsWindow: withinOddsWindow(slip.EstimatedPayout, f.MinOdds, f.MaxOdds),
+	})
+}
+
+// rerollTargets marks which leg indexes get replaced.
+func rerollTargets(n, target int, locked []int) map[int]bool {
+	out := map[int]bool{target: true}
+	if locked == nil {
+		return out
+	}
+	keep := map[int]bool{}
+	for _, i := range locked {
+		keep[i] = true
+	}
+	for i := 0; i < n; i++ {
+		if !keep[i] {
+			out[i] = true
+		}
+	}
+	return out
+}
+
+// redrawFromPool re-rolls Controlled Randomness legs from the slip's own
+// candidate pool, skipping candidates already on the slip. The draw is seeded
+// from the slip seed and the current legs so a given re-roll is reproducible.
+func redrawFromPool(slip betSlip, current []slipLeg, n int) []slipLeg {
+	used := map[string]bool{}
+	for _, lg := range current {
+		used[lg.Market+"|"+lg.Pick] = true
+	}
+	var rest []slipLeg
+	for _, lg := range slip.CandidatePool {
+		if !used[lg.Market+"|"+lg.Pick] {
+			rest = append(rest, lg)
+		}
+	}
+	var seed int64
+	if slip.Seed != nil {
+		seed = *slip.Seed
+	}
+	// Every round changes the legs on the slip, so mixing them in gives each
+	// round its own draw while replaying the same round gives the same one.
+	h := fnv.New64a()
+	for _, lg := range current {
+		h.Write([]byte(lg.Market + "|" + lg.Pick + "\n"))
+	}
+	seed ^= int64(h.Sum64() >> 1)
+
+	out := make([]slipLeg, 0, n)
+	for _, i := range drawLegs(rest, seed, n) {
+		lg := rest[i]
+		lg.Notes = strings.TrimSpace(lg.Notes + fmt.Sprintf(" — re-roll from pool, seed %d", seed))
+		out = append(out, lg)
+	}
+	return out
+}
+
+// withinOddsWindow checks the post-boost American payout against the user's
+// [minOdds, maxOdds] (bounds below +100 are treated as unset, as in payoutGuidance).
+func withinOddsWindow(p *slipPayout, minOdds, maxOdds float64) bool {
+	if minOdds < 100 && maxOdds < 100 {
+		return true
+	}
+	if p == nil {
+		return false
+	}
+	american, err := strconv.ParseFloat(strings.TrimPrefix(p.PostBoostAmerican, "+"), 64)
+	if err != nil {
+		return false
+	}
+	if minOdds >= 100 && american < minOdds {
+		return false
+	}
+	if maxOdds >= 100 && american > maxOdds {
+		return false
+	}
+	return true
+}
+
+/* ---------------- Prompt ---------------- */
+
+func buildRerollPrompt(f GenerateFilters, tpl promptTemplate, kept, old []slipLeg) string {
+	model := strings.TrimSpace(f.Model)
+	if model == "" {
+		model = "Narrative"
+	}
+	sport := strings.TrimSpace(f.Sport)
+	total := len(kept) + len(old)
+
+	var sb strings.Builder
+	sb.WriteString(promptClock())
+	sb.WriteString(promptGameList(f.Games))
+	sb.WriteString("\nYou are REPLACING legs of an existing slip; the slip keeps its other legs.\n")
+	if len(kept) > 0 {
+		sb.WriteString("LOCKED legs (keep as-is; do not repeat, contradict or redundantly correlate with them):\n")
+		for _, lg := range kept {
+			sb.WriteString("  • " + describeSlipLeg(lg) + "\n")
+		}
+	}
+	sb.WriteString("REJECTED legs (do not return these or the same market on the same subject):\n")
+	for _, lg := range old {
+		sb.WriteString("  • " + describeSlipLeg(lg) + "\n")
+	}
+	if isControlledRandom(model) {
+		sb.WriteString(fmt.Sprintf("Return a fresh candidate pool; the server draws %d replacement(s) from it. The full slip (%d legs) must still satisfy the bet type rules below.\n", len(old), total))
+	} else {
+		sb.WriteString(fmt.Sprintf("Return exactly %d new leg(s). The full slip (%d legs) must still satisfy the bet type rules and payout range below.\n", len(old), total))
+	}
+	sb.WriteString("Return ONLY JSON with this schema:\n")
+	sb.WriteString(`{"legs": [{"market":"string","pick":"string","line":"string(optional)","odds":"string","notes":"string(optional)"}]}` + "\n\n")
+
+	modeRules := tpl.Rules(f.Mode)
+	payoutBlock := tpl.Payout(f.MinOdds, f.MaxOdds, f.BoostPct, total, sport)
+	sb.WriteString(promptForModel(model, len(old), sport, modeRules, payoutBlock))
+	return sb.String()
+}
+
+func describeSlipLeg(lg slipLeg) string {
+	parts := []string{lg.Market + ": " + lg.Pick}
+	if lg.Line != "" {
+		parts = append(parts, lg.Line)
+	}
+	if lg.Odds != "" {
+		parts = append(parts, "("+lg.Odds+")")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func postReroll(t *testing.T, req rerollLegRequest) (int, string) {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	w := httptest.NewRecorder()
+	handleRerollLeg(w, httptest.NewRequest(http.MethodPost, "/api/generate-slip/reroll", strings.NewReader(string(body))))
+	return w.Code, w.Body.String()
+}
+
+func candidatePool(n int) []slipLeg {
+	pool := make([]slipLeg, n)
+	for i := range pool {
+		pool[i] = slipLeg{Market: "ML", Pick: fmt.Sprintf("Team %d", i), Odds: "+120"}
+	}
+	return pool
+}
+
+func TestRerollRejectsBadLocked(t *testing.T) {
+	slip := betSlip{Legs: candidatePool(3)}
+	for _, locked := range [][]int{{3}, {-1}, {0, 7}} {
+		code, body := postReroll(t, rerollLegRequest{Filters: GenerateFilters{Model: "random"}, Slip: slip, LegIndex: 1, Locked: locked})
+		if code != http.StatusBadRequest || !strings.Contains(body, "locked index out of range") {
+			t.Errorf("locked %v: status %d %s, want 400", locked, code, body)
+		}
+	}
+}
+
+func TestRerollPoolRunsOut(t *testing.T) {
+	seed := int64(42)
+	pool := candidatePool(4)
+	slip := betSlip{Legs: pool[:3], CandidatePool: pool, Seed: &seed}
+
+	code, body := postReroll(t, rerollLegRequest{Filters: GenerateFilters{Model: "random"}, Slip: slip, LegIndex: 0, Locked: []int{2}})
+	if code != http.StatusBadGateway || !strings.Contains(body, "candidate pool ran out") {
+		t.Errorf("status %d %s, want 502 saying the pool ran out", code, body)
+	}
+
+	code, body = postReroll(t, rerollLegRequest{Filters: GenerateFilters{Model: "random"}, Slip: slip, LegIndex: 0})
+	if code != http.StatusOK || !strings.Contains(body, "Team 3") {
+		t.Errorf("status %d %s, want the last unused candidate", code, body)
+	}
+}
+
+// Each round changes the slip's legs and so its draw; replaying a round doesn't.
+func TestRedrawFromPoolSeed(t *testing.T) {
+	seed := int64(7)
+	pool := candidatePool(12)
+	slip := betSlip{CandidatePool: pool, Seed: &seed}
+	a := redrawFromPool(slip, pool[:3], 1)
+	if b := redrawFromPool(slip, pool[:3], 1); a[0] != b[0] {
+		t.Errorf("same round drew %v then %v", a[0].Pick, b[0].Pick)
+	}
+	if b := redrawFromPool(slip, []slipLeg{pool[0], pool[1], pool[5]}, 1); a[0].Notes == b[0].Notes {
+		t.Errorf("different rounds used the same seed: %s", a[0].Notes)
+	}
+}
@@ -1,14 +1,15 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 	"os"
 
 	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
 )
 
 /* ---------- DTOs ---------- */
@@ -66,10 +67,6 @@ func handleAuthDemoSignIn(w http.ResponseWriter, r *http.Request) {
 		errorJSON(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
-	if DB == nil {
-		errorJSON(w, http.StatusInternalServerError, "db not initialized")
-		return
-	}
 	if !isDemoEnabled() {
 		errorJSON(w, http.StatusForbidden, "demo mode disabled")
 		return
@@ -83,8 +80,9 @@ func handleAuthDemoSignIn(w http.ResponseWriter, r *http.Request) {
 
 	// (1) Reuse existing demo user if DEMO_PERSIST and valid demoId provided
 	if strings.ToLower(os.Getenv("DEMO_PERSIST")) == "true" && req.DemoID != "" {
-		if err := DB.First(&u, "id = ? AND email LIKE ?", req.DemoID, "demo-%@demo.local").Error; err == nil {
-			reused = true
+		if found, err := store.UserByID(r.Context(), req.DemoID); err == nil &&
+			strings.HasPrefix(found.Email, "demo-") && strings.HasSuffix(found.Email, "@demo.local") {
+			u, reused = found, true
 		}
 	}
 
@@ -100,15 +98,13 @@ func handleAuthDemoSignIn(w http.ResponseWriter, r *http.Request) {
 			DisplayName:  "Demo User",
 			PasswordHash: string(hash),
 		}
-		if err := DB.Create(&u).Error; err != nil {
+		if err := store.CreateUser(r.Context(), &u); err != nil {
 			errorJSON(w, http.StatusInternalServerError, "db error")
 			return
 		}
 
-		// Clone real data from the source user and recompute stats
-		if err := DB.Transaction(func(tx *gorm.DB) error {
-			return cloneRealDataToDemo(u.ID, tx)
-		}); err != nil {
+		// Clone real data from the source user (stats follow the cloned bets)
+		if err := cloneRealDataToDemo(r.Context(), u.ID); err != nil {
 			// Not fatal; user can still log in with empty data
 			// log.Println("[demo] clone error:", err)
 		}
@@ -150,8 +146,8 @@ func handleAuthDemoReset(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Only allow for demo emails
-	var u User
-	if err := DB.First(&u, "id = ?", uid).Error; err != nil {
+	u, err := store.UserByID(r.Context(), uid)
+	if err != nil {
 		errorJSON(w, http.StatusUnauthorized, "user not found")
 		return
 	}
@@ -161,23 +157,26 @@ func handleAuthDemoReset(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Wipe this user's rows and reseed
-	_ = DB.Where("user_key = ?", uid).Delete(&PastBetRecord{}).Error
-	_ = DB.Where("user_key = ?", uid).Delete(&UserModelStat{}).Error
-	if err := seedDemoData(uid); err != nil {
+	if err := store.ResetUser(r.Context(), uid); err != nil {
+		errorJSON(w, http.StatusInternalServerError, "reset failed")
+		return
+	}
+	if err := seedDemoData(r.Context(), uid); err != nil {
 		errorJSON(w, http.StatusInternalServerError, "seed failed")
 		return
 	}
 	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
 }
 
-// Minimal, friendly demo seed with a few recent bets/stat rows.
+// Minimal, friendly demo seed with a few recent bets; graded ones feed the stats.
 // Adjust as you like; it only touches the current user's rows.
-func seedDemoData(userID string) error {
+func seedDemoData(ctx context.Context, userID string) error {
 	now := time.Now().UTC()
 
 	// A small sample of bets over the past week
-	makeBet := func(d int, sport, model, event, odds string, stake float64, result *string, ru *float64) PastBetRecord {
-		return PastBetRecord{
+	makeBet := func(d int, sport, model, event, odds string, stake float64, result *string, ru *float64) betRow {
+		odds, dec := canonicalOdds(odds)
+		return betRow{Rec: PastBetRecord{
 			ID:          newID(),
 			UserKey:     userID,
 			Type:        "Single",
@@ -186,33 +185,25 @@ func seedDemoData(userID string) error {
 			Sport:       sport,
 			Event:       event,
 			Odds:        odds,
+			OddsDecimal: dec,
 			Stake:       stake,
 			Result:      result,
 			ResultUnits: ru,
-		}
+		}}
 	}
 	win := "win"
 	loss := "loss"
 	r1 := 1.2
 	rm1 := -1.1
 
-	bets := []PastBetRecord{
+	bets := []betRow{
 		makeBet(1, "NBA", "Model A", "LAL @ BOS - LeBron 25+ pts", "+150", 1, &win, &r1),
 		makeBet(2, "NBA", "Model A", "GSW @ DEN - Jokic 10+ ast", "-110", 1, &loss, &rm1),
 		makeBet(3, "NFL", "Model B", "Eagles ML", "+120", 1, &win, &r1),
 		makeBet(5, "MLB", "Model A", "Yankees RL -1.5", "+140", 1, nil, nil), // pending
 	}
 
-	if err := DB.Create(&bets).Error; err != nil {
-		return err
-	}
-
-	// Quick aggregate-ish stats (just example numbers)
-	stats := []UserModelStat{
-		{UserKey: userID, Model: "Model A", Sport: "NBA", Mode: "Single", Wins: 10, Losses: 6, Pushes: 1, Bets: 17, Units: 6.3, RoiPct: 12.5},
-		{UserKey: userID, Model: "Model B", Sport: "NFL", Mode: "Single", Wins: 4, Losses: 3, Pushes: 0, Bets: 7, Units: 1.4, RoiPct: 5.2},
-	}
-	return DB.Create(&stats).Error
+	return store.CreateBets(withActor(ctx, actorImport), bets)
 }
 
 
@@ -227,12 +218,6 @@ func toDTO(u User) userDTO {
 	return userDTO{ID: u.ID, Email: u.Email, DisplayName: u.DisplayName}
 }
 
-func findUserByEmail(db *gorm.DB, email string) (User, error) {
-	var u User
-	err := db.Where("LOWER(email) = ?", strings.ToLower(email)).First(&u).Error
-	return u, err
-}
-
 func firstNonEmpty(ss ...string) string {
 	for _, s := range ss {
 		if strings.TrimSpace(s) != "" {
@@ -250,11 +235,6 @@ func handleAuthRegister(w http.ResponseWriter, r *http.Request) {
 		errorJSON(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
-	if DB == nil {
-		errorJSON(w, http.StatusInternalServerError, "db not initialized")
-		return
-	}
-
 	var in struct {
 		Email         string `json:"email"`
 		Password      string `json:"password"`
@@ -281,12 +261,6 @@ func handleAuthRegister(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// ensure unique email
-	if _, err := findUserByEmail(DB, in.Email); err == nil {
-		errorJSON(w, http.StatusConflict, "email already in use")
-		return
-	}
-
 	hash, err := bcrypt.GenerateFromPassword([]byte(in.Password), bcrypt.DefaultCost)
 	if err != nil {
 		errorJSON(w, http.StatusInternalServerError, "hash error")
@@ -299,7 +273,11 @@ func handleAuthRegister(w http.ResponseWriter, r *http.Request) {
 		DisplayName:  disp,
 		PasswordHash: string(hash),
 	}
-	if err := DB.Create(&u).Error; err != nil {
+	// the store enforces unique emails
+	if err := store.CreateUser(r.Context(), &u); errors.Is(err, errConflict) {
+		errorJSON(w, http.StatusConflict, "email already in use")
+		return
+	} else if err != nil {
 		errorJSON(w, http.StatusInternalServerError, "db error")
 		return
 	}
@@ -320,11 +298,6 @@ func handleAuthSignIn(w http.ResponseWriter, r *http.Request) {
 		errorJSON(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
-	if DB == nil {
-		errorJSON(w, http.StatusInternalServerError, "db not initialized")
-		return
-	}
-
 	var in struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -339,7 +312,7 @@ func handleAuthSignIn(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	u, err := findUserByEmail(DB, in.Email)
+	u, err := store.UserByEmail(r.Context(), in.Email)
 	if err != nil {
 		errorJSON(w, http.StatusUnauthorized, "invalid credentials")
 		return
@@ -365,12 +338,12 @@ func handleAuthMe(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	uid := userKeyFromRequest(r)
-	if uid == "" || DB == nil {
+	if uid == "" {
 		errorJSON(w, http.StatusUnauthorized, "unauthorized")
 		return
 	}
-	var u User
-	if err := DB.First(&u, "id = ?", uid).Error; err != nil {
+	u, err := store.UserByID(r.Context(), uid)
+	if err != nil {
 		errorJSON(w, http.StatusUnauthorized, "user not found")
 		return
 	}
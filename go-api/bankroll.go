@@ -0,0 +1,331 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+/* ===================== Bankroll ledger ======================
+Stakes and results are stored in units. The ledger ties units to money: a
+starting balance, deposits and withdrawals, and unit-size changes, each at a
+point in time. A bet's money P/L is its units times the unit size in effect
+on the bet's date; bets placed before the first unit-size entry use that
+first size.
+*/
+
+const (
+	entryStart      = "start"      // (re)sets the balance to Amount
+	entryDeposit    = "deposit"    // adds Amount
+	entryWithdrawal = "withdrawal" // subtracts Amount
+	entryUnitSize   = "unit_size"  // Amount is the money value of one unit from At on
+)
+
+type BankrollEntry struct {
+	ID        string    `gorm:"primaryKey;type:text" json:"id"`
+	UserKey   string    `gorm:"index:idx_bankroll_user_at,priority:1;type:text;not null" json:"-"`
+	Kind      string    `gorm:"type:text;not null" json:"kind"`
+	Amount    float64   `gorm:"not null" json:"amount"`
+	At        time.Time `gorm:"index:idx_bankroll_user_at,priority:2;type:timestamptz;not null" json:"at"`
+	Note      string    `gorm:"type:text;not null;default:''" json:"note,omitempty"`
+	CreatedAt time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+// bankrollLedger is a user's entries in time order.
+type bankrollLedger []BankrollEntry
+
+func loadLedger(ctx context.Context, userKey string) (bankrollLedger, error) {
+	return store.BankrollEntries(ctx, userKey)
+}
+
+// sortLedger puts entries in ledger order: by At, then by CreatedAt.
+func sortLedger(entries []BankrollEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		if !entries[i].At.Equal(entries[j].At) {
+			return entries[i].At.Before(entries[j].At)
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+}
+
+// unitSizeAt is the unit size in effect at t, or 0 when none was ever set.
+func (l bankrollLedger) unitSizeAt(t time.Time) float64 {
+	size := 0.0
+	for _, e := range l {
+		if e.Kind != entryUnitSize {
+			continue
+		}
+		if size == 0 || !e.At.After(t) {
+			size = e.Amount
+		}
+		if e.At.After(t) {
+			break
+		}
+	}
+	return size
+}
+
+// money converts units at time t; nil when no unit size is set.
+func (l bankrollLedger) money(units float64, t time.Time) *float64 {
+	size := l.unitSizeAt(t)
+	if size == 0 {
+		return nil
+	}
+	v := math.Round(units*size*100) / 100
+	return &v
+}
+
+// withMoney fills in StakeMoney/ResultMoney on bets from the ledger.
+func (l bankrollLedger) withMoney(bets []PastBet) {
+	for i := range bets {
+		b := &bets[i]
+		at := mustParse(b.Date)
+		b.StakeMoney = l.money(b.Units, at)
+		if b.Result != "" {
+			b.ResultMoney = l.money(b.ResultUnits, at)
+		}
+	}
+}
+
+/* ---------------- Bankroll over time ---------------- */
+
+type bankrollPoint struct {
+	Date        string  `json:"date"` // YYYY-MM-DD (UTC)
+	Balance     float64 `json:"balance"`
+	Deposits    float64 `json:"deposits"`    // that day
+	Withdrawals float64 `json:"withdrawals"` // that day
+	Profit      float64 `json:"profit"`      // settled bets that day, in money
+	Units       float64 `json:"units"`       // settled bets that day, in units
+}
+
+// settledUnits is the slice of a graded bet the bankroll walk needs.
+type settledUnits struct {
+	Date        time.Time
+	ResultUnits float64
+}
+
+func loadSettledUnits(ctx context.Context, userKey string) ([]settledUnits, error) {
+	var out []settledUnits
+	err := store.EachBet(ctx, userKey, pastBetQuery{Result: "graded"}, func(rows []betRow) error {
+		for _, b := range rows {
+			if b.Rec.ResultUnits != nil {
+				out = append(out, settledUnits{Date: b.Rec.Date, ResultUnits: *b.Rec.ResultUnits})
+			}
+		}
+		return nil
+	})
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	return out, err
+}
+
+// bankrollSeries walks ledger entries and settled bets in time order and
+// returns one point per UTC day with activity.
+func bankrollSeries(l bankrollLedger, bets []settledUnits) []bankrollPoint {
+	var (
+		out     []bankrollPoint
+		balance float64
+	)
+	point := func(t time.Time) *bankrollPoint {
+		day := t.UTC().Format("2006-01-02")
+		if n := len(out); n == 0 || out[n-1].Date != day {
+			out = append(out, bankrollPoint{Date: day})
+		}
+		return &out[len(out)-1]
+	}
+	i, j := 0, 0
+	for i < len(l) || j < len(bets) {
+		if j >= len(bets) || i < len(l) && !l[i].At.After(bets[j].Date) {
+			e := l[i]
+			i++
+			p := point(e.At)
+			switch e.Kind {
+			case entryStart:
+				balance = e.Amount
+			case entryDeposit:
+				balance += e.Amount
+				p.Deposits += e.Amount
+			case entryWithdrawal:
+				balance -= e.Amount
+				p.Withdrawals += e.Amount
+			}
+			p.Balance = round2(balance)
+			continue
+		}
+		b := bets[j]
+		j++
+		p := point(b.Date)
+		p.Units = round2(p.Units + b.ResultUnits)
+		if m := l.money(b.ResultUnits, b.Date); m != nil {
+			balance += *m
+			p.Profit = round2(p.Profit + *m)
+		}
+		p.Balance = round2(balance)
+	}
+	return out
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
+
+/* ---------------- HTTP ---------------- */
+
+// GET /api/bankroll
+//
+// The ledger plus the current balance and unit size.
+func handleBankroll(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	ledger, err := loadLedger(r.Context(), userKey)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	bets, err := loadSettledUnits(r.Context(), userKey)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	var deposits, withdrawals, profit, units float64
+	series := bankrollSeries(ledger, bets)
+	for _, p := range series {
+		deposits += p.Deposits
+		withdrawals += p.Withdrawals
+		profit += p.Profit
+		units += p.Units
+	}
+	balance := 0.0
+	if n := len(series); n > 0 {
+		balance = series[n-1].Balance
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"entries":     append([]BankrollEntry{}, ledger...),
+		"balance":     balance,
+		"unitSize":    ledger.unitSizeAt(time.Now().UTC()),
+		"deposits":    round2(deposits),
+		"withdrawals": round2(withdrawals),
+		"profit":      round2(profit),
+		"units":       round2(units),
+	})
+}
+
+// GET /api/bankroll/history?from=YYYY-MM-DD&to=YYYY-MM-DD
+//
+// Balance by day. The walk always starts at the first entry so balances are
+// right; from/to only trim the returned points.
+func handleBankrollHistory(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+	for _, d := range []string{from, to} {
+		if d == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			errorJSON(w, http.StatusBadRequest, "from/to must be YYYY-MM-DD")
+			return
+		}
+	}
+	ledger, err := loadLedger(r.Context(), userKey)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	bets, err := loadSettledUnits(r.Context(), userKey)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	out := []bankrollPoint{}
+	for _, p := range bankrollSeries(ledger, bets) {
+		if from != "" && p.Date < from || to != "" && p.Date > to {
+			continue
+		}
+		out = append(out, p)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"points": out})
+}
+
+// POST /api/bankroll/entries  { kind: start|deposit|withdrawal|unit_size, amount, at?, note? }
+func handleBankrollAddEntry(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var in struct {
+		Kind   string  `json:"kind"`
+		Amount float64 `json:"amount"`
+		At     string  `json:"at"`
+		Note   string  `json:"note"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		errorJSON(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	e := BankrollEntry{
+		ID:      newID(),
+		UserKey: userKey,
+		Kind:    strings.ToLower(strings.TrimSpace(in.Kind)),
+		Amount:  in.Amount,
+		At:      time.Now().UTC(),
+		Note:    strings.TrimSpace(in.Note),
+	}
+	switch e.Kind {
+	case entryStart:
+		if e.Amount < 0 {
+			errorJSON(w, http.StatusBadRequest, "amount must be >= 0")
+			return
+		}
+	case entryDeposit, entryWithdrawal, entryUnitSize:
+		if e.Amount <= 0 {
+			errorJSON(w, http.StatusBadRequest, "amount must be > 0")
+			return
+		}
+	default:
+		errorJSON(w, http.StatusBadRequest, "kind must be start, deposit, withdrawal or unit_size")
+		return
+	}
+	if s := strings.TrimSpace(in.At); s != "" {
+		t, err := parseQueryDate(s)
+		if err != nil {
+			errorJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		e.At = t.UTC()
+	}
+
+	if err := store.AddBankrollEntry(r.Context(), &e); err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db insert error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true, "entry": e})
+}
+
+// DELETE /api/bankroll/entries/{id}
+func handleBankrollDeleteEntry(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	switch err := store.DeleteBankrollEntry(r.Context(), userKey, chi.URLParam(r, "id")); {
+	case errors.Is(err, errNotFound):
+		errorJSON(w, http.StatusNotFound, "not found")
+	case err != nil:
+		errorJSON(w, http.StatusInternalServerError, "db delete error")
+	default:
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+/* ===================== Bet history ======================
+Each bet write a Store makes is appended to BetEvent in the same
+transaction: create, edit, grade (pending → result), regrade (result →
+another result or back to pending) and delete. Each event keeps the bet as
+it looked before and after (the public PastBet JSON, legs and tags
+included), who made the change and when. Events are never updated; only
+ResetUser removes them. History outlives a deleted bet. Deleting a tag from
+every bet (DeleteTag) is not recorded per bet.
+*/
+
+const (
+	eventCreate  = "create"
+	eventEdit    = "edit"
+	eventGrade   = "grade"
+	eventRegrade = "regrade"
+	eventDelete  = "delete"
+)
+
+const (
+	actorUser   = "user"   // a signed-in user's request (the default)
+	actorImport = "import" // CSV import and demo seeding
+)
+
+type BetEvent struct {
+	ID      uint      `gorm:"primaryKey"` // append order
+	UserKey string    `gorm:"index:idx_bet_event_user_bet,priority:1;type:text;not null"`
+	BetID   string    `gorm:"index:idx_bet_event_user_bet,priority:2;type:text;not null"`
+	Kind    string    `gorm:"type:text;not null"`
+	Actor   string    `gorm:"type:text;not null"`
+	Before  string    `gorm:"type:text;not null;default:''"` // PastBet JSON; "" on create
+	After   string    `gorm:"type:text;not null;default:''"` // PastBet JSON; "" on delete
+	At      time.Time `gorm:"not null"`
+}
+
+type actorKey struct{}
+
+// withActor tags the store calls made with ctx with who is making them.
+func withActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+func actorOf(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey{}).(string); ok && a != "" {
+		return a
+	}
+	return actorUser
+}
+
+// snapshot is the stored form of a bet for Before/After; "" for nil.
+func snapshot(b *betRow) string {
+	if b == nil {
+		return ""
+	}
+	out, _ := json.Marshal(b.public())
+	return string(out)
+}
+
+// newBetEvent records a change from before to after (either may be nil).
+func newBetEvent(ctx context.Context, kind string, before, after *betRow) BetEvent {
+	e := BetEvent{Kind: kind, Actor: actorOf(ctx), Before: snapshot(before), After: snapshot(after), At: time.Now().UTC()}
+	if after != nil {
+		e.UserKey, e.BetID = after.Rec.UserKey, after.Rec.ID
+	} else if before != nil {
+		e.UserKey, e.BetID = before.Rec.UserKey, before.Rec.ID
+	}
+	return e
+}
+
+// gradeEvent is the event for one grading; prev is the result before it.
+func gradeEvent(ctx context.Context, prev string, before, after *betRow) BetEvent {
+	if prev == "" {
+		return newBetEvent(ctx, eventGrade, before, after)
+	}
+	return newBetEvent(ctx, eventRegrade, before, after)
+}
+
+/* ---------------- HTTP ---------------- */
+
+type betEventDTO struct {
+	ID      uint            `json:"id"`
+	Kind    string          `json:"kind"`
+	Actor   string          `json:"actor"`
+	At      time.Time       `json:"at"`
+	Before  json.RawMessage `json:"before"` // null on create
+	After   json.RawMessage `json:"after"`  // null on delete
+	Changed []string        `json:"changed,omitempty"`
+}
+
+func rawOrNull(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
+
+// changedFields lists the top-level bet fields that differ between two snapshots.
+func changedFields(before, after string) []string {
+	var b, a map[string]json.RawMessage
+	if json.Unmarshal([]byte(before), &b) != nil || json.Unmarshal([]byte(after), &a) != nil {
+		return nil
+	}
+	var out []string
+	for k, v := range a {
+		if !bytes.Equal(b[k], v) {
+			out = append(out, k)
+		}
+	}
+	for k := range b {
+		if _, ok := a[k]; !ok {
+			out = append(out, k)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// GET /api/past-bets/{id}/history
+// The bet's events, oldest first. Deleted bets keep their history; bets
+// saved before history was kept answer with an empty list.
+func handlePastBetHistory(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	id := chi.URLParam(r, "id")
+	events, err := store.BetEvents(r.Context(), userKey, id)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	if len(events) == 0 {
+		if _, err := store.GetBet(r.Context(), userKey, id); errors.Is(err, errNotFound) {
+			errorJSON(w, http.StatusNotFound, "not found")
+			return
+		} else if err != nil {
+			errorJSON(w, http.StatusInternalServerError, "db error")
+			return
+		}
+	}
+	out := make([]betEventDTO, 0, len(events))
+	for _, e := range events {
+		out = append(out, betEventDTO{
+			ID: e.ID, Kind: e.Kind, Actor: e.Actor, At: e.At,
+			Before: rawOrNull(e.Before), After: rawOrNull(e.After),
+			Changed: changedFields(e.Before, e.After),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"events": out})
+}
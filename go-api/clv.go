@@ -0,0 +1,340 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/go-api/odds"
+	"github.com/go-chi/chi/v5"
+)
+
+/* ===================== Closing line value ======================
+CLV compares the price a bet was taken at with the price when the market
+closed. It needs no result, so it says something about a model long before
+ROI does. Closing prices are entered by hand or copied from the ESPN odds
+snapshot (pickcenter) once the game has started.
+
+	probDeltaPts = (closing implied − taken implied) × 100   percentage points
+	pricePct     = (taken decimal ÷ closing decimal − 1) × 100
+
+Both are positive when the bet beat the close. A parlay's closing price is
+entered directly or, failing that, the product of its legs' closing prices.
+*/
+
+const (
+	closingManual = "manual"
+	closingESPN   = "espn" // stored as "espn:<provider>"
+)
+
+type betCLV struct {
+	ProbDeltaPts float64 `json:"probDeltaPts"`
+	PricePct     float64 `json:"pricePct"`
+}
+
+// clvOf is nil unless both prices are known.
+func clvOf(taken, closing float64) *betCLV {
+	t, c := odds.Price{Decimal: taken}, odds.Price{Decimal: closing}
+	if !t.Valid() || !c.Valid() {
+		return nil
+	}
+	return &betCLV{
+		ProbDeltaPts: round2((c.ImpliedProb() - t.ImpliedProb()) * 100),
+		PricePct:     round2((taken/closing - 1) * 100),
+	}
+}
+
+// deriveClosing fills a bet's closing price from its legs when none was set
+// on the bet itself; it clears a derived price once a leg loses its own.
+func deriveClosing(rec *PastBetRecord, legs []PastBetLeg) {
+	if rec.ClosingSource == closingManual || len(legs) == 0 {
+		return
+	}
+	rec.ClosingOdds, rec.ClosingDecimal, rec.ClosingSource = "", 0, ""
+	prices := make([]odds.Price, 0, len(legs))
+	for _, l := range legs {
+		p := odds.Price{Decimal: l.ClosingDecimal}
+		if !p.Valid() {
+			return
+		}
+		prices = append(prices, p)
+	}
+	p := odds.Parlay(prices...)
+	rec.ClosingOdds, rec.ClosingDecimal = p.American(), p.Decimal
+}
+
+/* ---------------- ESPN snapshot ---------------- */
+
+// espnClosingPrice finds a leg's price in the game's first pickcenter
+// provider. Only moneylines, game spreads and game totals are listed there,
+// each at its main line: spread and total legs must be at that line, since
+// an alt line's price is not the main market's.
+func espnClosingPrice(g GameDetailsDTO, l PastBetLeg) (string, bool) {
+	if len(g.Odds) == 0 {
+		return "", false
+	}
+	o := g.Odds[0]
+	team := strings.ToLower(strings.TrimSpace(l.Team))
+	isHome := team != "" && (teamMentioned(team, g.Home.Name) || strings.EqualFold(team, g.Home.Abbrev))
+	isAway := team != "" && (teamMentioned(team, g.Away.Name) || strings.EqualFold(team, g.Away.Abbrev))
+	if l.Player != "" {
+		return "", false
+	}
+	var price string
+	switch market := classifyMarket(l.Market); {
+	case (market == mktMoneyline || market == mktSpread) && isHome != isAway:
+		if market == mktMoneyline {
+			price = pick(isHome, o.HomeMoneyline, o.AwayMoneyline)
+		} else if sameLine(l.Line, pickLine(isHome, o.Spread)) {
+			price = pick(isHome, o.HomeSpreadOdds, o.AwaySpreadOdds)
+		}
+	case (market == mktTotal || market == mktProp) && team == "" && sameLine(l.Line+" "+l.Market, o.OverUnder):
+		switch sideOf(l.Line, l.Market) {
+		case "over":
+			price = o.OverOdds
+		case "under":
+			price = o.UnderOdds
+		}
+	}
+	if _, ok := odds.ParseOK(price); !ok {
+		return "", false
+	}
+	return price, true
+}
+
+func pick(home bool, h, a string) string {
+	if home {
+		return h
+	}
+	return a
+}
+
+// pickLine is the spread from the picked side: the snapshot lists the home
+// team's, and the away team gets the other side of it.
+func pickLine(home bool, homeSpread float64) float64 {
+	if home {
+		return homeSpread
+	}
+	return -homeSpread
+}
+
+// sameLine reports whether text carries the line want; no line never matches.
+func sameLine(text string, want float64) bool {
+	got, ok := parseLine(text)
+	return ok && math.Abs(got-want) < 0.001
+}
+
+type closingSkip struct {
+	Index  int    `json:"index"`
+	Reason string `json:"reason"`
+}
+
+// fetchClosingLegs fills closing prices from ESPN for legs that have a game
+// id and no closing price yet. One summary request per game.
+func fetchClosingLegs(ctx context.Context, sport string, legs []PastBetLeg) ([]int, []closingSkip) {
+	var (
+		changed []int
+		skipped []closingSkip
+	)
+	sportPath, ok := espnSportPath(sport)
+	games := map[string]*GameDetailsDTO{}
+	for i := range legs {
+		l := &legs[i]
+		if l.ClosingDecimal > 0 {
+			continue
+		}
+		if l.GameID == "" || !ok {
+			skipped = append(skipped, closingSkip{i, "no game id or unsupported sport"})
+			continue
+		}
+		g, seen := games[l.GameID]
+		if !seen {
+			d, err := fetchESPNGameDetails(ctx, sportPath, sport, l.GameID)
+			if err != nil {
+				log.Printf("[clv] game %s: %v", l.GameID, err)
+			} else {
+				g = &d
+			}
+			games[l.GameID] = g
+		}
+		if g == nil {
+			skipped = append(skipped, closingSkip{i, "odds provider unavailable"})
+			continue
+		}
+		if start, err := time.Parse(time.RFC3339, g.Start); err != nil || time.Now().Before(start) {
+			skipped = append(skipped, closingSkip{i, "game has not started"})
+			continue
+		}
+		price, found := espnClosingPrice(*g, *l)
+		if !found {
+			skipped = append(skipped, closingSkip{i, "market not in the odds snapshot"})
+			continue
+		}
+		l.ClosingOdds, l.ClosingDecimal = canonicalOdds(price)
+		l.ClosingSource = closingESPN + ":" + g.Odds[0].Provider
+		changed = append(changed, i)
+	}
+	return changed, skipped
+}
+
+/* ---------------- HTTP ---------------- */
+
+type legClosingIn struct {
+	ID    string `json:"id,omitempty"`
+	Index *int   `json:"index,omitempty"`
+	Odds  string `json:"odds"` // "" clears
+}
+
+// POST /api/past-bets/{id}/closing
+//
+//	{ "odds"?: "-125", "legs"?: [{"id"|"index", "odds": "+105"}], "fetch"?: true }
+//
+// Sets closing prices by hand; with fetch, legs still missing one are filled
+// from the ESPN snapshot (games that have started only). "odds": "" clears.
+func handlePastBetClosing(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var in struct {
+		Odds  *string        `json:"odds"`
+		Legs  []legClosingIn `json:"legs"`
+		Fetch bool           `json:"fetch"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		errorJSON(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	id := chi.URLParam(r, "id")
+
+	// Load and fetch outside the update: the ESPN calls can be slow.
+	b, err := store.GetBet(r.Context(), userKey, id)
+	if errors.Is(err, errNotFound) {
+		errorJSON(w, http.StatusNotFound, "not found")
+		return
+	} else if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	rec, legs := b.Rec, b.Legs
+
+	changed := map[int]bool{}
+	for _, lc := range in.Legs {
+		idx := legIndex(len(legs), lc, func(j int) string { return legs[j].ID })
+		if idx < 0 {
+			errorJSON(w, http.StatusBadRequest, "leg not found")
+			return
+		}
+		l := &legs[idx]
+		l.ClosingOdds, l.ClosingDecimal = canonicalOdds(lc.Odds)
+		l.ClosingSource = ""
+		if l.ClosingOdds != "" {
+			l.ClosingSource = closingManual
+		}
+		changed[idx] = true
+	}
+	if in.Odds != nil {
+		rec.ClosingOdds, rec.ClosingDecimal = canonicalOdds(*in.Odds)
+		rec.ClosingSource = ""
+		if rec.ClosingOdds != "" {
+			rec.ClosingSource = closingManual
+		}
+	}
+	var skipped []closingSkip
+	if in.Fetch {
+		var fetched []int
+		fetched, skipped = fetchClosingLegs(r.Context(), rec.Sport, legs)
+		for _, i := range fetched {
+			changed[i] = true
+		}
+	}
+
+	// Only the closing fields are written, onto the bet as stored now.
+	b, err = store.UpdateBet(r.Context(), userKey, id, func(cur *betRow) error {
+		for i := range changed {
+			for j := range cur.Legs {
+				if cur.Legs[j].ID == legs[i].ID {
+					l := &cur.Legs[j]
+					l.ClosingOdds, l.ClosingDecimal, l.ClosingSource = legs[i].ClosingOdds, legs[i].ClosingDecimal, legs[i].ClosingSource
+				}
+			}
+		}
+		cur.Rec.ClosingOdds, cur.Rec.ClosingDecimal, cur.Rec.ClosingSource = rec.ClosingOdds, rec.ClosingDecimal, rec.ClosingSource
+		deriveClosing(&cur.Rec, cur.Legs)
+		return nil
+	})
+	if errors.Is(err, errNotFound) {
+		errorJSON(w, http.StatusNotFound, "not found")
+		return
+	} else if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db update error")
+		return
+	}
+	out := map[string]any{"ok": true, "bet": b.public()}
+	if len(skipped) > 0 {
+		out["skipped"] = skipped
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+// legIndex resolves a leg by id or 0-based index; -1 when not found.
+func legIndex(n int, lc legClosingIn, idAt func(int) string) int {
+	if lc.ID != "" {
+		for i := 0; i < n; i++ {
+			if idAt(i) == lc.ID {
+				return i
+			}
+		}
+		return -1
+	}
+	if lc.Index != nil && *lc.Index >= 0 && *lc.Index < n {
+		return *lc.Index
+	}
+	return -1
+}
+
+/* ---------------- Aggregates ---------------- */
+
+// modelCLV sums CLV by model and sport, like modelMoney. Closing prices can
+// be entered after grading, so this is read from the bets rather than kept
+// in UserModelStat; ungraded bets count too.
+type modelCLV map[[2]string]*clvSum
+
+type clvSum struct {
+	n                 int
+	probPts, pricePct float64
+}
+
+func (m modelCLV) total(model, sport string) (n int, probPts, pricePct *float64) {
+	var s clvSum
+	for k, x := range m {
+		if k[0] == model && (sport == "ALL" || k[1] == sport) {
+			s.n += x.n
+			s.probPts += x.probPts
+			s.pricePct += x.pricePct
+		}
+	}
+	if s.n == 0 {
+		return 0, nil, nil
+	}
+	p, q := round2(s.probPts/float64(s.n)), round2(s.pricePct/float64(s.n))
+	return s.n, &p, &q
+}
+
+func (m modelCLV) add(k [2]string, c *betCLV) {
+	if c == nil {
+		return
+	}
+	if m[k] == nil {
+		m[k] = &clvSum{}
+	}
+	m[k].n++
+	m[k].probPts += c.ProbDeltaPts
+	m[k].pricePct += c.PricePct
+}
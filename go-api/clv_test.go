@@ -0,0 +1,80 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestClvOf(t *testing.T) {
+	// taken +150 (2.5), closed +120 (2.2): beat the close
+	c := clvOf(2.5, 2.2)
+	if c == nil || math.Abs(c.ProbDeltaPts-5.45) > 0.01 || math.Abs(c.PricePct-13.64) > 0.01 {
+		t.Errorf("clvOf(2.5, 2.2) = %+v, want ~5.45 pts / 13.64%%", c)
+	}
+	if c := clvOf(2.2, 2.5); c == nil || c.ProbDeltaPts >= 0 || c.PricePct >= 0 {
+		t.Errorf("clvOf(2.2, 2.5) = %+v, want negative", c)
+	}
+	if clvOf(0, 2.2) != nil || clvOf(2.5, 0) != nil {
+		t.Errorf("clvOf with an unknown price should be nil")
+	}
+}
+
+func TestDeriveClosing(t *testing.T) {
+	legs := []PastBetLeg{{ClosingDecimal: 2}, {ClosingDecimal: 1.5}}
+	rec := PastBetRecord{}
+	deriveClosing(&rec, legs)
+	if rec.ClosingDecimal != 3 || rec.ClosingOdds != "+200" {
+		t.Errorf("derived %v %q, want 3 +200", rec.ClosingDecimal, rec.ClosingOdds)
+	}
+
+	legs[1].ClosingDecimal = 0
+	deriveClosing(&rec, legs)
+	if rec.ClosingDecimal != 0 || rec.ClosingOdds != "" {
+		t.Errorf("a leg without a close should clear the derived price, got %v %q", rec.ClosingDecimal, rec.ClosingOdds)
+	}
+
+	manual := PastBetRecord{ClosingOdds: "-120", ClosingDecimal: 1 + 100.0/120, ClosingSource: closingManual}
+	deriveClosing(&manual, []PastBetLeg{{ClosingDecimal: 2}})
+	if manual.ClosingOdds != "-120" {
+		t.Errorf("manual closing price overwritten with %q", manual.ClosingOdds)
+	}
+}
+
+func TestESPNClosingPrice(t *testing.T) {
+	g := GameDetailsDTO{
+		Home: TeamInfoDTO{Name: "Boston Celtics", Abbrev: "BOS"},
+		Away: TeamInfoDTO{Name: "Los Angeles Lakers", Abbrev: "LAL"},
+		Odds: []GameOddsDTO{{
+			Provider: "ESPN BET", Spread: -7.5, OverUnder: 220.5,
+			OverOdds: "-110", UnderOdds: "-112",
+			HomeMoneyline: "-300", AwayMoneyline: "+240",
+			HomeSpreadOdds: "-108", AwaySpreadOdds: "-114",
+		}},
+	}
+	tests := []struct {
+		name string
+		leg  PastBetLeg
+		want string
+	}{
+		{"home moneyline", PastBetLeg{Team: "Celtics", Market: "ML"}, "-300"},
+		{"away moneyline by abbrev", PastBetLeg{Team: "LAL", Market: "Moneyline"}, "+240"},
+		{"home spread at the main line", PastBetLeg{Team: "Celtics", Market: "Spread", Line: "-7.5"}, "-108"},
+		{"away spread at the main line", PastBetLeg{Team: "Lakers", Market: "Spread", Line: "+7.5"}, "-114"},
+		{"alt spread", PastBetLeg{Team: "Celtics", Market: "Spread", Line: "-10.5"}, ""},
+		{"spread with the wrong side's sign", PastBetLeg{Team: "Lakers", Market: "Spread", Line: "-7.5"}, ""},
+		{"spread without a line", PastBetLeg{Team: "Celtics", Market: "Spread"}, ""},
+		{"over at the main total", PastBetLeg{Market: "Total", Line: "Over 220.5"}, "-110"},
+		{"under at the main total", PastBetLeg{Market: "Under", Line: "220.5"}, "-112"},
+		{"alt total", PastBetLeg{Market: "Total", Line: "Over 210.5"}, ""},
+		{"player prop", PastBetLeg{Player: "Jayson Tatum", Market: "PTS", Line: "Over 27.5"}, ""},
+	}
+	for _, tt := range tests {
+		got, ok := espnClosingPrice(g, tt.leg)
+		if got != tt.want || ok != (tt.want != "") {
+			t.Errorf("%s: got %q %v, want %q", tt.name, got, ok, tt.want)
+		}
+	}
+	if _, ok := espnClosingPrice(GameDetailsDTO{}, PastBetLeg{Team: "Celtics", Market: "ML"}); ok {
+		t.Errorf("no odds snapshot should find nothing")
+	}
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* ---------- DTOs (tool results; not used by the frontend) ---------- */
+
+type TeamInfoDTO struct {
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name"`
+	Abbrev string `json:"abbrev,omitempty"`
+	Record string `json:"record,omitempty"` // overall W-L(-OTL)
+}
+
+type InjuryDTO struct {
+	Team   string `json:"team"`
+	Player string `json:"player"`
+	Status string `json:"status"`
+}
+
+type GameOddsDTO struct {
+	Provider       string  `json:"provider"`
+	Details        string  `json:"details,omitempty"` // e.g. "BOS -5.5"
+	Spread         float64 `json:"spread,omitempty"`  // home-team spread
+	OverUnder      float64 `json:"overUnder,omitempty"`
+	OverOdds       string  `json:"overOdds,omitempty"`
+	UnderOdds      string  `json:"underOdds,omitempty"`
+	HomeMoneyline  string  `json:"homeMoneyline,omitempty"`
+	AwayMoneyline  string  `json:"awayMoneyline,omitempty"`
+	HomeSpreadOdds string  `json:"homeSpreadOdds,omitempty"`
+	AwaySpreadOdds string  `json:"awaySpreadOdds,omitempty"`
+}
+
+type GameDetailsDTO struct {
+	ID       string        `json:"id"`
+	Sport    string        `json:"sport"`
+	Start    string        `json:"start"` // RFC3339
+	Status   string        `json:"status"`
+	Venue    string        `json:"venue,omitempty"`
+	Home     TeamInfoDTO   `json:"home"`
+	Away     TeamInfoDTO   `json:"away"`
+	Odds     []GameOddsDTO `json:"odds,omitempty"`
+	Injuries []InjuryDTO   `json:"injuries,omitempty"`
+}
+
+type TeamResultDTO struct {
+	GameID   string `json:"gameId"`
+	Date     string `json:"date"` // RFC3339
+	Opponent string `json:"opponent"`
+	HomeAway string `json:"homeAway"`
+	Score    string `json:"score"`  // team-opponent
+	Result   string `json:"result"` // W | L | T
+}
+
+/* ---------- ESPN summary + schedule providers ---------- */
+/*
+https://site.api.espn.com/apis/site/v2/sports/{sportPath}/summary?event={id}
+https://site.api.espn.com/apis/site/v2/sports/{sportPath}/teams/{abbrev|id}/schedule
+*/
+
+// espnNumber tolerates ESPN fields that are sometimes numbers and sometimes
+// strings (or objects carrying a displayValue, as scores do).
+type espnNumber string
+
+func (n *espnNumber) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*n = espnNumber(s)
+		return nil
+	}
+	var f json.Number
+	if err := json.Unmarshal(b, &f); err == nil {
+		*n = espnNumber(f.String())
+		return nil
+	}
+	var obj struct {
+		DisplayValue string `json:"displayValue"`
+	}
+	if err := json.Unmarshal(b, &obj); err == nil {
+		*n = espnNumber(obj.DisplayValue)
+	}
+	return nil
+}
+
+type espnCompetitor struct {
+	HomeAway string     `json:"homeAway"`
+	Winner   bool       `json:"winner"`
+	Score    espnNumber `json:"score"`
+	Team     struct {
+		ID               string `json:"id"`
+		Abbreviation     string `json:"abbreviation"`
+		DisplayName      string `json:"displayName"`
+		ShortDisplayName string `json:"shortDisplayName"`
+	} `json:"team"`
+	Record []struct {
+		Type    string `json:"type"`
+		Summary string `json:"summary"`
+	} `json:"record"`
+}
+
+type espnStatus struct {
+	Type struct {
+		Completed bool   `json:"completed"`
+		Detail    string `json:"detail"`
+	} `json:"type"`
+}
+
+type espnSummary struct {
+	Header struct {
+		ID           string `json:"id"`
+		Competitions []struct {
+			Date        string           `json:"date"`
+			Status      espnStatus       `json:"status"`
+			Competitors []espnCompetitor `json:"competitors"`
+		} `json:"competitions"`
+	} `json:"header"`
+	GameInfo struct {
+		Venue struct {
+			FullName string `json:"fullName"`
+		} `json:"venue"`
+	} `json:"gameInfo"`
+	Pickcenter []struct {
+		Provider struct {
+			Name string `json:"name"`
+		} `json:"provider"`
+		Details      string     `json:"details"`
+		Spread       float64    `json:"spread"`
+		OverUnder    float64    `json:"overUnder"`
+		OverOdds     espnNumber `json:"overOdds"`
+		UnderOdds    espnNumber `json:"underOdds"`
+		HomeTeamOdds struct {
+			MoneyLine  espnNumber `json:"moneyLine"`
+			SpreadOdds espnNumber `json:"spreadOdds"`
+		} `json:"homeTeamOdds"`
+		AwayTeamOdds struct {
+			MoneyLine  espnNumber `json:"moneyLine"`
+			SpreadOdds espnNumber `json:"spreadOdds"`
+		} `json:"awayTeamOdds"`
+	} `json:"pickcenter"`
+	Injuries []struct {
+		Team struct {
+			DisplayName string `json:"displayName"`
+		} `json:"team"`
+		Injuries []struct {
+			Status  string `json:"status"`
+			Athlete struct {
+				DisplayName string `json:"displayName"`
+			} `json:"athlete"`
+		} `json:"injuries"`
+	} `json:"injuries"`
+}
+
+type espnTeamSchedule struct {
+	Events []struct {
+		ID           string `json:"id"`
+		Date         string `json:"date"`
+		Competitions []struct {
+			Status      espnStatus       `json:"status"`
+			Competitors []espnCompetitor `json:"competitors"`
+		} `json:"competitions"`
+	} `json:"events"`
+}
+
+// espnGetJSON GETs an ESPN site API path and decodes the JSON body into v.
+func espnGetJSON(ctx context.Context, path string, query url.Values, v any) error {
+	u := url.URL{
+		Scheme:   "https",
+		Host:     "site.api.espn.com",
+		Path:     "/apis/site/v2/sports/" + path,
+		RawQuery: query.Encode(),
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", "PropPicks/1.0 (+https://proppicks.local)")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := espnHTTPClient.Do(req)
+	if err != nil {
+		recordUpstream("espn", err)
+		return err
+	}
+	defer resp.Body.Close()
+	recordUpstream("espn", nil)
+
+	if resp.StatusCode/100 != 2 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 240))
+		return fmt.Errorf("espn %s status=%d body=%q", path, resp.StatusCode, string(b))
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func teamInfo(c espnCompetitor) TeamInfoDTO {
+	t := TeamInfoDTO{
+		ID:     c.Team.ID,
+		Name:   firstNonEmpty(c.Team.DisplayName, c.Team.ShortDisplayName),
+		Abbrev: c.Team.Abbreviation,
+	}
+	for _, r := range c.Record {
+		if r.Type == "" || r.Type == "total" || r.Type == "overall" {
+			t.Record = r.Summary
+			break
+		}
+	}
+	return t
+}
+
+// fetchESPNGameDetails returns teams, status, venue, book odds and injuries for one game.
+func fetchESPNGameDetails(ctx context.Context, sportPath, sportLabel, gameID string) (GameDetailsDTO, error) {
+	var sum espnSummary
+	if err := espnGetJSON(ctx, sportPath+"/summary", url.Values{"event": {gameID}}, &sum); err != nil {
+		return GameDetailsDTO{}, err
+	}
+	if len(sum.Header.Competitions) == 0 {
+		return GameDetailsDTO{}, fmt.Errorf("game %s not found", gameID)
+	}
+
+	comp := sum.Header.Competitions[0]
+	out := GameDetailsDTO{
+		ID:     firstNonEmpty(sum.Header.ID, gameID),
+		Sport:  sportLabel,
+		Status: comp.Status.Type.Detail,
+		Venue:  sum.GameInfo.Venue.FullName,
+	}
+	if t, ok := parseESPNTime(comp.Date); ok {
+		out.Start = t.UTC().Format(time.RFC3339)
+	}
+	for _, c := range comp.Competitors {
+		if strings.ToLower(c.HomeAway) == "home" {
+			out.Home = teamInfo(c)
+		} else {
+			out.Away = teamInfo(c)
+		}
+	}
+	for _, p := range sum.Pickcenter {
+		out.Odds = append(out.Odds, GameOddsDTO{
+			Provider:       p.Provider.Name,
+			Details:        p.Details,
+			Spread:         p.Spread,
+			OverUnder:      p.OverUnder,
+			OverOdds:       americanString(p.OverOdds),
+			UnderOdds:      americanString(p.UnderOdds),
+			HomeMoneyline:  americanString(p.HomeTeamOdds.MoneyLine),
+			AwayMoneyline:  americanString(p.AwayTeamOdds.MoneyLine),
+			HomeSpreadOdds: americanString(p.HomeTeamOdds.SpreadOdds),
+			AwaySpreadOdds: americanString(p.AwayTeamOdds.SpreadOdds),
+		})
+	}
+	for _, team := range sum.Injuries {
+		for _, inj := range team.Injuries {
+			out.Injuries = append(out.Injuries, InjuryDTO{
+				Team:   team.Team.DisplayName,
+				Player: inj.Athlete.DisplayName,
+				Status: inj.Status,
+			})
+		}
+	}
+	return out, nil
+}
+
+// fetchESPNTeamResults returns a team's most recent completed games, newest first.
+// team may be an ESPN team id or abbreviation (e.g. "bos").
+func fetchESPNTeamResults(ctx context.Context, sportPath, team string, limit int) ([]TeamResultDTO, error) {
+	var sched espnTeamSchedule
+	path := sportPath + "/teams/" + url.PathEscape(strings.ToLower(strings.TrimSpace(team))) + "/schedule"
+	if err := espnGetJSON(ctx, path, url.Values{}, &sched); err != nil {
+		return nil, err
+	}
+
+	out := make([]TeamResultDTO, 0)
+	for _, ev := range sched.Events {
+		if len(ev.Competitions) == 0 || !ev.Competitions[0].Status.Type.Completed {
+			continue
+		}
+		var us, them *espnCompetitor
+		for i := range ev.Competitions[0].Competitors {
+			c := &ev.Competitions[0].Competitors[i]
+			if strings.EqualFold(c.Team.ID, team) || strings.EqualFold(c.Team.Abbreviation, team) {
+				us = c
+			} else {
+				them = c
+			}
+		}
+		if us == nil || them == nil {
+			continue
+		}
+		res := "L"
+		if us.Winner {
+			res = "W"
+		} else if !them.Winner {
+			res = "T"
+		}
+		date := ev.Date
+		if t, ok := parseESPNTime(ev.Date); ok {
+			date = t.UTC().Format(time.RFC3339)
+		}
+		out = append(out, TeamResultDTO{
+			GameID:   ev.ID,
+			Date:     date,
+			Opponent: teamInfo(*them).Name,
+			HomeAway: strings.ToLower(us.HomeAway),
+			Score:    string(us.Score) + "-" + string(them.Score),
+			Result:   res,
+		})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Date > out[j].Date })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// americanString renders an ESPN price as a signed American string ("+150", "-110").
+func americanString(n espnNumber) string {
+	s := strings.TrimSpace(string(n))
+	if s == "" || s == "0" {
+		return ""
+	}
+	if s[0] != '-' && s[0] != '+' && !strings.EqualFold(s, "EVEN") {
+		s = "+" + s
+	}
+	return s
+}
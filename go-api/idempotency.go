@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ===================== Idempotency-Key support ======================
+Clients may send `Idempotency-Key: <opaque>` on POSTs that cost money or
+create rows. The first request with a key runs normally and its response is
+kept for the window; repeats (including ones that arrive while the first is
+still running) get the stored response instead of re-running the handler.
+State is per process, like memStore.
+*/
+
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotencyMaxBody caps the body read for hashing: the largest any
+// idempotent route accepts (CSV import). Routes still apply their own caps.
+const idempotencyMaxBody = importMaxBytes
+
+var idempotencyWindow = time.Duration(envInt("IDEMPOTENCY_TTL_SEC", 600)) * time.Second
+
+type idemEntry struct {
+	bodyHash string
+	done     chan struct{} // closed once the response is stored
+	status   int
+	header   http.Header
+	body     []byte
+	expires  time.Time
+}
+
+var (
+	idemMu      sync.Mutex
+	idemEntries = map[string]*idemEntry{}
+)
+
+// idemRecorder tees the handler's response so it can be replayed.
+type idemRecorder struct {
+	http.ResponseWriter
+	status int
+	buf    bytes.Buffer
+}
+
+func (r *idemRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *idemRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.buf.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// callerScope names who a per-caller cache entry belongs to: the user key,
+// or for anonymous callers their address, so they never share entries.
+func callerScope(r *http.Request) string {
+	if userKey := userKeyFromRequest(r); userKey != "" {
+		return "user:" + userKey
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "anon:" + host
+}
+
+// idempotent is middleware honoring Idempotency-Key. Keys are scoped to the
+// caller (see callerScope) and route; reusing a key with a different body is rejected with 422.
+// Only 2xx/4xx responses are kept, so failed or canceled requests can be retried.
+func idempotent(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(idempotencyHeader))
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > 255 {
+			errorJSON(w, http.StatusBadRequest, "Idempotency-Key too long")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, idempotencyMaxBody))
+		if err != nil {
+			var mbe *http.MaxBytesError
+			if errors.As(err, &mbe) {
+				errorJSON(w, http.StatusRequestEntityTooLarge, "request body too large")
+				return
+			}
+			errorJSON(w, http.StatusBadRequest, "could not read body")
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		sum := sha256.Sum256(body)
+		bodyHash := hex.EncodeToString(sum[:])
+		scoped := callerScope(r) + "|" + r.Method + " " + r.URL.Path + "|" + key
+
+		for {
+			idemMu.Lock()
+			sweepIdempotency(time.Now())
+			e, ok := idemEntries[scoped]
+			if !ok {
+				e = &idemEntry{bodyHash: bodyHash, done: make(chan struct{})}
+				idemEntries[scoped] = e
+				idemMu.Unlock()
+				runIdempotent(w, r, next, scoped, e)
+				return
+			}
+			idemMu.Unlock()
+
+			if e.bodyHash != bodyHash {
+				errorJSON(w, http.StatusUnprocessableEntity, "Idempotency-Key reused with a different request body")
+				return
+			}
+			select {
+			case <-e.done:
+			case <-r.Context().Done():
+				return
+			}
+			if e.status == 0 {
+				continue // first attempt wasn't kept; try to become the runner
+			}
+			for k, v := range e.header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(e.status)
+			_, _ = w.Write(e.body)
+			return
+		}
+	})
+}
+
+func runIdempotent(w http.ResponseWriter, r *http.Request, next http.Handler, scoped string, e *idemEntry) {
+	rec := &idemRecorder{ResponseWriter: w}
+	defer func() {
+		idemMu.Lock()
+		defer idemMu.Unlock()
+		if rec.status/100 == 2 || rec.status/100 == 4 && rec.status != statusClientClosed {
+			e.status = rec.status
+			e.header = w.Header().Clone()
+			e.body = rec.buf.Bytes()
+			e.expires = time.Now().Add(idempotencyWindow)
+		} else {
+			delete(idemEntries, scoped)
+		}
+		close(e.done)
+	}()
+	next.ServeHTTP(rec, r)
+}
+
+// sweepIdempotency drops expired entries. Caller holds idemMu.
+func sweepIdempotency(now time.Time) {
+	for k, e := range idemEntries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(idemEntries, k)
+		}
+	}
+}
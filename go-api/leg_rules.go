@@ -0,0 +1,314 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* ===================== Leg rules engine ======================
+Flags legs within one slip/bet that contradict each other, say the same thing
+twice, or are positively correlated. Works on both generated slipLegs and
+logged BetLegs by first normalizing them to legView. Matching is heuristic
+(free-text markets), so findings are advisory and never block a request.
+*/
+
+type legFinding struct {
+	Kind    string `json:"kind"` // "conflict" | "redundant" | "correlated"
+	Rule    string `json:"rule"` // machine-readable rule id
+	Legs    []int  `json:"legs"` // 0-based leg indexes
+	Message string `json:"message"`
+}
+
+const (
+	mktMoneyline = "ml"
+	mktSpread    = "spread"
+	mktTotal     = "total" // game total (no subject)
+	mktTeamTotal = "team_total"
+	mktProp      = "prop" // player/other market; see legView.PropKey
+)
+
+// legView is the normalized form of a leg the rules operate on.
+type legView struct {
+	Index   int
+	Subject string // lowercased team or player ("" for game totals)
+	IsTeam  bool
+	Market  string // one of mkt*
+	PropKey string // normalized market text for props, e.g. "points"
+	Side    string // "over" | "under" | ""
+	Line    float64
+	HasLine bool
+	Game    string // game id when known
+}
+
+var (
+	lineNumRe  = regexp.MustCompile(`[-+]?\d+(?:\.\d+)?`)
+	spaceRe    = regexp.MustCompile(`\s+`)
+	stopTokens = map[string]bool{"over": true, "under": true, "o": true, "u": true, "ml": true, "moneyline": true, "to": true, "alt": true}
+	matchupRe  = regexp.MustCompile(`\s+(?:@|at|vs\.?|v\.?)\s+`) // "lakers @ celtics", "chiefs vs. bills"
+)
+
+func classifyMarket(market string) string {
+	m := strings.ToLower(market)
+	switch {
+	case m == "ml" || strings.Contains(m, "moneyline") || strings.Contains(m, "money line"):
+		return mktMoneyline
+	case strings.Contains(m, "spread") || strings.Contains(m, "run line") || strings.Contains(m, "puck line") ||
+		strings.Contains(m, "handicap") || strings.Contains(m, "runline") || strings.Contains(m, "puckline"):
+		return mktSpread
+	case strings.Contains(m, "team total"):
+		return mktTeamTotal
+	case strings.HasPrefix(m, "total") || strings.Contains(m, "game total") || m == "o/u" || strings.Contains(m, "over/under"):
+		return mktTotal
+	}
+	return mktProp
+}
+
+func sideOf(texts ...string) string {
+	for _, t := range texts {
+		for _, tok := range strings.Fields(strings.ToLower(t)) {
+			switch strings.Trim(tok, ".,()") {
+			case "over", "o":
+				return "over"
+			case "under", "u":
+				return "under"
+			}
+		}
+		lt := strings.ToLower(strings.TrimSpace(t))
+		if strings.HasSuffix(lt, "+") {
+			return "over" // "25+ pts"
+		}
+	}
+	return ""
+}
+
+// subjectFromPick pulls the leading name out of free text such as
+// "Celtics -5.5", "Jayson Tatum Over 27.5 Points" or "Over 220.5".
+func subjectFromPick(pick string) string {
+	var out []string
+	for _, tok := range strings.Fields(pick) {
+		t := strings.ToLower(strings.Trim(tok, ".,()"))
+		if stopTokens[t] || lineNumRe.MatchString(t) && lineNumRe.FindString(t) == strings.TrimSuffix(t, "+") {
+			break
+		}
+		out = append(out, t)
+	}
+	return strings.Join(out, " ")
+}
+
+func parseLine(texts ...string) (float64, bool) {
+	for _, t := range texts {
+		if m := lineNumRe.FindString(t); m != "" {
+			if f, err := strconv.ParseFloat(m, 64); err == nil {
+				return f, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func normalizeProp(market string) string {
+	m := strings.ToLower(strings.TrimSpace(market))
+	for _, w := range []string{"player", "alt", "alternate", "over", "under", "o/u"} {
+		m = strings.ReplaceAll(m, w, " ")
+	}
+	return strings.TrimSpace(spaceRe.ReplaceAllString(m, " "))
+}
+
+func finishView(v legView, market, pick, line string) legView {
+	v.Market = classifyMarket(market)
+	if v.Market == mktProp {
+		if v.IsTeam && v.Subject == "" {
+			v.Market = mktTotal
+		}
+		v.PropKey = normalizeProp(market)
+		if v.PropKey == "" {
+			v.PropKey = normalizeProp(pick)
+		}
+	}
+	v.Side = sideOf(line, pick, market)
+	if v.Market == mktTotal && v.Subject != "" {
+		v.Market = mktTeamTotal
+	}
+	v.Line, v.HasLine = parseLine(line)
+	if !v.HasLine && v.Market != mktMoneyline {
+		v.Line, v.HasLine = parseLine(strings.TrimPrefix(pick, v.Subject))
+	}
+	return v
+}
+
+// viewsFromBetLegs normalizes logged legs. Team-only legs are team markets;
+// legs with a player are props. Logged legs rarely carry a game id, so when
+// neither it nor games place a leg, a matchup event such as "Lakers @ Celtics"
+// does: every leg that fits it (its team is named there, or it has no team)
+// shares that game. The bet type says nothing, since SGP legs may span games.
+func viewsFromBetLegs(legs []BetLeg, games []GameDTO, event string) []legView {
+	matchup := ""
+	if ev := strings.ToLower(strings.TrimSpace(event)); len(matchupRe.Split(ev, -1)) == 2 {
+		matchup = ev
+	}
+	out := make([]legView, 0, len(legs))
+	for i, lg := range legs {
+		v := legView{Index: i, Game: strings.TrimSpace(lg.GameID)}
+		if p := strings.TrimSpace(lg.Player); p != "" {
+			v.Subject = strings.ToLower(p)
+		} else {
+			v.Subject = strings.ToLower(strings.TrimSpace(lg.Team))
+			v.IsTeam = true
+		}
+		v = finishView(v, lg.Market, "", lg.Line)
+		if v.Game == "" {
+			v.Game = gameForText(games, lg.Team)
+		}
+		if v.Game == "" && matchup != "" && (!v.IsTeam || v.Subject == "" || teamMentioned(matchup, v.Subject)) {
+			v.Game = "event:" + matchup
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// viewsFromSlipLegs normalizes generated legs, whose subject lives in Pick.
+func viewsFromSlipLegs(legs []slipLeg, games []GameDTO) []legView {
+	out := make([]legView, 0, len(legs))
+	for i, lg := range legs {
+		v := legView{Index: i, Subject: subjectFromPick(lg.Pick)}
+		// Team markets are obvious from the market; for props the subject is a
+		// team only when it names a team on the slate.
+		v.IsTeam = classifyMarket(lg.Market) != mktProp || v.Subject == "" || gameForText(games, v.Subject) != ""
+		v = finishView(v, lg.Market, lg.Pick, lg.Line)
+		v.Game = gameForText(games, lg.Pick+" "+lg.Notes)
+		out = append(out, v)
+	}
+	return out
+}
+
+// gameForText returns the id of the single game whose home or away team is
+// mentioned in text ("" when none or ambiguous).
+func gameForText(games []GameDTO, text string) string {
+	t := strings.ToLower(text)
+	if strings.TrimSpace(t) == "" {
+		return ""
+	}
+	found := ""
+	for _, g := range games {
+		if teamMentioned(t, g.Home) || teamMentioned(t, g.Away) {
+			if found != "" && found != g.ID {
+				return ""
+			}
+			found = g.ID
+		}
+	}
+	return found
+}
+
+// teamMentioned matches a full team name or its nickname ("Boston Celtics" / "celtics").
+func teamMentioned(text, team string) bool {
+	team = strings.ToLower(strings.TrimSpace(team))
+	if team == "" {
+		return false
+	}
+	if strings.Contains(text, team) {
+		return true
+	}
+	parts := strings.Fields(team)
+	nick := parts[len(parts)-1]
+	return len(nick) > 2 && strings.Contains(" "+text+" ", " "+nick+" ")
+}
+
+func sameGame(a, b legView) bool { return a.Game != "" && a.Game == b.Game }
+
+// teamsMatch compares two team subjects, tolerating "celtics" vs "boston celtics".
+func teamsMatch(a, b string) bool {
+	if a == "" || b == "" {
+		return false
+	}
+	return a == b || strings.HasSuffix(a, " "+b) || strings.HasSuffix(b, " "+a)
+}
+
+/* ---------- rules ---------- */
+
+// detectLegFindings runs every rule over each pair of legs.
+func detectLegFindings(views []legView) []legFinding {
+	out := make([]legFinding, 0)
+	for i := 0; i < len(views); i++ {
+		for j := i + 1; j < len(views); j++ {
+			if f, ok := checkLegPair(views[i], views[j]); ok {
+				out = append(out, f)
+			}
+		}
+	}
+	return out
+}
+
+func checkLegPair(a, b legView) (legFinding, bool) {
+	pair := []int{a.Index, b.Index}
+	finding := func(kind, rule, msg string, args ...any) (legFinding, bool) {
+		return legFinding{Kind: kind, Rule: rule, Legs: pair, Message: fmt.Sprintf(msg, args...)}, true
+	}
+
+	// Same subject + same over/under market.
+	sameOU := a.Market == b.Market && a.PropKey == b.PropKey && a.Side != "" && b.Side != "" &&
+		(a.Subject == b.Subject || a.IsTeam && teamsMatch(a.Subject, b.Subject)) &&
+		(a.Market != mktTotal || sameGame(a, b))
+	if sameOU {
+		if a.Side != b.Side {
+			over, under := a, b
+			if a.Side == "under" {
+				over, under = b, a
+			}
+			if !over.HasLine || !under.HasLine || over.Line >= under.Line {
+				return finding("conflict", "both_sides_total", "legs %d and %d take both sides of the same total", a.Index+1, b.Index+1)
+			}
+			return legFinding{}, false // a middle is allowed
+		}
+		return finding("redundant", "duplicate_total", "legs %d and %d are the same %s side at different lines", a.Index+1, b.Index+1, a.Side)
+	}
+
+	teamSide := func(v legView) bool { return v.IsTeam && (v.Market == mktMoneyline || v.Market == mktSpread) }
+	if teamSide(a) && teamSide(b) {
+		same := teamsMatch(a.Subject, b.Subject)
+		switch {
+		case same && a.Market == b.Market && a.Market == mktMoneyline:
+			return finding("redundant", "duplicate_moneyline", "legs %d and %d are the same moneyline", a.Index+1, b.Index+1)
+		case same && a.Market != b.Market:
+			return finding("redundant", "ml_plus_spread", "legs %d and %d pair a moneyline with a spread on the same team", a.Index+1, b.Index+1)
+		case same:
+			return finding("redundant", "duplicate_spread", "legs %d and %d are spreads on the same team", a.Index+1, b.Index+1)
+		case sameGame(a, b):
+			if a.Market == mktMoneyline && b.Market == mktMoneyline {
+				return finding("conflict", "opposing_moneylines", "legs %d and %d back both teams to win", a.Index+1, b.Index+1)
+			}
+			spread := a
+			if b.Market == mktSpread {
+				spread = b
+			}
+			if spread.HasLine && spread.Line > 0 && (a.Market == mktSpread) != (b.Market == mktSpread) {
+				return finding("conflict", "ml_vs_opponent_spread", "legs %d and %d back one team's moneyline and the opponent's +%.1f (hedge)", a.Index+1, b.Index+1, spread.Line)
+			}
+			return finding("conflict", "opposing_sides", "legs %d and %d back opposite teams in the same game", a.Index+1, b.Index+1)
+		}
+	}
+
+	// Positive correlation: favourite + game over, underdog + game under, player overs in one game.
+	if sameGame(a, b) {
+		side, total := a, b
+		if b.Market != mktTotal {
+			side, total = b, a
+		}
+		if teamSide(side) && total.Market == mktTotal {
+			fav := side.Market == mktMoneyline || side.HasLine && side.Line < 0
+			if fav && total.Side == "over" {
+				return finding("correlated", "favorite_over", "legs %d and %d: favourite winning pairs with a high-scoring game", a.Index+1, b.Index+1)
+			}
+			if !fav && total.Side == "under" {
+				return finding("correlated", "underdog_under", "legs %d and %d: underdog covering pairs with a low-scoring game", a.Index+1, b.Index+1)
+			}
+		}
+		if a.Market == mktProp && b.Market == mktProp && a.Side == "over" && b.Side == "over" && a.Subject != b.Subject {
+			return finding("correlated", "stacked_player_overs", "legs %d and %d stack player overs in the same game", a.Index+1, b.Index+1)
+		}
+	}
+	return legFinding{}, false
+}
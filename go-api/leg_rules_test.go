@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func findingRules(fs []legFinding) string {
+	rules := make([]string, 0, len(fs))
+	for _, f := range fs {
+		rules = append(rules, f.Rule)
+	}
+	return strings.Join(rules, ",")
+}
+
+// Logged legs usually have no game id; only a matchup event places them.
+func TestBetLegFindingsWithoutGameIDs(t *testing.T) {
+	bothTotals := []BetLeg{
+		{Market: "Total", Line: "Over 220.5"},
+		{Market: "Total", Line: "Under 220.5"},
+	}
+	mlVsSpread := []BetLeg{
+		{Team: "Lakers", Market: "ML"},
+		{Team: "Celtics", Market: "Spread", Line: "+3.5"},
+	}
+	tests := []struct {
+		name  string
+		legs  []BetLeg
+		event string
+		want  string
+	}{
+		{"totals, matchup event", bothTotals, "Lakers @ Celtics", "both_sides_total"},
+		{"totals, vs. event", bothTotals, "Chiefs vs. Bills", "both_sides_total"},
+		{"totals, nothing to go on", bothTotals, "Sunday card", ""},
+		{"totals, no event", bothTotals, "", ""},
+		{"ml vs opponent spread, matchup event", mlVsSpread, "LA Lakers at Boston Celtics", "ml_vs_opponent_spread"},
+		{"ml vs spread, different games", mlVsSpread, "", ""},
+		{"team missing from the event", []BetLeg{
+			{Team: "Knicks", Market: "ML"},
+			{Team: "Celtics", Market: "Spread", Line: "+3.5"},
+		}, "Lakers @ Celtics", ""},
+		{"game ids still decide", []BetLeg{
+			{Team: "Lakers", Market: "ML", GameID: "g1"},
+			{Team: "Celtics", Market: "Spread", Line: "+3.5", GameID: "g2"},
+		}, "Lakers @ Celtics", ""},
+		{"shared game id", []BetLeg{
+			{Player: "LeBron James", Market: "PTS", Line: "Over 25.5", GameID: "g1"},
+			{Player: "Anthony Davis", Market: "REB", Line: "Over 10.5", GameID: "g1"},
+		}, "", "stacked_player_overs"},
+		{"cross-game player overs", []BetLeg{
+			{Player: "LeBron James", Market: "PTS", Line: "Over 25.5"},
+			{Player: "Jayson Tatum", Market: "PTS", Line: "Over 27.5"},
+		}, "NBA Tuesday", ""},
+		{"opposing moneylines", []BetLeg{
+			{Team: "Lakers", Market: "Moneyline"},
+			{Team: "Celtics", Market: "ML"},
+		}, "Lakers @ Celtics", "opposing_moneylines"},
+	}
+	for _, tt := range tests {
+		got := findingRules(detectLegFindings(viewsFromBetLegs(tt.legs, nil, tt.event)))
+		if got != tt.want {
+			t.Errorf("%s: got findings %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/* ---------------- Tool-calling loop ---------------- */
+/*
+When enabled, generation runs as a bounded loop: the LLM may call the tools
+below (backed by the ESPN games provider) before it writes the slip. Every
+call is recorded in a transcript returned on the slip and saved with the bet
+logged from it (PastBet.ToolTranscript).
+*/
+
+// toolStep is one tool call in the transcript returned with a slip.
+type toolStep struct {
+	Step       int    `json:"step"` // loop iteration (1-based)
+	Tool       string `json:"tool"`
+	Arguments  string `json:"arguments"`
+	Result     string `json:"result,omitempty"` // JSON, at most toolResultLimit bytes (see truncateToolResult)
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Max bytes of a tool result sent back to the LLM (and kept in the transcript).
+const toolResultLimit = 8000
+
+// toolArgs is the union of every tool's parameters.
+type toolArgs struct {
+	Sport  string `json:"sport"`
+	Days   int    `json:"days"`
+	GameID string `json:"gameId"`
+	Team   string `json:"team"`
+	Limit  int    `json:"limit"`
+}
+
+type llmTool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any
+	Run         func(ctx context.Context, a toolArgs) (any, error)
+}
+
+func toolSchema(props map[string]any, required ...string) map[string]any {
+	props["sport"] = map[string]any{"type": "string", "enum": []string{"NBA", "NFL", "NHL", "MLB"}}
+	return map[string]any{"type": "object", "properties": props, "required": append([]string{"sport"}, required...)}
+}
+
+var llmTools = []llmTool{
+	{
+		Name:        "list_games",
+		Description: "List upcoming games (not yet started) for a sport.",
+		Parameters: toolSchema(map[string]any{
+			"days": map[string]any{"type": "integer", "description": "look-ahead window in days (1-7, default 2)"},
+		}),
+		Run: toolListGames,
+	},
+	{
+		Name:        "get_game_details",
+		Description: "Teams, records, start time, status, venue, injuries and book odds for one game.",
+		Parameters: toolSchema(map[string]any{
+			"gameId": map[string]any{"type": "string", "description": "game id from list_games"},
+		}, "gameId"),
+		Run: toolGameDetails,
+	},
+	{
+		Name:        "get_odds",
+		Description: "Current moneyline, spread and total prices for one game.",
+		Parameters: toolSchema(map[string]any{
+			"gameId": map[string]any{"type": "string", "description": "game id from list_games"},
+		}, "gameId"),
+		Run: toolOdds,
+	},
+	{
+		Name:        "get_team_recent_results",
+		Description: "A team's most recent completed games with scores, newest first.",
+		Parameters: toolSchema(map[string]any{
+			"team":  map[string]any{"type": "string", "description": "team abbreviation (e.g. BOS) or ESPN team id"},
+			"limit": map[string]any{"type": "integer", "description": "number of games (1-10, default 5)"},
+		}, "team"),
+		Run: toolTeamResults,
+	},
+}
+
+func findTool(name string) (llmTool, bool) {
+	for _, t := range llmTools {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return llmTool{}, false
+}
+
+func toolSportPath(a toolArgs) (string, string, error) {
+	sport := strings.ToUpper(strings.TrimSpace(a.Sport))
+	path, ok := espnSportPath(sport)
+	if !ok {
+		return "", "", fmt.Errorf("unsupported sport %q", a.Sport)
+	}
+	return path, sport, nil
+}
+
+func toolListGames(ctx context.Context, a toolArgs) (any, error) {
+	path, sport, err := toolSportPath(a)
+	if err != nil {
+		return nil, err
+	}
+	days := a.Days
+	if days < 1 || days > 7 {
+		days = 2
+	}
+	start := time.Now().UTC()
+	return fetchESPNGames(ctx, path, sport, start, start.Add(time.Duration(days)*24*time.Hour))
+}
+
+func toolGameDetails(ctx context.Context, a toolArgs) (any, error) {
+	path, sport, err := toolSportPath(a)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(a.GameID) == "" {
+		return nil, errors.New("gameId required")
+	}
+	return fetchESPNGameDetails(ctx, path, sport, a.GameID)
+}
+
+func toolOdds(ctx context.Context, a toolArgs) (any, error) {
+	d, err := toolGameDetails(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	g := d.(GameDetailsDTO)
+	return map[string]any{"gameId": g.ID, "home": g.Home.Name, "away": g.Away.Name, "odds": g.Odds}, nil
+}
+
+func toolTeamResults(ctx context.Context, a toolArgs) (any, error) {
+	path, _, err := toolSportPath(a)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(a.Team) == "" {
+		return nil, errors.New("team required")
+	}
+	limit := a.Limit
+	if limit < 1 || limit > 10 {
+		limit = 5
+	}
+	return fetchESPNTeamResults(ctx, path, a.Team, limit)
+}
+
+/* ---------------- Loop ---------------- */
+
+type toolLoopConfig struct {
+	MaxSteps    int           // LLM round-trips that may request tools
+	ToolTimeout time.Duration // per tool call
+	Deadline    time.Duration // whole loop, including the final answer
+}
+
+func envInt(k string, def int) int {
+	if v := strings.TrimSpace(os.Getenv(k)); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return def
+}
+
+func loadToolLoopConfig() toolLoopConfig {
+	return toolLoopConfig{
+		MaxSteps:    envInt("TOOL_MAX_STEPS", 6),
+		ToolTimeout: time.Duration(envInt("TOOL_TIMEOUT_SEC", 10)) * time.Second,
+		Deadline:    time.Duration(envInt("TOOL_LOOP_DEADLINE_SEC", 180)) * time.Second,
+	}
+}
+
+// toolsEnabled reports whether a generation request should run the tool loop:
+// the request's useTools flag when present, else GENERATE_TOOLS=true.
+func toolsEnabled(f GenerateFilters) bool {
+	if f.UseTools != nil {
+		return *f.UseTools
+	}
+	return strings.ToLower(os.Getenv("GENERATE_TOOLS")) == "true"
+}
+
+// Appended to the prompt when tools are available.
+const toolPromptAddendum = "\nTools: you may call list_games, get_game_details, get_odds and get_team_recent_results before answering. " +
+	"Prefer their data (start times, prices, injuries, recent form) over memory, use real game ids, and only answer with the final JSON once done.\n"
+
+// runToolLoop drives the conversation until the LLM answers without tool calls,
+// or the step budget runs out, in which case one last call is made with tools
+// disabled to force an answer. Passing the deadline ends the loop with an
+// error instead. Returns the final content and the transcript of tool calls.
+func runToolLoop(parent context.Context, prompt string, cfg toolLoopConfig) (string, []toolStep, int, error) {
+	ctx, cancel := context.WithTimeout(parent, cfg.Deadline)
+	defer cancel()
+
+	tools := make([]openAITool, 0, len(llmTools))
+	for _, t := range llmTools {
+		var ot openAITool
+		ot.Type = "function"
+		ot.Function.Name = t.Name
+		ot.Function.Description = t.Description
+		ot.Function.Parameters = t.Parameters
+		tools = append(tools, ot)
+	}
+
+	messages := []openAIMessage{
+		{Role: "system", Content: jsonOnlySystemPrompt},
+		{Role: "user", Content: prompt + toolPromptAddendum},
+	}
+	transcript := make([]toolStep, 0)
+
+	for step := 1; step <= cfg.MaxSteps && ctx.Err() == nil; step++ {
+		msg, status, err := openAIChatCompletion(ctx, openAIChatReq{Messages: messages, Tools: tools, ToolChoice: "auto"})
+		if err != nil {
+			return "", transcript, status, err
+		}
+		if len(msg.ToolCalls) == 0 {
+			return strings.TrimSpace(msg.Content), transcript, http.StatusOK, nil
+		}
+
+		messages = append(messages, openAIMessage{Role: "assistant", Content: msg.Content, ToolCalls: msg.ToolCalls})
+		for _, call := range msg.ToolCalls {
+			st := runToolCall(ctx, step, call, cfg.ToolTimeout)
+			transcript = append(transcript, st)
+			content := st.Result
+			if st.Error != "" {
+				content = `{"error":` + strconv.Quote(st.Error) + `}`
+			}
+			messages = append(messages, openAIMessage{Role: "tool", ToolCallID: call.ID, Content: content})
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", transcript, statusForUpstream(err), err
+	}
+	log.Printf("[generate-slip] tool loop budget exhausted after %d call(s); forcing final answer", len(transcript))
+	messages = append(messages, openAIMessage{Role: "user", Content: "Tool budget exhausted. Answer now with the final JSON only."})
+	msg, status, err := openAIChatCompletion(ctx, openAIChatReq{Messages: messages, Tools: tools, ToolChoice: "none"})
+	if err != nil {
+		return "", transcript, status, err
+	}
+	return strings.TrimSpace(msg.Content), transcript, http.StatusOK, nil
+}
+
+func runToolCall(parent context.Context, step int, call openAIToolCall, timeout time.Duration) toolStep {
+	st := toolStep{Step: step, Tool: call.Function.Name, Arguments: call.Function.Arguments}
+	started := time.Now()
+
+	tool, ok := findTool(call.Function.Name)
+	if !ok {
+		st.Error = "unknown tool"
+		st.DurationMs = time.Since(started).Milliseconds()
+		return st
+	}
+	var args toolArgs
+	if strings.TrimSpace(call.Function.Arguments) != "" {
+		if err := json.Unmarshal([]byte(call.Function.Arguments), &args); err != nil {
+			st.Error = "invalid arguments: " + err.Error()
+			st.DurationMs = time.Since(started).Milliseconds()
+			return st
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	defer cancel()
+	out, err := tool.Run(ctx, args)
+	st.DurationMs = time.Since(started).Milliseconds()
+	if err != nil {
+		st.Error = err.Error()
+		return st
+	}
+	b, _ := json.Marshal(out)
+	st.Result = truncateToolResult(b)
+	return st
+}
+
+// truncateToolResult returns b unchanged when it fits in toolResultLimit.
+// Otherwise it keeps a prefix, cut on a rune boundary, inside a JSON envelope
+// so the LLM and the transcript still get valid JSON:
+// {"truncated":true,"bytes":<full size>,"partial":"<prefix>"}.
+func truncateToolResult(b []byte) string {
+	if len(b) <= toolResultLimit {
+		return string(b)
+	}
+	type envelope struct {
+		Truncated bool   `json:"truncated"`
+		Bytes     int    `json:"bytes"`
+		Partial   string `json:"partial"`
+	}
+	cut := toolResultLimit
+	for {
+		for cut > 0 && !utf8.RuneStart(b[cut]) {
+			cut--
+		}
+		out, _ := json.Marshal(envelope{Truncated: true, Bytes: len(b), Partial: string(b[:cut])})
+		if len(out) <= toolResultLimit || cut == 0 {
+			return string(out)
+		}
+		// escaping grew the prefix; shrink by the overflow and retry
+		cut -= len(out) - toolResultLimit
+		if cut < 0 {
+			cut = 0
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateToolResult(t *testing.T) {
+	small := `{"games":[]}`
+	if got := truncateToolResult([]byte(small)); got != small {
+		t.Errorf("small result changed: %q", got)
+	}
+
+	// multi-byte runes and quotes that grow when escaped
+	big, _ := json.Marshal(map[string]string{"notes": strings.Repeat(`é"ü`, toolResultLimit)})
+	got := truncateToolResult(big)
+	if len(got) > toolResultLimit {
+		t.Errorf("truncated result is %d bytes, over %d", len(got), toolResultLimit)
+	}
+	if !utf8.ValidString(got) {
+		t.Errorf("truncated result is not valid UTF-8")
+	}
+	var env struct {
+		Truncated bool   `json:"truncated"`
+		Bytes     int    `json:"bytes"`
+		Partial   string `json:"partial"`
+	}
+	if err := json.Unmarshal([]byte(got), &env); err != nil {
+		t.Fatalf("truncated result is not JSON: %v", err)
+	}
+	if !env.Truncated || env.Bytes != len(big) || !strings.HasPrefix(string(big), env.Partial) || env.Partial == "" {
+		t.Errorf("envelope: truncated=%v bytes=%d partial %d bytes", env.Truncated, env.Bytes, len(env.Partial))
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"expvar"
 	"log"
 	"net/http"
 	"os"
@@ -34,13 +35,8 @@ func envOr(k, d string) string {
 	return d
 }
 
-func main() {
-	loadDotenv()
-
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		log.Fatal("[DB] DATABASE_URL is not set. Refusing to start.")
-	}
+// connectDB opens Postgres into DB and brings the schema up to date.
+func connectDB(dsn string) {
 	// local only: allow sslmode=disable if using localhost
 	if strings.Contains(dsn, "localhost") && !strings.Contains(dsn, "sslmode=") {
 		if strings.Contains(dsn, "?") {
@@ -69,12 +65,33 @@ func main() {
 
 	log.Println("[DB] running AutoMigrate...")
 
-	if err := DB.AutoMigrate(&User{}, &PastBetRecord{}, &UserModelStat{}); err != nil {
+	if err := DB.AutoMigrate(&User{}, &PastBetRecord{}, &PastBetLeg{}, &UserModelStat{}, &BankrollEntry{}, &Tag{}, &PastBetTag{}, &BetEvent{}); err != nil {
 		log.Fatalf("[DB] auto-migrate failed: %v", err)
 	}
-	
+	if err := migrateLegsOutOfEvent(DB); err != nil {
+		log.Fatalf("[DB] legs migration failed: %v", err)
+	}
+	if err := canonicalizeStoredOdds(DB); err != nil {
+		log.Fatalf("[DB] odds canonicalization failed: %v", err)
+	}
+
 	log.Println("[DB] AutoMigrate complete")
-	
+
+	if err := registerDBMetrics(DB); err != nil {
+		log.Fatalf("[DB] metrics callbacks failed: %v", err)
+	}
+}
+
+func main() {
+	loadDotenv()
+
+	if dsn := os.Getenv("DATABASE_URL"); dsn != "" {
+		connectDB(dsn)
+		store = newPgStore(DB)
+	} else {
+		log.Println("[DB] DATABASE_URL is not set; using the in-memory store (nothing is kept across restarts)")
+	}
+
 	// ---- Router & middleware
 	r := chi.NewRouter()
 
@@ -89,8 +106,8 @@ func main() {
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   origins,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Requested-With"},
-		ExposedHeaders:   []string{"Set-Cookie"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "X-Requested-With", idempotencyHeader},
+		ExposedHeaders:   []string{"Set-Cookie", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -105,24 +122,55 @@ func main() {
 		})
 	})
 
-	// ---- Routes
-	// Auth
-	r.Post("/api/auth/register", handleAuthRegister)
-	r.Post("/api/auth/sign-in", handleAuthSignIn)
-	r.Post("/api/auth/sign-out", handleAuthSignOut)
-	r.Get("/api/auth/me", handleAuthMe)
-	
-	r.Post("/api/auth/demo", handleAuthDemoSignIn)
-
-	// Bets & stats
-	r.Get("/api/past-bets", handlePastBets)
-	r.Post("/api/past-bets", handlePastBets)
-	r.Post("/api/past-bets/result", handlePastBetResult)
-	r.Get("/api/model-stats", handleModelStats)
-	r.Get("/api/games", handleListGames)
+	// ---- Routes (each group's request context carries its deadline)
+	r.Group(func(r chi.Router) {
+		r.Use(withDeadline(deadlineDefault))
+
+		// Auth
+		r.Post("/api/auth/register", handleAuthRegister)
+		r.Post("/api/auth/sign-in", handleAuthSignIn)
+		r.Post("/api/auth/sign-out", handleAuthSignOut)
+		r.Get("/api/auth/me", handleAuthMe)
+
+		r.Post("/api/auth/demo", handleAuthDemoSignIn)
+		r.Post("/api/auth/demo-reset", handleAuthDemoReset)
+
+		// Bets & stats
+		r.Get("/api/past-bets", handlePastBets)
+		r.With(idempotent).Post("/api/past-bets", handlePastBets)
+		r.Post("/api/past-bets/result", handlePastBetResult)
+		r.Post("/api/past-bets/result/bulk", handlePastBetResultBulk)
+		r.With(idempotent).Post("/api/past-bets/import", handlePastBetImport)
+		r.Patch("/api/past-bets/{id}", handlePastBetUpdate)
+		r.Delete("/api/past-bets/{id}", handlePastBetDelete)
+		r.Post("/api/past-bets/{id}/closing", handlePastBetClosing)
+		r.Get("/api/past-bets/{id}/history", handlePastBetHistory)
+		r.Get("/api/model-stats", handleModelStats)
+		r.Get("/api/model-stats/prompt-versions", handlePromptVersionStats)
+		r.Get("/api/model-stats/promos", handlePromoStats)
+		r.Get("/api/model-stats/books", handleBookStats)
+		r.Get("/api/model-stats/tags", handleTagStats)
+		r.Get("/api/tags", handleListTags)
+		r.Delete("/api/tags/{name}", handleDeleteTag)
+		r.Get("/api/sportsbooks", handleListSportsbooks)
+
+		// Bankroll
+		r.Get("/api/bankroll", handleBankroll)
+		r.Get("/api/bankroll/history", handleBankrollHistory)
+		r.Post("/api/bankroll/entries", handleBankrollAddEntry)
+		r.Delete("/api/bankroll/entries/{id}", handleBankrollDeleteEntry)
+		r.Post("/api/stake/suggest", handleSuggestStake)
+	})
+
+	r.With(withDeadline(deadlineGames)).Get("/api/games", handleListGames)
+	r.With(withDeadline(deadlineExport)).Get("/api/past-bets/export", handlePastBetExport)
 
 	// OpenAI: generate slip
-	r.Post("/api/generate-slip", handleGenerateSlip)
+	r.Group(func(r chi.Router) {
+		r.Use(withDeadline(deadlineGenerate))
+		r.With(idempotent).Post("/api/generate-slip", handleGenerateSlip)
+		r.Post("/api/generate-slip/reroll", handleRerollLeg)
+	})
 
 	// Health
 	r.Get("/healthz", func(w http.ResponseWriter, r *http.Request) {
@@ -135,6 +183,18 @@ func main() {
 		Handler:           r,
 		ReadHeaderTimeout: 10 * time.Second,
 	}
+	// Upstream call counters (openai/espn/db by outcome), cmdline and memstats
+	// go on a separate listener that should only be reachable internally.
+	if debugAddr := os.Getenv("DEBUG_ADDR"); debugAddr != "" {
+		go func() {
+			log.Println("debug vars on", debugAddr+"/debug/vars")
+			mux := http.NewServeMux()
+			mux.Handle("/debug/vars", expvar.Handler())
+			dbg := &http.Server{Addr: debugAddr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+			log.Printf("debug listener stopped: %v", dbg.ListenAndServe())
+		}()
+	}
+
 	log.Println("API listening on", addr, "CORS_ORIGIN:", corsOrigin)
 	log.Fatal(srv.ListenAndServe())
 }
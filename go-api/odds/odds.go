@@ -0,0 +1,307 @@
+// Package odds parses, normalizes and converts sportsbook prices.
+//
+// Every price is held as a decimal multiple (stake included), the canonical
+// form used for storage, parlays and settlement. Accepted inputs:
+//
+//	American    "+150", "-110", "150", "EVEN", "EV"
+//	Decimal     "2.50", "1.91"
+//	Fractional  "5/2", "11/10", "evens"
+//	Boosted     "+150 (boosted)", "-110 → +120", "-110 -> +120" (the last price wins)
+package odds
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Price is a sportsbook price as a decimal multiple (> 1).
+type Price struct {
+	Decimal float64
+}
+
+// ErrInvalid is returned for strings that aren't a recognizable price.
+var ErrInvalid = errors.New("odds: unrecognized price")
+
+var (
+	americanRe   = regexp.MustCompile(`^[-+]\d+(?:\.\d+)?$`)
+	integerRe    = regexp.MustCompile(`^\d+$`)
+	decimalRe    = regexp.MustCompile(`^\d+\.\d+$`)
+	fractionalRe = regexp.MustCompile(`^(\d+)\s*/\s*(\d+)$`)
+	boostArrowRe = regexp.MustCompile(`\s*(?:→|->|=>)\s*`)
+	boostNoteRe  = regexp.MustCompile(`(?i)\s*\(?\b(?:boost(?:ed)?|odds boost|profit boost)\b\)?\s*`)
+)
+
+// Parse reads any supported format. boosted reports whether the input was
+// marked as a boosted price; the returned Price is the price actually paid.
+func Parse(s string) (p Price, boosted bool, err error) {
+	s = strings.TrimSpace(s)
+	if boostNoteRe.MatchString(s) {
+		boosted = true
+		s = strings.TrimSpace(boostNoteRe.ReplaceAllString(s, " "))
+	}
+	if parts := boostArrowRe.Split(s, -1); len(parts) > 1 {
+		boosted = true
+		s = strings.TrimSpace(parts[len(parts)-1])
+	}
+	p, err = parsePlain(s)
+	return p, boosted, err
+}
+
+// ParseOK is Parse without the boosted flag; invalid input yields ok=false.
+func ParseOK(s string) (Price, bool) {
+	p, _, err := Parse(s)
+	return p, err == nil
+}
+
+func parsePlain(s string) (Price, error) {
+	switch strings.ToLower(s) {
+	case "":
+		return Price{}, ErrInvalid
+	case "even", "evens", "ev", "evs":
+		return Price{Decimal: 2}, nil
+	}
+	switch {
+	case americanRe.MatchString(s):
+		v, _ := strconv.ParseFloat(s, 64)
+		return FromAmerican(v)
+	case fractionalRe.MatchString(s):
+		m := fractionalRe.FindStringSubmatch(s)
+		num, _ := strconv.ParseFloat(m[1], 64)
+		den, _ := strconv.ParseFloat(m[2], 64)
+		if den == 0 || num == 0 {
+			return Price{}, ErrInvalid
+		}
+		return Price{Decimal: 1 + num/den}, nil
+	case decimalRe.MatchString(s):
+		v, _ := strconv.ParseFloat(s, 64)
+		return FromDecimal(v)
+	case integerRe.MatchString(s):
+		// Unsigned integers: 100+ reads as American ("150" = +150), smaller as decimal ("3" = 3.00).
+		v, _ := strconv.ParseFloat(s, 64)
+		if v >= 100 {
+			return FromAmerican(v)
+		}
+		return FromDecimal(v)
+	}
+	return Price{}, ErrInvalid
+}
+
+// FromAmerican converts an American price (|v| >= 100).
+func FromAmerican(v float64) (Price, error) {
+	switch {
+	case v >= 100:
+		return Price{Decimal: 1 + v/100}, nil
+	case v <= -100:
+		return Price{Decimal: 1 + 100/-v}, nil
+	}
+	return Price{}, ErrInvalid
+}
+
+// FromDecimal validates a decimal multiple.
+func FromDecimal(v float64) (Price, error) {
+	if v <= 1 || math.IsInf(v, 0) || math.IsNaN(v) {
+		return Price{}, ErrInvalid
+	}
+	return Price{Decimal: v}, nil
+}
+
+// Valid reports whether p holds a usable price.
+func (p Price) Valid() bool { return p.Decimal > 1 }
+
+// Profit is the net return per unit staked on a win.
+func (p Price) Profit() float64 { return p.Decimal - 1 }
+
+// ImpliedProb is the break-even win probability (vig included).
+func (p Price) ImpliedProb() float64 {
+	if !p.Valid() {
+		return 0
+	}
+	return 1 / p.Decimal
+}
+
+// AmericanValue is the signed American number, rounded to the nearest integer.
+func (p Price) AmericanValue() int {
+	if !p.Valid() {
+		return 0
+	}
+	if p.Decimal >= 2 {
+		return int(math.Round((p.Decimal - 1) * 100))
+	}
+	return -int(math.Round(100 / (p.Decimal - 1)))
+}
+
+// American renders the canonical string form: "+150", "-110", "+100" for even money.
+func (p Price) American() string {
+	if !p.Valid() {
+		return ""
+	}
+	v := p.AmericanValue()
+	if v > 0 {
+		return fmt.Sprintf("+%d", v)
+	}
+	return strconv.Itoa(v)
+}
+
+// DecimalString renders the decimal multiple with two places ("2.50").
+func (p Price) DecimalString() string {
+	if !p.Valid() {
+		return ""
+	}
+	return strconv.FormatFloat(p.Decimal, 'f', 2, 64)
+}
+
+// Fractional renders the closest fraction with a denominator up to 100 ("5/2", "10/11").
+func (p Price) Fractional() string {
+	if !p.Valid() {
+		return ""
+	}
+	x := p.Decimal - 1
+	bestN, bestD, bestErr := 0, 1, math.Inf(1)
+	for d := 1; d <= 100; d++ {
+		n := int(math.Round(x * float64(d)))
+		if n <= 0 {
+			continue
+		}
+		if e := math.Abs(x - float64(n)/float64(d)); e < bestErr-1e-12 {
+			bestN, bestD, bestErr = n, d, e
+		}
+	}
+	if bestN == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d/%d", bestN, bestD)
+}
+
+// Parlay combines legs into one price. Invalid legs make the result invalid.
+func Parlay(legs ...Price) Price {
+	if len(legs) == 0 {
+		return Price{}
+	}
+	m := 1.0
+	for _, l := range legs {
+		if !l.Valid() {
+			return Price{}
+		}
+		m *= l.Decimal
+	}
+	return Price{Decimal: m}
+}
+
+// WithProfitBoost raises the profit portion by pct percent
+// (+100 with a 50% boost pays +150).
+func (p Price) WithProfitBoost(pct float64) Price {
+	if !p.Valid() || pct <= 0 {
+		return p
+	}
+	return Price{Decimal: 1 + p.Profit()*(1+pct/100)}
+}
+
+/* ---------------- Settlement ---------------- */
+
+// Promo kinds. Boosts raise the winnings; a bonus bet's stake isn't the
+// bettor's money (and isn't returned on a win); no-sweat refunds a loss as a
+// bonus bet.
+const (
+	PromoNone        = ""
+	PromoProfitBoost = "profit_boost" // profit × (1 + BoostPct/100)
+	PromoOddsBoost   = "odds_boost"   // decimal price × (1 + BoostPct/100)
+	PromoBonusBet    = "bonus_bet"    // stake not returned; a loss costs nothing
+	PromoNoSweat     = "no_sweat"     // a loss is refunded as a bonus bet worth NoSweatValue
+)
+
+// Promo describes how a bet was placed beyond its plain price.
+type Promo struct {
+	Kind     string
+	BoostPct float64 // boosts only
+	// MaxExtra caps the winnings a boost adds, per bet (0 = uncapped), in
+	// the same unit as the stake.
+	MaxExtra float64
+	// NoSweatValue is the cash value of the refund as a share of the stake
+	// (0 => DefaultNoSweatValue).
+	NoSweatValue float64
+}
+
+// DefaultNoSweatValue is the cash value assumed for a bonus-bet refund
+// (bonus bets don't return their stake, so they're worth less than cash).
+const DefaultNoSweatValue = 0.7
+
+// NormPromoKind canonicalizes a promo kind; ok is false for unknown values.
+func NormPromoKind(s string) (string, bool) {
+	s = strings.NewReplacer("-", "_", " ", "_").Replace(strings.ToLower(strings.TrimSpace(s)))
+	switch s {
+	case "", "none":
+		return PromoNone, true
+	case "profit_boost", "profit":
+		return PromoProfitBoost, true
+	case "odds_boost", "odds", "boost":
+		return PromoOddsBoost, true
+	case "bonus_bet", "bonus", "free_bet", "stake_not_returned", "snr":
+		return PromoBonusBet, true
+	case "no_sweat", "nosweat", "refund":
+		return PromoNoSweat, true
+	}
+	return "", false
+}
+
+// Units returns the profit/loss in units for a price-settled outcome:
+//   - win pays the profit plus any (capped) boost; half-win pays it on half the stake;
+//   - loss costs the stake (nothing for a bonus bet, less the refund value
+//     for no-sweat); half-loss costs half of it;
+//   - push, void and anything else return 0.
+func Units(p Price, stake float64, outcome string, promo Promo) float64 {
+	switch strings.ToLower(strings.TrimSpace(outcome)) {
+	case "win":
+		return winUnits(p, stake, promo)
+	case "half-win":
+		return winUnits(p, stake/2, promo)
+	case "loss":
+		return lossUnits(stake, promo)
+	case "half-loss":
+		return lossUnits(stake/2, promo)
+	}
+	return 0
+}
+
+// PromoUnits is what the promo added to (or, never, took from) the plain result.
+func PromoUnits(p Price, stake float64, outcome string, promo Promo) float64 {
+	return Units(p, stake, outcome, promo) - Units(p, stake, outcome, Promo{})
+}
+
+func winUnits(p Price, stake float64, promo Promo) float64 {
+	if !p.Valid() {
+		return 0
+	}
+	base := p.Profit() * stake
+	var boosted float64
+	switch promo.Kind {
+	case PromoProfitBoost:
+		boosted = p.WithProfitBoost(promo.BoostPct).Profit() * stake
+	case PromoOddsBoost:
+		boosted = (p.Decimal*(1+math.Max(promo.BoostPct, 0)/100) - 1) * stake
+	default:
+		return base
+	}
+	extra := boosted - base
+	if promo.MaxExtra > 0 && extra > promo.MaxExtra {
+		extra = promo.MaxExtra
+	}
+	return base + extra
+}
+
+func lossUnits(stake float64, promo Promo) float64 {
+	switch promo.Kind {
+	case PromoBonusBet:
+		return 0
+	case PromoNoSweat:
+		v := promo.NoSweatValue
+		if v <= 0 {
+			v = DefaultNoSweatValue
+		}
+		return -stake * (1 - math.Min(v, 1))
+	}
+	return -stake
+}
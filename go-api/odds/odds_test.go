@@ -0,0 +1,230 @@
+package odds
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		dec     float64
+		boosted bool
+	}{
+		// American
+		{"+150", 2.5, false},
+		{"-110", 1 + 100.0/110, false},
+		{"150", 2.5, false},
+		{"+100", 2, false},
+		{"-100", 2, false},
+		{" -200 ", 1.5, false},
+		{"EVEN", 2, false},
+		{"ev", 2, false},
+		// decimal
+		{"2.50", 2.5, false},
+		{"1.91", 1.91, false},
+		{"3", 3, false},
+		// fractional
+		{"5/2", 3.5, false},
+		{"11/10", 2.1, false},
+		{"1 / 4", 1.25, false},
+		{"evens", 2, false},
+		// boosted: the last price is the one paid
+		{"+150 (boosted)", 2.5, true},
+		{"Odds Boost +200", 3, true},
+		{"-110 → +120", 2.2, true},
+		{"-110 -> +120", 2.2, true},
+		{"5/4 => 6/4", 2.5, true},
+	}
+	for _, tt := range tests {
+		p, boosted, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !near(p.Decimal, tt.dec) || boosted != tt.boosted {
+			t.Errorf("Parse(%q) = %v boosted=%v, want %v boosted=%v", tt.in, p.Decimal, boosted, tt.dec, tt.boosted)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{"", "abc", "+50", "-99", "1.00", "0.5", "1", "0/5", "5/0", "+", "2.5.1", "boosted"} {
+		if p, _, err := Parse(in); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Parse(%q) = %v, %v; want ErrInvalid", in, p.Decimal, err)
+		}
+		if _, ok := ParseOK(in); ok {
+			t.Errorf("ParseOK(%q) = ok", in)
+		}
+	}
+}
+
+func TestFormats(t *testing.T) {
+	tests := []struct {
+		in                      string
+		american, decimal, frac string
+		implied                 float64
+	}{
+		{"+150", "+150", "2.50", "3/2", 0.4},
+		{"-110", "-110", "1.91", "10/11", 110.0 / 210},
+		{"EVEN", "+100", "2.00", "1/1", 0.5},
+		{"-250", "-250", "1.40", "2/5", 250.0 / 350},
+		{"1.91", "-110", "1.91", "91/100", 1 / 1.91},
+		{"11/4", "+275", "3.75", "11/4", 4.0 / 15},
+	}
+	for _, tt := range tests {
+		p, ok := ParseOK(tt.in)
+		if !ok {
+			t.Fatalf("ParseOK(%q) failed", tt.in)
+		}
+		if p.American() != tt.american || p.DecimalString() != tt.decimal || p.Fractional() != tt.frac {
+			t.Errorf("%q: got %s / %s / %s, want %s / %s / %s",
+				tt.in, p.American(), p.DecimalString(), p.Fractional(), tt.american, tt.decimal, tt.frac)
+		}
+		if !near(p.ImpliedProb(), tt.implied) {
+			t.Errorf("%q: implied %v, want %v", tt.in, p.ImpliedProb(), tt.implied)
+		}
+	}
+
+	var zero Price
+	if zero.Valid() || zero.American() != "" || zero.DecimalString() != "" || zero.Fractional() != "" || zero.ImpliedProb() != 0 {
+		t.Errorf("zero Price should render empty and be invalid")
+	}
+}
+
+// Every American price survives a trip through decimal and fractional form.
+func TestRoundTrip(t *testing.T) {
+	for v := -1000; v <= 1000; v += 5 {
+		if v > -100 && v < 100 {
+			continue
+		}
+		p, err := FromAmerican(float64(v))
+		if err != nil {
+			t.Fatalf("FromAmerican(%d): %v", v, err)
+		}
+		if got := p.AmericanValue(); got != v && !(v == -100 && got == 100) {
+			t.Errorf("FromAmerican(%d).AmericanValue() = %d", v, got)
+		}
+		back, ok := ParseOK(p.American())
+		if !ok || !near(back.Decimal, p.Decimal) {
+			t.Errorf("%d: American %q parsed back to %v", v, p.American(), back.Decimal)
+		}
+		if frac, ok := ParseOK(p.Fractional()); !ok || math.Abs(frac.Decimal-p.Decimal) > 0.01 {
+			t.Errorf("%d: fractional %q parsed back to %v, want ~%v", v, p.Fractional(), frac.Decimal, p.Decimal)
+		}
+	}
+}
+
+func TestParlay(t *testing.T) {
+	a, _ := ParseOK("-110")
+	b, _ := ParseOK("+120")
+	c, _ := ParseOK("2.0")
+	if got := Parlay(a, b); !near(got.Decimal, a.Decimal*2.2) || got.American() != "+320" {
+		t.Errorf("Parlay(-110, +120) = %v (%s)", got.Decimal, got.American())
+	}
+	if got := Parlay(a, b, c); !near(got.Decimal, a.Decimal*2.2*2) {
+		t.Errorf("Parlay of three = %v", got.Decimal)
+	}
+	if got := Parlay(b); got != b {
+		t.Errorf("Parlay of one = %v, want %v", got, b)
+	}
+	if Parlay().Valid() || Parlay(a, Price{}).Valid() {
+		t.Errorf("Parlay with no or invalid legs should be invalid")
+	}
+}
+
+func TestWithProfitBoost(t *testing.T) {
+	tests := []struct {
+		in   string
+		pct  float64
+		want string
+	}{
+		{"+100", 50, "+150"},
+		{"+200", 25, "+250"},
+		{"-200", 100, "+100"},
+		{"+150", 0, "+150"},
+		{"+150", -10, "+150"},
+	}
+	for _, tt := range tests {
+		p, _ := ParseOK(tt.in)
+		if got := p.WithProfitBoost(tt.pct).American(); got != tt.want {
+			t.Errorf("%s boosted %v%% = %s, want %s", tt.in, tt.pct, got, tt.want)
+		}
+	}
+	if (Price{}).WithProfitBoost(50).Valid() {
+		t.Errorf("boosting an invalid price should stay invalid")
+	}
+}
+
+func TestNormPromoKind(t *testing.T) {
+	tests := map[string]string{
+		"": PromoNone, "None": PromoNone,
+		"Profit Boost": PromoProfitBoost, "odds-boost": PromoOddsBoost, "boost": PromoOddsBoost,
+		"free bet": PromoBonusBet, "SNR": PromoBonusBet, "no sweat": PromoNoSweat, "refund": PromoNoSweat,
+	}
+	for in, want := range tests {
+		if got, ok := NormPromoKind(in); !ok || got != want {
+			t.Errorf("NormPromoKind(%q) = %q, %v; want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := NormPromoKind("cashback"); ok {
+		t.Errorf("NormPromoKind(cashback) should be unknown")
+	}
+}
+
+func TestUnits(t *testing.T) {
+	plus150, _ := ParseOK("+150")
+	minus110, _ := ParseOK("-110")
+	tests := []struct {
+		name    string
+		p       Price
+		stake   float64
+		outcome string
+		promo   Promo
+		want    float64
+	}{
+		{"win", plus150, 2, "win", Promo{}, 3},
+		{"win favorite", minus110, 1.1, "win", Promo{}, 1},
+		{"win case and spaces", plus150, 1, " WIN ", Promo{}, 1.5},
+		{"half-win", plus150, 2, "half-win", Promo{}, 1.5},
+		{"loss", plus150, 2, "loss", Promo{}, -2},
+		{"half-loss", plus150, 2, "half-loss", Promo{}, -1},
+		{"push", plus150, 2, "push", Promo{}, 0},
+		{"void", plus150, 2, "void", Promo{}, 0},
+		{"pending", plus150, 2, "", Promo{}, 0},
+		{"win with invalid price", Price{}, 2, "win", Promo{}, 0},
+
+		{"profit boost win", plus150, 2, "win", Promo{Kind: PromoProfitBoost, BoostPct: 50}, 4.5},
+		{"profit boost capped", plus150, 2, "win", Promo{Kind: PromoProfitBoost, BoostPct: 50, MaxExtra: 1}, 4},
+		{"profit boost loss", plus150, 2, "loss", Promo{Kind: PromoProfitBoost, BoostPct: 50}, -2},
+		{"odds boost win", plus150, 2, "win", Promo{Kind: PromoOddsBoost, BoostPct: 20}, 4},
+		{"odds boost half-win", plus150, 2, "half-win", Promo{Kind: PromoOddsBoost, BoostPct: 20}, 2},
+		{"bonus bet win", plus150, 2, "win", Promo{Kind: PromoBonusBet}, 3},
+		{"bonus bet loss", plus150, 2, "loss", Promo{Kind: PromoBonusBet}, 0},
+		{"no-sweat loss default", plus150, 10, "loss", Promo{Kind: PromoNoSweat}, -3},
+		{"no-sweat loss custom", plus150, 10, "loss", Promo{Kind: PromoNoSweat, NoSweatValue: 0.5}, -5},
+		{"no-sweat loss full value", plus150, 10, "loss", Promo{Kind: PromoNoSweat, NoSweatValue: 2}, 0},
+		{"no-sweat half-loss", plus150, 10, "half-loss", Promo{Kind: PromoNoSweat}, -1.5},
+	}
+	for _, tt := range tests {
+		if got := Units(tt.p, tt.stake, tt.outcome, tt.promo); !near(got, tt.want) {
+			t.Errorf("%s: Units = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPromoUnits(t *testing.T) {
+	p, _ := ParseOK("+100")
+	if got := PromoUnits(p, 1, "win", Promo{Kind: PromoProfitBoost, BoostPct: 25}); !near(got, 0.25) {
+		t.Errorf("boosted win adds %v, want 0.25", got)
+	}
+	if got := PromoUnits(p, 1, "loss", Promo{Kind: PromoBonusBet}); !near(got, 1) {
+		t.Errorf("bonus bet loss saves %v, want 1", got)
+	}
+	if got := PromoUnits(p, 1, "push", Promo{Kind: PromoNoSweat}); got != 0 {
+		t.Errorf("push with a promo adds %v, want 0", got)
+	}
+}
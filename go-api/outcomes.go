@@ -0,0 +1,65 @@
+package main
+
+import "strings"
+
+/* ===================== Bet outcomes ====================== */
+
+// Bet-level results accepted on /api/past-bets/result ("" = ungraded):
+//
+//	win, loss, push     plain settlement
+//	void                cancelled by the book, stake returned
+//	half-win, half-loss Asian lines: half the stake wins/loses, half is returned
+//	cashout             settled early by the user for a returned amount
+//	partial             settled early by the book for a returned amount
+var betOutcomes = []string{"win", "loss", "push", "void", "half-win", "half-loss", "cashout", "partial"}
+
+// normOutcome canonicalizes a bet result; ok is false for unknown values.
+func normOutcome(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer("_", "-", " ", "-").Replace(s)
+	switch s {
+	case "":
+		return "", true
+	case "cash-out", "cashed-out":
+		return "cashout", true
+	case "halfwin":
+		return "half-win", true
+	case "halfloss":
+		return "half-loss", true
+	}
+	for _, o := range betOutcomes {
+		if s == o {
+			return s, true
+		}
+	}
+	return "", false
+}
+
+// needsReturnAmount reports outcomes whose units come from the amount the
+// book paid back rather than from the price.
+func needsReturnAmount(outcome string) bool {
+	return outcome == "cashout" || outcome == "partial"
+}
+
+// tallyOf maps a result onto the W/L/P columns of the stats tables. Half
+// results count toward their side; cash-outs and early settlements count by
+// whether they made or lost money. Ungraded bets map to "".
+func tallyOf(outcome string, units float64) string {
+	switch outcome {
+	case "win", "half-win":
+		return "win"
+	case "loss", "half-loss":
+		return "loss"
+	case "push", "void":
+		return "push"
+	case "cashout", "partial":
+		switch {
+		case units > 0:
+			return "win"
+		case units < 0:
+			return "loss"
+		}
+		return "push"
+	}
+	return ""
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/* ===================== DB model: one row per leg ====================== */
+
+type PastBetLeg struct {
+	ID          string  `gorm:"primaryKey;type:text"`
+	BetID       string  `gorm:"index:idx_leg_bet_pos,unique,priority:1;type:text;not null"`
+	UserKey     string  `gorm:"index;type:text;not null"` // denormalized for per-user leg queries
+	Position    int     `gorm:"index:idx_leg_bet_pos,unique,priority:2;not null"`
+	Team        string  `gorm:"type:text;not null;default:''"`
+	Player      string  `gorm:"type:text;not null;default:''"`
+	Market      string  `gorm:"type:text;not null;default:''"`
+	Line        string  `gorm:"type:text;not null;default:''"`
+	Odds        string  `gorm:"type:text;not null;default:''"` // canonical American (see canonicalOdds)
+	OddsDecimal float64 `gorm:"not null;default:0"`
+	Result      *string // "win"|"loss"|"push"|"void"|nil
+	GameID      string  `gorm:"index;type:text;not null;default:''"`
+
+	ClosingOdds    string  `gorm:"type:text;not null;default:''"`
+	ClosingDecimal float64 `gorm:"not null;default:0"`
+	ClosingSource  string  `gorm:"type:text;not null;default:''"` // manual | espn:<provider>
+
+	OddsUnparsed bool `gorm:"not null;default:false"` // see canonicalizeStoredOdds
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+}
+
+/* ===================== Conversions ====================== */
+
+func legRecordsFromPublic(betID, userKey string, legs []BetLeg) []PastBetLeg {
+	out := make([]PastBetLeg, 0, len(legs))
+	for i, lg := range legs {
+		price, dec := canonicalOdds(lg.Odds)
+		closing, closingDec := canonicalOdds(lg.ClosingOdds)
+		source := ""
+		if closing != "" {
+			source = closingManual
+		}
+		out = append(out, PastBetLeg{
+			ID:          newID(),
+			BetID:       betID,
+			UserKey:     userKey,
+			Position:    i,
+			Team:        strings.TrimSpace(lg.Team),
+			Player:      strings.TrimSpace(lg.Player),
+			Market:      strings.TrimSpace(lg.Market),
+			Line:        strings.TrimSpace(lg.Line),
+			Odds:        price,
+			OddsDecimal: dec,
+			Result:      lg.Result,
+			GameID:      strings.TrimSpace(lg.GameID),
+
+			ClosingOdds:    closing,
+			ClosingDecimal: closingDec,
+			ClosingSource:  source,
+		})
+	}
+	return out
+}
+
+func legToPublic(l PastBetLeg) BetLeg {
+	return BetLeg{
+		ID:     l.ID,
+		Team:   l.Team,
+		Player: l.Player,
+		Market: l.Market,
+		Line:   l.Line,
+		Odds:   l.Odds,
+		GameID: l.GameID,
+		Result: l.Result,
+
+		ClosingOdds: l.ClosingOdds,
+	}
+}
+
+// loadLegs fetches the legs of the given bets, grouped by bet id, in position order.
+func loadLegs(db *gorm.DB, betIDs []string) (map[string][]PastBetLeg, error) {
+	out := map[string][]PastBetLeg{}
+	if len(betIDs) == 0 {
+		return out, nil
+	}
+	var rows []PastBetLeg
+	if err := db.Where("bet_id IN ?", betIDs).Order("bet_id, position").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, l := range rows {
+		out[l.BetID] = append(out[l.BetID], l)
+	}
+	return out, nil
+}
+
+// loadBetRows attaches legs and tags to records, one query each.
+func loadBetRows(db *gorm.DB, recs []PastBetRecord) ([]betRow, error) {
+	ids := make([]string, 0, len(recs))
+	for _, rc := range recs {
+		ids = append(ids, rc.ID)
+	}
+	legs, err := loadLegs(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := loadTags(db, ids)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]betRow, 0, len(recs))
+	for _, rc := range recs {
+		out = append(out, betRow{Rec: rc, Legs: legs[rc.ID], Tags: tags[rc.ID]})
+	}
+	return out, nil
+}
+
+/* ===================== Migration: packed Event -> legs table ====================== */
+
+// migrateLegsOutOfEvent moves legs packed into PastBetRecord.Event (after
+// legsMarker) into PastBetLeg rows and strips the payload from Event.
+// Safe to run on every start: migrated rows no longer contain the marker.
+// Rows whose payload doesn't decode are logged and left as they are, so no
+// leg data is thrown away.
+func migrateLegsOutOfEvent(db *gorm.DB) error {
+	const batch = 200
+	total := 0
+	var corrupt []string
+	for {
+		q := db.Where("strpos(event, ?) > 0", legsMarker)
+		if len(corrupt) > 0 {
+			q = q.Where("id NOT IN ?", corrupt)
+		}
+		var recs []PastBetRecord
+		if err := q.Limit(batch).Find(&recs).Error; err != nil {
+			return err
+		}
+		if len(recs) == 0 {
+			break
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, rc := range recs {
+				summary, legs, err := decodePackedEvent(rc.Event)
+				if err != nil {
+					log.Printf("[DB] bet %s: packed legs don't decode, left in place: %v", rc.ID, err)
+					corrupt = append(corrupt, rc.ID)
+					continue
+				}
+				// a previous partial run may have left legs behind
+				if err := tx.Where("bet_id = ?", rc.ID).Delete(&PastBetLeg{}).Error; err != nil {
+					return err
+				}
+				if rows := legRecordsFromPublic(rc.ID, rc.UserKey, legs); len(rows) > 0 {
+					if err := tx.Create(&rows).Error; err != nil {
+						return err
+					}
+				}
+				if err := tx.Model(&PastBetRecord{}).Where("id = ?", rc.ID).
+					UpdateColumn("event", summary).Error; err != nil {
+					return err
+				}
+				total++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if total > 0 {
+		log.Printf("[DB] migrated legs out of %d packed event(s)", total)
+	}
+	return nil
+}
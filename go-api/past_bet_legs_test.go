@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestDecodePackedEvent(t *testing.T) {
+	summary, legs, err := decodePackedEvent("Lakers @ Celtics" + legsMarker + `[{"team":"Lakers","market":"ML"}]`)
+	if err != nil || summary != "Lakers @ Celtics" || len(legs) != 1 || legs[0].Team != "Lakers" {
+		t.Errorf("packed: %q %+v %v", summary, legs, err)
+	}
+	if summary, legs, err := decodePackedEvent("Lakers @ Celtics"); err != nil || summary != "Lakers @ Celtics" || legs != nil {
+		t.Errorf("unpacked: %q %+v %v", summary, legs, err)
+	}
+	if _, _, err := decodePackedEvent("Lakers @ Celtics" + legsMarker + `[{"team":`); err == nil {
+		t.Errorf("corrupt payload decoded without an error")
+	}
+	if summary, legs := unpackEvent("Lakers @ Celtics" + legsMarker + `[{"team":`); summary != "Lakers @ Celtics" || legs != nil {
+		t.Errorf("unpackEvent on a corrupt payload: %q %+v", summary, legs)
+	}
+}
@@ -2,63 +2,98 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
 	"net/http"
-	"regexp"
 	"strings"
-	"sync"
 	"time"
 
+	"example.com/go-api/odds"
 	"gorm.io/gorm"
 )
 
 /* ===================== Public JSON (API) ====================== */
 
 type BetLeg struct {
+	ID     string  `json:"id,omitempty"` // PastBetLeg id (server-assigned)
 	Team   string  `json:"team,omitempty"`
 	Player string  `json:"player,omitempty"`
 	Market string  `json:"market"`           // e.g., "PTS", "AST", "ML"
 	Line   string  `json:"line,omitempty"`   // e.g., "25+", "25.5", "+1.5"
-	Odds   string  `json:"odds,omitempty"`   // e.g., "-110", "+140"
-	Result *string `json:"result,omitempty"` // "win"|"loss"|"push"|nil
+	Odds   string  `json:"odds,omitempty"`   // canonical American, e.g., "-110", "+140" (any format accepted on input)
+	GameID string  `json:"gameId,omitempty"` // provider game id (see GameDTO.ID), if known
+	Result *string `json:"result,omitempty"` // "win"|"loss"|"push"|"void"|nil
+
+	ClosingOdds string `json:"closingOdds,omitempty"` // price at the close (see clv.go)
 }
 
 type PastBet struct {
-	ID          string   `json:"id"`
-	Type        string   `json:"type"`  // Single | SGP | SGP+
-	Date        string   `json:"date"`  // ISO 8601
-	Model       string   `json:"model"`
-	Sport       string   `json:"sport"`
-	Event       string   `json:"event"` // human summary
-	Legs        []BetLeg `json:"legs,omitempty"`
-	Odds        string   `json:"odds"`                  // overall/parlay odds (e.g., "+450")
-	Units       float64  `json:"units,omitempty"`       // stake (units)
-	Result      string   `json:"result,omitempty"`      // "win" | "loss" | "push"
-	ResultUnits float64  `json:"resultUnits,omitempty"` // +/- units for this bet
+	ID            string   `json:"id"`
+	Type          string   `json:"type"` // Single | SGP | SGP+
+	Date          string   `json:"date"` // ISO 8601
+	Model         string   `json:"model"`
+	Sport         string   `json:"sport"`
+	Event         string   `json:"event"` // human summary
+	Legs          []BetLeg `json:"legs,omitempty"`
+	Odds          string   `json:"odds"`                    // overall/parlay odds, canonical American (e.g., "+450")
+	OddsDecimal   float64  `json:"oddsDecimal,omitempty"`   // same price as a decimal multiple; 0 if unparseable
+	Units         float64  `json:"units,omitempty"`         // stake (units)
+	Result        string   `json:"result,omitempty"`        // see betOutcomes
+	ResultUnits   float64  `json:"resultUnits,omitempty"`   // +/- units for this bet
+	StakeMoney    *float64 `json:"stakeMoney,omitempty"`    // stake in money at the unit size on Date (see bankroll.go)
+	Sportsbook    string   `json:"sportsbook,omitempty"`    // id from GET /api/sportsbooks
+	PromoType     string   `json:"promoType,omitempty"`     // profit_boost | odds_boost | bonus_bet | no_sweat
+	BoostPct      float64  `json:"boostPct,omitempty"`      // boosts only
+	PromoMaxWin   *float64 `json:"promoMaxWin,omitempty"`   // cap on the winnings a boost adds (units)
+	PromoUnits    float64  `json:"promoUnits,omitempty"`    // units the promo added to this bet's result
+	ResultMoney   *float64 `json:"resultMoney,omitempty"`   // +/- money for this bet
+	PromptVersion string   `json:"promptVersion,omitempty"` // prompt template that generated the slip (if any)
+	ClosingOdds   string   `json:"closingOdds,omitempty"`   // price at the close, canonical American (see clv.go)
+	CLV           *betCLV  `json:"clv,omitempty"`           // nil until both prices are known
+	Tags          []string `json:"tags,omitempty"`          // see tags.go
+	Notes         string   `json:"notes,omitempty"`
+
+	// Tool calls behind a generated slip (see llm_tools.go); sent back on create.
+	ToolTranscript []toolStep `json:"toolTranscript,omitempty"`
 }
 
 /* ===================== DB models ====================== */
 
 type PastBetRecord struct {
-	ID          string    `gorm:"primaryKey;type:text"`
-	UserKey     string    `gorm:"index:idx_past_user_date_created,priority:1;type:text;not null"`
-	Type        string    `gorm:"type:text;not null"` // Single | SGP | SGP+
-	Date        time.Time `gorm:"index:idx_past_user_date_created,priority:2;type:timestamptz;not null"`
-	Model       string    `gorm:"type:text;not null"`
-	Sport       string    `gorm:"type:text;not null"`
-	Event       string    `gorm:"type:text;not null"` // stores summary + packed JSON legs (see helpers)
-	Odds        string    `gorm:"type:text;not null"`
-	Stake       float64   `gorm:"not null;default:1"` // stake in units
-	Result      *string
-	ResultUnits *float64
-	CreatedAt   time.Time `gorm:"index:idx_past_user_date_created,priority:3;autoCreateTime"`
-	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+	ID             string    `gorm:"primaryKey;type:text"`
+	UserKey        string    `gorm:"index:idx_past_user_date_created,priority:1;type:text;not null"`
+	Type           string    `gorm:"type:text;not null"` // Single | SGP | SGP+
+	Date           time.Time `gorm:"index:idx_past_user_date_created,priority:2;type:timestamptz;not null"`
+	Model          string    `gorm:"type:text;not null"`
+	Sport          string    `gorm:"type:text;not null"`
+	Event          string    `gorm:"type:text;not null"` // human summary; legs live in PastBetLeg
+	Odds           string    `gorm:"type:text;not null"` // canonical American when parseable, else as entered
+	OddsDecimal    float64   `gorm:"not null;default:0"` // canonical decimal multiple; 0 = unpriced
+	Stake          float64   `gorm:"not null;default:1"` // stake in units
+	Result         *string
+	ResultUnits    *float64
+	OddsUnparsed   bool      `gorm:"not null;default:false"`              // canonicalizeStoredOdds couldn't parse Odds
+	PromptVersion  string    `gorm:"type:text;not null;default:''"`       // "" for manually logged bets
+	Sportsbook     string    `gorm:"index;type:text;not null;default:''"` // sportsbooks id; "" = unattributed
+	PromoType      string    `gorm:"type:text;not null;default:''"`       // odds.Promo* kind; "" = none
+	BoostPct       float64   `gorm:"not null;default:0"`
+	PromoMaxWin    *float64  // cap on the winnings a boost adds, in units; nil = uncapped
+	ClosingOdds    string    `gorm:"type:text;not null;default:''"`
+	ClosingDecimal float64   `gorm:"not null;default:0"`            // 0 = no closing price
+	ClosingSource  string    `gorm:"type:text;not null;default:''"` // manual | espn:<provider> | "" (derived from legs)
+	Notes          string    `gorm:"type:text;not null;default:''"`
+	ToolTranscript string    `gorm:"type:text;not null;default:''"` // []toolStep JSON; "" for bets not from the tool loop
+	CreatedAt      time.Time `gorm:"index:idx_past_user_date_created,priority:3;autoCreateTime"`
+	UpdatedAt      time.Time `gorm:"autoUpdateTime"`
 }
 
 type UserModelStat struct {
 	ID        uint      `gorm:"primaryKey"`
 	UserKey   string    `gorm:"index:idx_user_model_sport_mode,unique;type:text;not null"`
 	Model     string    `gorm:"index:idx_user_model_sport_mode,unique;type:text;not null"`
-	Sport     string    `gorm:"index:idx_user_model_sport_mode,unique;type:text;not null"`          // NFL/NBA/NHL/MLB or "ALL"
+	Sport     string    `gorm:"index:idx_user_model_sport_mode,unique;type:text;not null"`             // NFL/NBA/NHL/MLB or "ALL"
 	Mode      string    `gorm:"index:idx_user_model_sport_mode,unique;type:text;not null;default:ALL"` // Single | SGP | SGP+ | ALL
 	Wins      int       `gorm:"not null;default:0"`
 	Losses    int       `gorm:"not null;default:0"`
@@ -70,41 +105,41 @@ type UserModelStat struct {
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 }
 
-/* ===================== Packing helpers (no schema change) ====================== */
+/* ===================== Legacy packed legs ====================== */
+// Legs used to be stored as JSON after a delimiter in Event. New rows use
+// PastBetLeg; migrateLegsOutOfEvent converts old rows at startup.
 
 const legsMarker = "\n\n--LEGSJSON--"
 
-// Pack legs as JSON after a delimiter in Event (human summary + machine payload)
-func packEvent(summary string, legs []BetLeg) string {
-	if len(legs) == 0 {
-		return summary
-	}
-	b, _ := json.Marshal(legs)
-	return summary + legsMarker + string(b)
+// Split Event back into (summary, legs). Backward compatible: no marker => no
+// legs; a corrupt payload reads as no legs (see decodePackedEvent).
+func unpackEvent(event string) (summary string, legs []BetLeg) {
+	summary, legs, _ = decodePackedEvent(event)
+	return
 }
 
-// Split Event back into (summary, legs). Backward compatible: no marker => no legs.
-func unpackEvent(event string) (summary string, legs []BetLeg) {
+// decodePackedEvent is unpackEvent that reports a payload it can't decode.
+func decodePackedEvent(event string) (summary string, legs []BetLeg, err error) {
 	idx := strings.Index(event, legsMarker)
 	if idx < 0 {
-		return event, nil
+		return event, nil, nil
 	}
 	summary = event[:idx]
-	_ = json.Unmarshal([]byte(event[idx+len(legsMarker):]), &legs)
-	return
+	if err = json.Unmarshal([]byte(event[idx+len(legsMarker):]), &legs); err != nil {
+		return summary, nil, err
+	}
+	return summary, legs, nil
 }
 
-/* ===================== In-memory fallback ====================== */
-
-var (
-	pastMu     sync.Mutex
-	pastByUser = map[string][]PastBet{} // userKey -> bets (oldest..newest)
-)
-
 /* ===================== Helpers ====================== */
 
-func toPublic(b PastBetRecord) PastBet {
+// toPublic converts a record and its leg rows. Rows not yet migrated
+// (legs still packed in Event) are unpacked on the fly.
+func toPublic(b PastBetRecord, legRows []PastBetLeg) PastBet {
 	summary, legs := unpackEvent(b.Event)
+	for _, l := range legRows {
+		legs = append(legs, legToPublic(l))
+	}
 	out := PastBet{
 		ID:    b.ID,
 		Type:  b.Type,
@@ -115,9 +150,23 @@ func toPublic(b PastBetRecord) PastBet {
 		Legs:  legs,
 		Odds:  b.Odds,
 		Units: b.Stake,
+
+		OddsDecimal:   b.OddsDecimal,
+		PromptVersion: b.PromptVersion,
+		Sportsbook:    b.Sportsbook,
+		PromoType:     b.PromoType,
+		BoostPct:      b.BoostPct,
+		PromoMaxWin:   b.PromoMaxWin,
+		ClosingOdds:   b.ClosingOdds,
+		CLV:           clvOf(b.OddsDecimal, b.ClosingDecimal),
+		Notes:         b.Notes,
+	}
+	if b.ToolTranscript != "" {
+		_ = json.Unmarshal([]byte(b.ToolTranscript), &out.ToolTranscript)
 	}
 	if b.Result != nil {
 		out.Result = *b.Result
+		out.PromoUnits = promoUnitsFor(b)
 	}
 	if b.ResultUnits != nil {
 		out.ResultUnits = *b.ResultUnits
@@ -125,6 +174,32 @@ func toPublic(b PastBetRecord) PastBet {
 	return out
 }
 
+// normBetModel tracks consensus slips under one model name whatever the client sends.
+func normBetModel(m string) string {
+	if l := strings.ToLower(strings.TrimSpace(m)); l == "consensus" || l == "ensemble" {
+		return consensusModel
+	}
+	return m
+}
+
+// normBetType canonicalizes a bet type; "ALL" and unknown types are
+// rejected, since they would count into the ALL stats row twice.
+func normBetType(t string) (string, error) {
+	if t = normMode(t); t == "ALL" {
+		return "", errors.New("type must be Single, SGP or SGP+")
+	}
+	return t, nil
+}
+
+// parseBetDate parses a client-sent bet date.
+func parseBetDate(iso string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, strings.TrimSpace(iso))
+	if err != nil {
+		return time.Time{}, errors.New("date must be RFC 3339, e.g. 2025-01-31T19:00:00Z")
+	}
+	return t, nil
+}
+
 func mustParse(iso string) time.Time {
 	t, err := time.Parse(time.RFC3339, iso)
 	if err != nil {
@@ -136,6 +211,8 @@ func mustParse(iso string) time.Time {
 /* ===================== HTTP: list/create ====================== */
 
 // GET/POST /api/past-bets
+// GET filters: sport, model, type, book, tag (repeatable; all must match), result (pending or any betOutcomes value),
+// from, to, q; paged by limit + cursor.
 func handlePastBets(w http.ResponseWriter, r *http.Request) {
 	userKey := userKeyFromRequest(r)
 	if userKey == "" {
@@ -145,34 +222,23 @@ func handlePastBets(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case http.MethodGet:
-		if DB != nil {
-			var recs []PastBetRecord
-			if err := DB.Where("user_key = ?", userKey).
-				Order("date DESC, created_at DESC").
-				Limit(15).
-				Find(&recs).Error; err != nil {
-				errorJSON(w, http.StatusInternalServerError, "db error")
-				return
-			}
-			out := make([]PastBet, 0, len(recs))
-			for _, rc := range recs {
-				out = append(out, toPublic(rc))
-			}
-			writeJSON(w, http.StatusOK, map[string]any{"bets": out})
+		q, err := parsePastBetQuery(r.URL.Query())
+		if err != nil {
+			errorJSON(w, http.StatusBadRequest, err.Error())
 			return
 		}
-
-		// in-memory fallback (reverse to newest-first)
-		pastMu.Lock()
-		list := append([]PastBet(nil), pastByUser[userKey]...)
-		pastMu.Unlock()
-		for i, j := 0, len(list)-1; i < j; i, j = i+1, j-1 {
-			list[i], list[j] = list[j], list[i]
+		page, err := store.ListBets(r.Context(), userKey, q)
+		if err != nil {
+			errorJSON(w, http.StatusInternalServerError, "db error")
+			return
 		}
-		if len(list) > 15 {
-			list = list[:15]
+		ledger, err := loadLedger(r.Context(), userKey)
+		if err != nil {
+			errorJSON(w, http.StatusInternalServerError, "db error")
+			return
 		}
-		writeJSON(w, http.StatusOK, map[string]any{"bets": list})
+		ledger.withMoney(page.Bets)
+		writeJSON(w, http.StatusOK, page)
 
 	case http.MethodPost:
 		// Accept legs in the public API; store them packed in Event
@@ -184,71 +250,117 @@ func handlePastBets(w http.ResponseWriter, r *http.Request) {
 		if strings.TrimSpace(bet.Date) == "" {
 			bet.Date = time.Now().UTC().Format(time.RFC3339)
 		}
+		date, err := parseBetDate(bet.Date)
+		if err != nil {
+			errorJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if bet.Type, err = normBetType(bet.Type); err != nil {
+			errorJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		bet.Model = normBetModel(bet.Model)
 		// normalize stake
 		stake := bet.Units
 		if stake <= 0 {
 			stake = 1
 		}
-		id := newID()
-
-		if DB != nil {
-			summary := strings.TrimSpace(bet.Event)
-			// if no summary provided but legs exist, auto-build a readable title
-			if summary == "" && len(bet.Legs) > 0 {
-				parts := make([]string, 0, len(bet.Legs))
-				for _, lg := range bet.Legs {
-					title := strings.TrimSpace(strings.Join([]string{
-						firstNonEmpty(lg.Player, lg.Team),
-						lg.Market, lg.Line,
-					}, " "))
-					if lg.Odds != "" {
-						title += " (" + lg.Odds + ")"
-					}
-					if strings.TrimSpace(title) != "" {
-						parts = append(parts, title)
-					}
+		bet.Odds, bet.OddsDecimal = canonicalOdds(bet.Odds)
+		if err := normBetPromo(&bet); err != nil {
+			errorJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		book, ok := normSportsbook(bet.Sportsbook)
+		if !ok {
+			errorJSON(w, http.StatusBadRequest, "unknown sportsbook (see GET /api/sportsbooks)")
+			return
+		}
+		bet.Sportsbook = book
+		tags, err := normTags(bet.Tags)
+		if err != nil {
+			errorJSON(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		bet.Tags = tags
+		bet.Notes = strings.TrimSpace(bet.Notes)
+		for i := range bet.Legs {
+			if lg := &bet.Legs[i]; lg.Result != nil {
+				res, ok := normLegResult(*lg.Result)
+				if !ok {
+					errorJSON(w, http.StatusBadRequest, fmt.Sprintf("leg %d: invalid result %q", i+1, *lg.Result))
+					return
 				}
-				if len(parts) > 0 {
-					summary = strings.Join(parts, " · ")
+				lg.Result = nil
+				if res != "" {
+					lg.Result = &res
 				}
 			}
-
-			rec := PastBetRecord{
-				ID:      id,
-				UserKey: userKey,
-				Type:    bet.Type,
-				Date:    mustParse(bet.Date),
-				Model:   bet.Model,
-				Sport:   bet.Sport,
-				Event:   packEvent(summary, bet.Legs), // <<< key line packs legs
-				Odds:    bet.Odds,
-				Stake:   stake,
-			}
-			if err := DB.Create(&rec).Error; err != nil {
-				errorJSON(w, http.StatusInternalServerError, "db insert error")
-				return
+			bet.Legs[i].Odds, _ = canonicalOdds(bet.Legs[i].Odds)
+			bet.Legs[i].ClosingOdds, _ = canonicalOdds(bet.Legs[i].ClosingOdds)
+		}
+		var closingDec float64
+		bet.ClosingOdds, closingDec = canonicalOdds(bet.ClosingOdds)
+		id := newID()
+		// advisory only: conflicting/redundant legs are still saved
+		findings := detectLegFindings(viewsFromBetLegs(bet.Legs, nil, bet.Event))
+
+		summary := strings.TrimSpace(bet.Event)
+		// if no summary provided but legs exist, auto-build a readable title
+		if summary == "" && len(bet.Legs) > 0 {
+			parts := make([]string, 0, len(bet.Legs))
+			for _, lg := range bet.Legs {
+				title := strings.TrimSpace(strings.Join([]string{
+					firstNonEmpty(lg.Player, lg.Team),
+					lg.Market, lg.Line,
+				}, " "))
+				if lg.Odds != "" {
+					title += " (" + lg.Odds + ")"
+				}
+				if strings.TrimSpace(title) != "" {
+					parts = append(parts, title)
+				}
 			}
-			// keep newest 15 rows per user; delete older
-			if err := trimPastBetsGorm(DB, userKey, 15); err != nil {
-				errorJSON(w, http.StatusInternalServerError, "db trim error")
-				return
+			if len(parts) > 0 {
+				summary = strings.Join(parts, " · ")
 			}
-			// respond with the saved bet (unpacked) for immediate UI usage
-			writeJSON(w, http.StatusOK, map[string]any{"ok": true, "bet": toPublic(rec)})
-			return
 		}
 
-		// in-memory fallback (append; trim to 15)
-		pastMu.Lock()
-		defer pastMu.Unlock()
-		row := bet
-		row.ID = id
-		row.Units = stake // ensure normalized stake
-		pastByUser[userKey] = append(pastByUser[userKey], row)
-		if len(pastByUser[userKey]) > 15 {
-			pastByUser[userKey] = pastByUser[userKey][len(pastByUser[userKey])-15:]
+		rec := PastBetRecord{
+			ID:      id,
+			UserKey: userKey,
+			Type:    bet.Type,
+			Date:    date,
+			Model:   bet.Model,
+			Sport:   bet.Sport,
+			Event:   summary,
+			Odds:    bet.Odds,
+			Stake:   stake,
+
+			OddsDecimal: bet.OddsDecimal,
+
+			PromptVersion: strings.TrimSpace(bet.PromptVersion),
+			Sportsbook:    bet.Sportsbook,
+			PromoType:     bet.PromoType,
+			BoostPct:      bet.BoostPct,
+			PromoMaxWin:   bet.PromoMaxWin,
+			Notes:         bet.Notes,
+		}
+		if rec.ClosingOdds, rec.ClosingDecimal = bet.ClosingOdds, closingDec; rec.ClosingOdds != "" {
+			rec.ClosingSource = closingManual
+		}
+		if len(bet.ToolTranscript) > 0 {
+			b, _ := json.Marshal(bet.ToolTranscript)
+			rec.ToolTranscript = string(b)
+		}
+		legs := legRecordsFromPublic(id, userKey, bet.Legs)
+		deriveClosing(&rec, legs)
+		row := betRow{Rec: rec, Legs: legs, Tags: bet.Tags}
+		if err := store.CreateBets(r.Context(), []betRow{row}); err != nil {
+			errorJSON(w, http.StatusInternalServerError, "db insert error")
+			return
 		}
-		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "bet": row})
+		// respond with the saved bet (legs included) for immediate UI usage
+		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "bet": row.public(), "findings": findings})
 
 	default:
 		errorJSON(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -257,17 +369,21 @@ func handlePastBets(w http.ResponseWriter, r *http.Request) {
 
 /* ===================== HTTP: set result ====================== */
 
-// POST /api/past-bets/result  { "id": "...", "result": "win"|"loss"|"push"|"" }
+// POST /api/past-bets/result
+//
+//	{ "id": "...", "result": "win"|"loss"|"push"|"void"|"half-win"|"half-loss"|"" }
+//	{ "id": "...", "result": "cashout"|"partial", "returnAmount": 1.6 }   early settlement
+//	{ "id": "...", "legs": [{"id"|"index", "result": "win"|"loss"|"push"|"void"|""}] }
+//
+// returnAmount is the total paid back (stake included), in units. With legs,
+// the bet result and units are derived from all leg results (see
+// settleParlay) and any bet-level "result" is ignored.
 func handlePastBetResult(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		errorJSON(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
-	type payload struct {
-		ID     string `json:"id"`
-		Result string `json:"result"`
-	}
-	var p payload
+	var p gradeInput
 	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
 		errorJSON(w, http.StatusBadRequest, "invalid JSON")
 		return
@@ -280,113 +396,250 @@ func handlePastBetResult(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Normalize & validate
-	res := strings.ToLower(strings.TrimSpace(p.Result))
-	switch res {
-	case "win", "loss", "push", "":
-	default:
-		res = ""
+	if _, _, err := p.validate(); err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	if DB != nil {
-		var rec PastBetRecord
-		if err := DB.Where("id = ? AND user_key = ?", p.ID, userKey).First(&rec).Error; err != nil {
-			if err == gorm.ErrRecordNotFound {
-				errorJSON(w, http.StatusNotFound, "not found")
-				return
-			}
-			errorJSON(w, http.StatusInternalServerError, "db error")
-			return
-		}
+	results, err := store.GradeBets(r.Context(), userKey, []gradeInput{p}, false)
+	if errors.Is(err, errRolledBack) {
+		err = results[0].Err
+	}
+	var bad *badRequestError
+	switch {
+	case errors.Is(err, errNotFound):
+		errorJSON(w, http.StatusNotFound, "not found")
+		return
+	case errors.As(err, &bad):
+		errorJSON(w, http.StatusBadRequest, bad.msg)
+		return
+	case err != nil:
+		errorJSON(w, http.StatusInternalServerError, "db update error")
+		return
+	}
 
-		// compute units delta using the stored stake
-		prev := ""
-		if rec.Result != nil {
-			prev = *rec.Result
-		}
-		var prevUnits float64
-		if rec.ResultUnits != nil {
-			prevUnits = *rec.ResultUnits
-		}
-		stake := rec.Stake
-		if stake <= 0 {
-			stake = 1
-		}
-		newUnits := unitsForOutcome(rec.Odds, res, stake)
-
-		// update record
-		if res == "" {
-			rec.Result = nil
-			rec.ResultUnits = nil
-		} else {
-			rec.Result = &res
-			rec.ResultUnits = &newUnits
-		}
-		if err := DB.Save(&rec).Error; err != nil {
-			errorJSON(w, http.StatusInternalServerError, "db update error")
-			return
-		}
+	g := results[0].G
+	out := map[string]any{"ok": true, "bet": g.public()}
+	if g.Warning != "" {
+		out["warning"] = g.Warning
+	}
+	writeJSON(w, http.StatusOK, out)
+}
 
-		// update aggregates: per-mode (rec.Type) and ALL
-		if err := upsertUserModelStat(DB, userKey, rec.Model, rec.Sport, rec.Type, prev, res, prevUnits, newUnits); err != nil {
-			errorJSON(w, http.StatusInternalServerError, "stats update error")
-			return
+// gradeInput is one grading request (see POST /api/past-bets/result).
+type gradeInput struct {
+	ID           string        `json:"id"`
+	Result       string        `json:"result"`
+	ReturnAmount *float64      `json:"returnAmount,omitempty"`
+	Legs         []legResultIn `json:"legs,omitempty"`
+}
+
+// validate normalizes the bet-level result and checks returnAmount.
+func (p gradeInput) validate() (res string, returned float64, err error) {
+	res, ok := normOutcome(p.Result)
+	if !ok && len(p.Legs) == 0 {
+		return "", 0, errors.New("result must be one of " + strings.Join(betOutcomes, ", ") + " or empty")
+	}
+	if needsReturnAmount(res) && len(p.Legs) == 0 {
+		if p.ReturnAmount == nil || *p.ReturnAmount < 0 {
+			return "", 0, errors.New("returnAmount (>= 0) is required for " + res)
 		}
+		returned = *p.ReturnAmount
+	}
+	return res, returned, nil
+}
 
-		writeJSON(w, http.StatusOK, map[string]any{"ok": true, "bet": toPublic(rec)})
-		return
+// graded is a bet after grading, with the transition the stats need.
+type graded struct {
+	betRow
+	Prev, Next string
+	PrevUnits  float64
+	NextUnits  float64
+	Warning    string
+}
+
+// grade applies one grading request to the bet in place and returns the
+// transition the stats need plus the indexes of legs it changed.
+func (b *betRow) grade(p gradeInput, res string, returned float64) (graded, []int, error) {
+	rec := &b.Rec
+	var g graded
+	// compute units delta using the stored stake
+	if rec.Result != nil {
+		g.Prev = *rec.Result
+	}
+	if rec.ResultUnits != nil {
+		g.PrevUnits = *rec.ResultUnits
+	}
+	stake := rec.Stake
+	if stake <= 0 {
+		stake = 1
+	}
+
+	next := res
+	var (
+		newUnits float64
+		changed  []int
+	)
+	if len(p.Legs) > 0 {
+		var err error
+		if changed, err = applyLegResults(b.Legs, p.Legs); err != nil {
+			return g, nil, &badRequestError{err.Error()}
+		}
+		var priced bool
+		next, newUnits, priced = settleParlay(b.Legs, rec.Odds, stake, rec.promo())
+		if !priced {
+			g.Warning = "a winning leg has no usable odds; units not computed"
+		}
+	} else {
+		newUnits = unitsForOutcome(rec.Odds, next, stake, returned, rec.promo())
 	}
 
-	// in-memory fallback
-	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+	// update record
+	if next == "" {
+		rec.Result = nil
+		rec.ResultUnits = nil
+		newUnits = 0
+	} else {
+		rec.Result = &next
+		rec.ResultUnits = &newUnits
+	}
+	g.Next, g.NextUnits = next, newUnits
+	g.betRow = *b
+	return g, changed, nil
 }
 
-/* ===================== DB helpers ====================== */
+// badRequestError carries a client-facing message out of a transaction.
+type badRequestError struct{ msg string }
+
+func (e *badRequestError) Error() string { return e.msg }
 
-func trimPastBetsGorm(db *gorm.DB, userKey string, keep int) error {
-	var ids []string
-	if err := db.Model(&PastBetRecord{}).
-		Where("user_key = ?", userKey).
-		Order("date DESC, created_at DESC").
-		Limit(keep).
-		Pluck("id", &ids).Error; err != nil {
+/* ===================== Odds helpers ====================== */
+
+// canonicalOdds normalizes any supported price format (see package odds) to
+// the stored form: American string plus decimal multiple. Unparseable input
+// is kept as entered with a zero multiple.
+func canonicalOdds(s string) (string, float64) {
+	s = strings.TrimSpace(s)
+	p, ok := odds.ParseOK(s)
+	if !ok {
+		return s, 0
+	}
+	return p.American(), p.Decimal
+}
+
+// canonicalizeStoredOdds rewrites bets and legs saved before odds were
+// canonicalized. Rows whose price can't be parsed keep their text and a zero
+// multiple and are marked OddsUnparsed, so later starts skip them.
+func canonicalizeStoredOdds(db *gorm.DB) error {
+	fixed := 0
+	var bets []PastBetRecord
+	err := db.Where("odds_decimal = 0 AND odds <> '' AND NOT odds_unparsed").FindInBatches(&bets, 200, func(tx *gorm.DB, _ int) error {
+		for _, b := range bets {
+			price, dec := canonicalOdds(b.Odds)
+			if dec == 0 {
+				if err := db.Model(&PastBetRecord{}).Where("id = ?", b.ID).
+					UpdateColumn("odds_unparsed", true).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := db.Model(&PastBetRecord{}).Where("id = ?", b.ID).
+				UpdateColumns(map[string]any{"odds": price, "odds_decimal": dec}).Error; err != nil {
+				return err
+			}
+			fixed++
+		}
+		return nil
+	}).Error
+	if err != nil {
 		return err
 	}
-	if len(ids) == 0 {
+	var legs []PastBetLeg
+	err = db.Where("odds_decimal = 0 AND odds <> '' AND NOT odds_unparsed").FindInBatches(&legs, 500, func(tx *gorm.DB, _ int) error {
+		for _, l := range legs {
+			price, dec := canonicalOdds(l.Odds)
+			if dec == 0 {
+				if err := db.Model(&PastBetLeg{}).Where("id = ?", l.ID).
+					UpdateColumn("odds_unparsed", true).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := db.Model(&PastBetLeg{}).Where("id = ?", l.ID).
+				UpdateColumns(map[string]any{"odds": price, "odds_decimal": dec}).Error; err != nil {
+				return err
+			}
+			fixed++
+		}
 		return nil
+	}).Error
+	if err != nil {
+		return err
+	}
+	if fixed > 0 {
+		log.Printf("[DB] canonicalized odds on %d bet/leg row(s)", fixed)
 	}
-	return db.Where("user_key = ? AND id NOT IN ?", userKey, ids).
-		Delete(&PastBetRecord{}).Error
+	return nil
 }
 
-/* ===================== Odds helpers ====================== */
+// unitsForOutcome settles a bet at its stored price (any format package odds
+// parses) with its promo applied. returned is the amount paid back for
+// cashout/partial outcomes, which settle at returned - stake instead (a
+// bonus bet's stake wasn't the bettor's, so it isn't subtracted).
+func unitsForOutcome(price string, outcome string, stake, returned float64, promo odds.Promo) float64 {
+	if needsReturnAmount(outcome) {
+		if promo.Kind == odds.PromoBonusBet {
+			return returned
+		}
+		return returned - stake
+	}
+	p, _ := odds.ParseOK(price)
+	return odds.Units(p, stake, outcome, promo)
+}
 
-var moneyline = regexp.MustCompile(`^[-+]\d+$`)
+/* ===================== Promos ====================== */
 
-func unitsForOutcome(odds string, outcome string, stake float64) float64 {
-	outcome = strings.ToLower(strings.TrimSpace(outcome))
-	switch outcome {
-	case "loss":
-		return -stake
-	case "push":
-		return 0
-	case "win":
-	default:
-		return 0
+// promo is the record's promo in settlement form.
+func (b PastBetRecord) promo() odds.Promo {
+	pr := odds.Promo{Kind: b.PromoType, BoostPct: b.BoostPct}
+	if b.PromoMaxWin != nil {
+		pr.MaxExtra = *b.PromoMaxWin
 	}
-	odds = strings.TrimSpace(odds)
-	if !moneyline.MatchString(odds) {
-		return 0
+	return pr
+}
+
+// normBetPromo validates and canonicalizes a bet's promo fields. A boost
+// percent without a type is taken as a profit boost.
+func normBetPromo(b *PastBet) error {
+	kind, ok := odds.NormPromoKind(b.PromoType)
+	if !ok {
+		return errors.New("promoType must be profit_boost, odds_boost, bonus_bet or no_sweat")
 	}
-	val := 0
-	sign := 1
-	if odds[0] == '-' {
-		sign = -1
+	if kind == odds.PromoNone && b.BoostPct > 0 {
+		kind = odds.PromoProfitBoost
 	}
-	for _, ch := range odds[1:] {
-		val = val*10 + int(ch-'0')
+	if b.BoostPct < 0 || b.PromoMaxWin != nil && *b.PromoMaxWin < 0 {
+		return errors.New("boostPct and promoMaxWin must be >= 0")
 	}
-	if sign > 0 {
-		return float64(val) / 100.0 * stake
+	if kind != odds.PromoProfitBoost && kind != odds.PromoOddsBoost {
+		b.BoostPct, b.PromoMaxWin = 0, nil
+	}
+	b.PromoType = kind
+	return nil
+}
+
+// promoUnitsFor is how many units a graded bet's promo added. Per-leg
+// settlement and cash-outs are priced from the bet's overall odds here.
+func promoUnitsFor(b PastBetRecord) float64 {
+	if b.Result == nil || b.PromoType == "" {
+		return 0
+	}
+	if needsReturnAmount(*b.Result) {
+		if b.PromoType == odds.PromoBonusBet {
+			return b.Stake
+		}
+		return 0
 	}
-	return 100.0 / float64(val) * stake
+	p, _ := odds.ParseOK(b.Odds)
+	return math.Round(odds.PromoUnits(p, b.Stake, *b.Result, b.promo())*100) / 100
 }
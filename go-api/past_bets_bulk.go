@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+/* ===================== HTTP: bulk grading ====================== */
+
+const maxBulkGrade = 200
+
+const (
+	bulkAtomic     = "atomic"      // any failure rolls back the whole batch
+	bulkBestEffort = "best_effort" // failed items roll back alone; the rest commit
+)
+
+type bulkGradeResult struct {
+	ID      string   `json:"id"`
+	Status  string   `json:"status"` // graded | error | rolled_back
+	Error   string   `json:"error,omitempty"`
+	Warning string   `json:"warning,omitempty"`
+	Bet     *PastBet `json:"bet,omitempty"`
+}
+
+// POST /api/past-bets/result/bulk
+//
+//	{ "mode": "atomic"|"best_effort", "items": [ <POST /api/past-bets/result body>, ... ] }
+//
+// Grades every item in one store call, which writes each affected stats row
+// once. atomic (the default) commits nothing unless every item succeeds and
+// answers 422 otherwise; best_effort commits the items that worked. Items are applied in order, so a bet may
+// appear more than once (e.g. one item per leg).
+func handlePastBetResultBulk(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	var in struct {
+		Mode  string       `json:"mode"`
+		Items []gradeInput `json:"items"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		errorJSON(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	switch in.Mode {
+	case "":
+		in.Mode = bulkAtomic
+	case bulkAtomic, bulkBestEffort:
+	default:
+		errorJSON(w, http.StatusBadRequest, "mode must be atomic or best_effort")
+		return
+	}
+	if len(in.Items) == 0 {
+		errorJSON(w, http.StatusBadRequest, "items is required")
+		return
+	}
+	if len(in.Items) > maxBulkGrade {
+		errorJSON(w, http.StatusBadRequest, fmt.Sprintf("at most %d items per request", maxBulkGrade))
+		return
+	}
+	items, err := store.GradeBets(r.Context(), userKey, in.Items, in.Mode == bulkBestEffort)
+	if err != nil && !errors.Is(err, errRolledBack) {
+		errorJSON(w, http.StatusInternalServerError, "db update error")
+		return
+	}
+
+	// A bet graded by several items shows its final state on each.
+	last := map[string]PastBet{}
+	for _, it := range items {
+		if it.Err == nil {
+			last[it.G.Rec.ID] = it.G.public()
+		}
+	}
+	results := make([]bulkGradeResult, len(in.Items))
+	failed := 0
+	for i, it := range items {
+		results[i].ID = in.Items[i].ID
+		var bad *badRequestError
+		switch {
+		case errors.Is(it.Err, errNotFound):
+			results[i].Status, results[i].Error = "error", "not found"
+			failed++
+		case errors.As(it.Err, &bad):
+			results[i].Status, results[i].Error = "error", bad.msg
+			failed++
+		case err != nil:
+			results[i].Status = "rolled_back"
+		default:
+			b := last[it.G.Rec.ID]
+			results[i].Status, results[i].Warning, results[i].Bet = "graded", it.G.Warning, &b
+		}
+	}
+	status := http.StatusOK
+	if err != nil {
+		status = http.StatusUnprocessableEntity
+	}
+	writeJSON(w, status, map[string]any{
+		"ok":      status == http.StatusOK && failed == 0,
+		"mode":    in.Mode,
+		"graded":  countStatus(results, "graded"),
+		"failed":  failed,
+		"results": results,
+	})
+}
+
+func countStatus(results []bulkGradeResult, status string) int {
+	n := 0
+	for _, r := range results {
+		if r.Status == status {
+			n++
+		}
+	}
+	return n
+}
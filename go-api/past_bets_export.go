@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+/* ===================== Export ======================
+GET /api/past-bets/export streams the user's whole (filtered) history. Rows
+are read a batch at a time through the same keyset paging as the history
+list, so memory stays flat however many bets there are. Once streaming has
+started the status can't change: a failure mid-export is logged and the
+body ends early.
+*/
+
+var exportContentTypes = map[string]string{
+	"csv":     "text/csv; charset=utf-8",
+	"json":    "application/json",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// betExporter writes one format; Write is called per batch, Close once.
+type betExporter interface {
+	Write(bets []PastBet) error
+	Close() error
+}
+
+// GET /api/past-bets/export?format=csv|json|parquet&sport=&model=&tag=&type=&result=&from=&to=&q=
+//
+// Same filters as GET /api/past-bets (limit and cursor are ignored). CSV has
+// one row per leg with the bet's columns repeated (bets without legs get one
+// row); JSON is an array of bets as the history list returns them; Parquet
+// has one row per bet with a repeated "legs" group. CSV tags are "|"-separated.
+func handlePastBetExport(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	ctype, ok := exportContentTypes[format]
+	if !ok {
+		errorJSON(w, http.StatusBadRequest, "format must be csv, json or parquet")
+		return
+	}
+	q, err := parsePastBetQuery(r.URL.Query())
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", ctype)
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="past-bets-%s.%s"`, time.Now().UTC().Format("20060102"), format))
+	w.WriteHeader(http.StatusOK)
+
+	var ex betExporter
+	switch format {
+	case "csv":
+		ex, err = newCSVExporter(w)
+	case "json":
+		ex, err = newJSONExporter(w)
+	default:
+		ex = newParquetExporter(w)
+	}
+	var ledger bankrollLedger
+	if err == nil {
+		ledger, err = loadLedger(r.Context(), userKey)
+	}
+	if err == nil {
+		err = store.EachBet(r.Context(), userKey, q, func(rows []betRow) error {
+			bets := make([]PastBet, len(rows))
+			for i, b := range rows {
+				bets[i] = b.public()
+			}
+			ledger.withMoney(bets)
+			if err := ex.Write(bets); err != nil {
+				return err
+			}
+			if f, ok := w.(http.Flusher); ok {
+				f.Flush()
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = ex.Close()
+	}
+	if err != nil {
+		log.Printf("[export] %s export for %s aborted: %v", format, userKey, err)
+	}
+}
+
+/* ---------------- CSV ---------------- */
+
+var exportCSVHeader = []string{
+	"bet_id", "date", "type", "sport", "model", "event", "odds", "odds_decimal", "stake",
+	"result", "result_units", "prompt_version", "stake_money", "result_money", "sportsbook", "tags", "notes",
+	"leg_index", "leg_team", "leg_player", "leg_market", "leg_line", "leg_odds", "leg_game_id", "leg_result",
+}
+
+type csvExporter struct{ cw *csv.Writer }
+
+func newCSVExporter(w io.Writer) (*csvExporter, error) {
+	cw := csv.NewWriter(w)
+	return &csvExporter{cw}, cw.Write(exportCSVHeader)
+}
+
+func (e *csvExporter) Write(bets []PastBet) error {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	fp := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return f(*v)
+	}
+	for _, b := range bets {
+		base := []string{
+			b.ID, b.Date, b.Type, b.Sport, b.Model, b.Event, b.Odds, f(b.OddsDecimal), f(b.Units),
+			b.Result, f(b.ResultUnits), b.PromptVersion, fp(b.StakeMoney), fp(b.ResultMoney), b.Sportsbook,
+			strings.Join(b.Tags, "|"), b.Notes,
+		}
+		if b.Result == "" {
+			base[10] = ""
+		}
+		if len(b.Legs) == 0 {
+			if err := e.cw.Write(append(base, "", "", "", "", "", "", "", "")); err != nil {
+				return err
+			}
+			continue
+		}
+		for i, l := range b.Legs {
+			res := ""
+			if l.Result != nil {
+				res = *l.Result
+			}
+			row := append(append([]string(nil), base...),
+				strconv.Itoa(i+1), l.Team, l.Player, l.Market, l.Line, l.Odds, l.GameID, res)
+			if err := e.cw.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+func (e *csvExporter) Close() error {
+	e.cw.Flush()
+	return e.cw.Error()
+}
+
+/* ---------------- JSON ---------------- */
+
+type jsonExporter struct {
+	w     io.Writer
+	first bool
+}
+
+func newJSONExporter(w io.Writer) (*jsonExporter, error) {
+	_, err := io.WriteString(w, "[")
+	return &jsonExporter{w: w, first: true}, err
+}
+
+func (e *jsonExporter) Write(bets []PastBet) error {
+	for _, b := range bets {
+		buf, err := json.Marshal(b)
+		if err != nil {
+			return err
+		}
+		if !e.first {
+			if _, err := io.WriteString(e.w, ",\n"); err != nil {
+				return err
+			}
+		}
+		e.first = false
+		if _, err := e.w.Write(buf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *jsonExporter) Close() error {
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+/* ---------------- Parquet ---------------- */
+
+type parquetLeg struct {
+	Team   string  `parquet:"team"`
+	Player string  `parquet:"player"`
+	Market string  `parquet:"market"`
+	Line   string  `parquet:"line"`
+	Odds   string  `parquet:"odds"`
+	GameID string  `parquet:"game_id"`
+	Result *string `parquet:"result,optional"`
+}
+
+type parquetBet struct {
+	ID            string       `parquet:"bet_id"`
+	Date          time.Time    `parquet:"date,timestamp(millisecond)"`
+	Type          string       `parquet:"type"`
+	Sport         string       `parquet:"sport"`
+	Model         string       `parquet:"model"`
+	Event         string       `parquet:"event"`
+	Odds          string       `parquet:"odds"`
+	OddsDecimal   float64      `parquet:"odds_decimal"`
+	Stake         float64      `parquet:"stake"`
+	Result        *string      `parquet:"result,optional"`
+	ResultUnits   *float64     `parquet:"result_units,optional"`
+	PromptVersion string       `parquet:"prompt_version"`
+	StakeMoney    *float64     `parquet:"stake_money,optional"`
+	ResultMoney   *float64     `parquet:"result_money,optional"`
+	Sportsbook    string       `parquet:"sportsbook"`
+	Tags          []string     `parquet:"tags,list"`
+	Notes         string       `parquet:"notes"`
+	Legs          []parquetLeg `parquet:"legs,list"`
+}
+
+// parquetExporter writes one row group per batch, so only a batch is buffered.
+type parquetExporter struct {
+	pw *parquet.GenericWriter[parquetBet]
+}
+
+func newParquetExporter(w io.Writer) *parquetExporter {
+	return &parquetExporter{pw: parquet.NewGenericWriter[parquetBet](w, parquet.Compression(&parquet.Snappy))}
+}
+
+func (e *parquetExporter) Write(bets []PastBet) error {
+	rows := make([]parquetBet, 0, len(bets))
+	for _, b := range bets {
+		row := parquetBet{
+			ID: b.ID, Date: mustParse(b.Date), Type: b.Type, Sport: b.Sport, Model: b.Model,
+			Event: b.Event, Odds: b.Odds, OddsDecimal: b.OddsDecimal, Stake: b.Units,
+			PromptVersion: b.PromptVersion, StakeMoney: b.StakeMoney, ResultMoney: b.ResultMoney,
+			Sportsbook: b.Sportsbook, Tags: b.Tags, Notes: b.Notes,
+		}
+		if b.Result != "" {
+			res, units := b.Result, b.ResultUnits
+			row.Result, row.ResultUnits = &res, &units
+		}
+		for _, l := range b.Legs {
+			row.Legs = append(row.Legs, parquetLeg{
+				Team: l.Team, Player: l.Player, Market: l.Market, Line: l.Line,
+				Odds: l.Odds, GameID: l.GameID, Result: l.Result,
+			})
+		}
+		rows = append(rows, row)
+	}
+	if _, err := e.pw.Write(rows); err != nil {
+		return err
+	}
+	return e.pw.Flush()
+}
+
+func (e *parquetExporter) Close() error { return e.pw.Close() }
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// seedExportBets stores a graded two-leg SGP and a newer pending single without legs.
+func seedExportBets(t *testing.T) {
+	t.Helper()
+	useMemStore(t)
+	win, units := "win", 2.64
+	day := time.Date(2025, 1, 10, 19, 0, 0, 0, time.UTC)
+	sgp := betRow{
+		Rec: PastBetRecord{ID: "bet-sgp", UserKey: "export-user", Type: "SGP", Date: day, Model: "Model A", Sport: "NBA",
+			Event: "Lakers @ Celtics", Odds: "+264", OddsDecimal: 3.64, Stake: 1, Result: &win, ResultUnits: &units},
+		Legs: legRecordsFromPublic("bet-sgp", "export-user", []BetLeg{
+			{Team: "Lakers", Market: "ML", Odds: "+120", Result: &win},
+			{Market: "Total", Line: "Over 220.5", Odds: "-110", Result: &win},
+		}),
+		Tags: []string{"late", "boosted"},
+	}
+	single := betRow{Rec: PastBetRecord{ID: "bet-single", UserKey: "export-user", Type: "Single", Date: day.AddDate(0, 0, 1),
+		Model: "Model B", Sport: "NFL", Event: "Chiefs ML", Odds: "-150", OddsDecimal: 1 + 100.0/150, Stake: 2, Notes: "a, \"quoted\" note"}}
+	if err := store.CreateBets(t.Context(), []betRow{sgp, single}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getExport(t *testing.T, userKey, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/api/past-bets/export?"+query, nil)
+	req.Header.Set("X-PP-User", userKey)
+	w := httptest.NewRecorder()
+	handlePastBetExport(w, req)
+	return w
+}
+
+func TestExportCSV(t *testing.T) {
+	seedExportBets(t)
+	w := getExport(t, "export-user", "format=csv")
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || strings.Join(rows[0], ",") != strings.Join(exportCSVHeader, ",") {
+		t.Fatalf("got %d rows, header %v", len(rows), rows[0])
+	}
+	col := func(row []string, name string) string {
+		for i, h := range exportCSVHeader {
+			if h == name {
+				return row[i]
+			}
+		}
+		t.Fatalf("no column %q", name)
+		return ""
+	}
+
+	// newest first: the single, one row with empty leg columns
+	single := rows[1]
+	if col(single, "bet_id") != "bet-single" || col(single, "result") != "" || col(single, "result_units") != "" ||
+		col(single, "notes") != `a, "quoted" note` || col(single, "stake") != "2" {
+		t.Errorf("single row: %v", single)
+	}
+	for _, c := range []string{"leg_index", "leg_team", "leg_player", "leg_market", "leg_line", "leg_odds", "leg_game_id", "leg_result"} {
+		if col(single, c) != "" {
+			t.Errorf("bet without legs: %s = %q", c, col(single, c))
+		}
+	}
+
+	// the SGP repeats its columns on each leg row
+	for i, row := range rows[2:] {
+		if col(row, "bet_id") != "bet-sgp" || col(row, "result") != "win" || col(row, "result_units") != "2.64" ||
+			col(row, "tags") != "boosted|late" || col(row, "leg_result") != "win" {
+			t.Errorf("leg row %d: %v", i+1, row)
+		}
+	}
+	if col(rows[2], "leg_index") != "1" || col(rows[2], "leg_team") != "Lakers" ||
+		col(rows[3], "leg_index") != "2" || col(rows[3], "leg_line") != "Over 220.5" {
+		t.Errorf("leg columns: %v / %v", rows[2], rows[3])
+	}
+}
+
+func TestExportJSON(t *testing.T) {
+	seedExportBets(t)
+	w := getExport(t, "export-user", "format=json")
+	body := w.Body.String()
+	if !strings.HasPrefix(body, "[") || !strings.HasSuffix(body, "]\n") {
+		t.Fatalf("not framed as an array: %q", body)
+	}
+	var bets []PastBet
+	if err := json.Unmarshal(w.Body.Bytes(), &bets); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if len(bets) != 2 || bets[0].ID != "bet-single" || bets[1].ID != "bet-sgp" || len(bets[1].Legs) != 2 || bets[1].Result != "win" {
+		t.Errorf("bets: %+v", bets)
+	}
+
+	// filters apply, and an empty export is still an array
+	w = getExport(t, "export-user", "format=json&sport=MLB")
+	if got := w.Body.String(); got != "[]\n" {
+		t.Errorf("empty export: %q", got)
+	}
+}
+
+func TestExportParquet(t *testing.T) {
+	seedExportBets(t)
+	w := getExport(t, "export-user", "format=parquet")
+	b := w.Body.Bytes()
+	rows, err := parquet.Read[parquetBet](bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows", len(rows))
+	}
+	single, sgp := rows[0], rows[1]
+	if single.ID != "bet-single" || single.Result != nil || single.ResultUnits != nil || len(single.Legs) != 0 {
+		t.Errorf("single: %+v", single)
+	}
+	if sgp.ID != "bet-sgp" || sgp.Result == nil || *sgp.Result != "win" || *sgp.ResultUnits != 2.64 ||
+		len(sgp.Legs) != 2 || sgp.Legs[1].Line != "Over 220.5" || len(sgp.Tags) != 2 {
+		t.Errorf("sgp: %+v", sgp)
+	}
+	if !sgp.Date.Equal(time.Date(2025, 1, 10, 19, 0, 0, 0, time.UTC)) {
+		t.Errorf("date %v", sgp.Date)
+	}
+}
+
+func TestExportRejectsFormat(t *testing.T) {
+	useMemStore(t)
+	if w := getExport(t, "export-user", "format=xlsx"); w.Code != http.StatusBadRequest {
+		t.Errorf("status %d, want 400", w.Code)
+	}
+	if w := getExport(t, "", "format=csv"); w.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status %d, want 401", w.Code)
+	}
+}
@@ -0,0 +1,562 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/go-api/odds"
+)
+
+/* ===================== CSV import ======================
+POST /api/past-bets/import takes a sportsbook CSV export (or a generic CSV
+with a column mapping), turns each row into a bet and de-duplicates it
+against the user's existing bets by content fingerprint. Nothing is written
+unless ?commit=true; the default response is the dry-run preview.
+*/
+
+const importMaxBytes = 5 << 20
+
+// Import fields a CSV column can map to.
+const (
+	impDate     = "date"
+	impSport    = "sport"
+	impType     = "type"
+	impEvent    = "event"
+	impLegs     = "legs"
+	impOdds     = "odds"
+	impStake    = "stake"
+	impResult   = "result"
+	impReturned = "returned" // total paid back (stake included)
+	impModel    = "model"
+	impBook     = "book"
+)
+
+var importFields = []string{impDate, impSport, impType, impEvent, impLegs, impOdds, impStake, impResult, impReturned, impModel, impBook}
+
+// csvProfile maps import fields to a sportsbook's export headers.
+type csvProfile struct {
+	Name    string
+	Columns map[string]string
+}
+
+// Known exports, matched by header names (case-insensitive). "generic" uses
+// the field names themselves unless ?map= overrides them.
+var csvProfiles = []csvProfile{
+	{Name: "draftkings", Columns: map[string]string{
+		impDate: "Date Placed", impSport: "Sport", impType: "Bet Type", impLegs: "Selection",
+		impEvent: "Event", impOdds: "Odds", impStake: "Wager", impResult: "Status", impReturned: "Payout",
+	}},
+	{Name: "fanduel", Columns: map[string]string{
+		impDate: "Placed Date", impSport: "Sport", impType: "Bet Type", impLegs: "Legs",
+		impEvent: "Event Description", impOdds: "Odds", impStake: "Stake", impResult: "Result", impReturned: "Return",
+	}},
+	{Name: "betmgm", Columns: map[string]string{
+		impDate: "Bet Date", impSport: "Sport", impType: "Type", impLegs: "Selections",
+		impEvent: "Event", impOdds: "Odds", impStake: "Bet Amount", impResult: "Bet Status", impReturned: "Winnings",
+	}},
+	{Name: "generic", Columns: genericColumns()},
+}
+
+func genericColumns() map[string]string {
+	m := map[string]string{}
+	for _, f := range importFields {
+		m[f] = f
+	}
+	return m
+}
+
+// importOptions come from the query string.
+type importOptions struct {
+	Format   string            // profile name or "auto"
+	Mapping  map[string]string // field -> header overrides ("date=Placed,odds=Price")
+	UnitSize float64           // currency per unit; stake and returns are divided by it
+	Model    string            // model for rows without one
+	Sport    string            // sport for rows without one
+	Book     string            // sportsbook for rows without one; defaults to the export's book
+	Commit   bool
+}
+
+func parseImportOptions(r *http.Request) (importOptions, error) {
+	q := r.URL.Query()
+	o := importOptions{
+		Format:   strings.ToLower(orDefault(strings.TrimSpace(q.Get("format")), "auto")),
+		UnitSize: 1,
+		Model:    orDefault(strings.TrimSpace(q.Get("model")), "Imported"),
+		Sport:    strings.TrimSpace(q.Get("sport")),
+		Commit:   q.Get("commit") == "true" || q.Get("commit") == "1",
+	}
+	if s := strings.TrimSpace(q.Get("book")); s != "" {
+		id, ok := normSportsbook(s)
+		if !ok {
+			return o, fmt.Errorf("unknown book %q (see GET /api/sportsbooks)", s)
+		}
+		o.Book = id
+	}
+	if s := strings.TrimSpace(q.Get("unitSize")); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v <= 0 {
+			return o, errors.New("unitSize must be a positive number")
+		}
+		o.UnitSize = v
+	}
+	if s := strings.TrimSpace(q.Get("map")); s != "" {
+		o.Mapping = map[string]string{}
+		for _, part := range strings.Split(s, ",") {
+			k, v, ok := strings.Cut(part, "=")
+			k = strings.ToLower(strings.TrimSpace(k))
+			if !ok || !containsFold(importFields, k) || strings.TrimSpace(v) == "" {
+				return o, fmt.Errorf("bad map entry %q (want field=Header, fields: %s)", part, strings.Join(importFields, ", "))
+			}
+			o.Mapping[k] = strings.TrimSpace(v)
+		}
+	}
+	return o, nil
+}
+
+// resolveColumns picks the profile and returns field -> column index.
+func resolveColumns(header []string, o importOptions) (string, map[string]int, error) {
+	idx := map[string]int{}
+	for i, h := range header {
+		idx[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	bind := func(p csvProfile) map[string]int {
+		cols := map[string]int{}
+		for f, h := range p.Columns {
+			if ov, ok := o.Mapping[f]; ok {
+				h = ov
+			}
+			if i, ok := idx[strings.ToLower(h)]; ok {
+				cols[f] = i
+			}
+		}
+		for f, h := range o.Mapping {
+			if i, ok := idx[strings.ToLower(h)]; ok {
+				cols[f] = i
+			}
+		}
+		return cols
+	}
+	usable := func(cols map[string]int) bool {
+		_, d := cols[impDate]
+		_, s := cols[impStake]
+		_, od := cols[impOdds]
+		return d && s && od
+	}
+
+	for _, p := range csvProfiles {
+		if o.Format != "auto" && p.Name != o.Format {
+			continue
+		}
+		if cols := bind(p); usable(cols) {
+			return p.Name, cols, nil
+		}
+		if o.Format != "auto" {
+			return "", nil, fmt.Errorf("CSV header doesn't match format %q (need date, odds and stake columns; use ?map= to point at them)", o.Format)
+		}
+	}
+	if o.Format != "auto" {
+		return "", nil, fmt.Errorf("unknown format %q", o.Format)
+	}
+	return "", nil, errors.New("couldn't recognize the CSV header (need date, odds and stake columns; use format=generic&map=...)")
+}
+
+/* ---------------- Row parsing ---------------- */
+
+var importDateLayouts = []string{
+	time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02",
+	"01/02/2006 3:04 PM", "01/02/2006 15:04", "1/2/2006 3:04 PM", "1/2/2006 15:04", "01/02/2006", "1/2/2006",
+	"Jan 2, 2006 3:04 PM", "Jan 2, 2006", "2 Jan 2006",
+}
+
+func parseImportDate(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	for _, l := range importDateLayouts {
+		if t, err := time.Parse(l, s); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized date %q", s)
+}
+
+func parseMoney(s string) (float64, error) {
+	s = strings.NewReplacer("$", "", "€", "", "£", "", ",", "", " ", "").Replace(strings.TrimSpace(s))
+	if s == "" {
+		return 0, errors.New("empty amount")
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// Book wording for settlement, on top of normOutcome.
+var importResultAliases = map[string]string{
+	"won": "win", "winner": "win", "w": "win",
+	"lost": "loss", "lose": "loss", "loser": "loss", "l": "loss",
+	"p": "push", "tie": "push", "draw": "push",
+	"cancelled": "void", "canceled": "void", "refunded": "void", "voided": "void",
+	"cashed out": "cashout", "cash out": "cashout",
+	"half won": "half-win", "half lost": "half-loss",
+	"open": "", "pending": "", "unsettled": "", "live": "",
+}
+
+func parseImportResult(s string) (string, error) {
+	l := strings.ToLower(strings.TrimSpace(s))
+	if a, ok := importResultAliases[l]; ok {
+		return a, nil
+	}
+	if o, ok := normOutcome(l); ok {
+		return o, nil
+	}
+	return "", fmt.Errorf("unrecognized result %q", s)
+}
+
+var (
+	legSplitRe  = regexp.MustCompile(`\s*(?:\||;|\n)\s*`)
+	legOddsRe   = regexp.MustCompile(`\s*(?:@\s*|\(\s*)([-+]?\d+(?:[./]\d+)?|EVEN|evens)\s*\)?\s*$`)
+	legLineRe   = regexp.MustCompile(`^(?:[ou]?[-+]?\d+(?:\.\d+)?\+?)$`)
+	teamMarkets = map[string]bool{"ML": true, "SPREAD": true, "RL": true, "PL": true, "TOTAL": true, "OVER": true, "UNDER": true}
+)
+
+// parseImportLegs splits a legs cell ("LeBron James PTS 25+ (-110) | Lakers ML @ +120")
+// into legs. The last token is taken as the line when it looks like one and
+// the token before it (or a trailing all-caps token) as the market; the rest
+// names the team or player. Anything else becomes the market text as a whole.
+func parseImportLegs(cell string) []BetLeg {
+	var out []BetLeg
+	for _, raw := range legSplitRe.Split(strings.TrimSpace(cell), -1) {
+		if raw == "" {
+			continue
+		}
+		var lg BetLeg
+		if m := legOddsRe.FindStringSubmatchIndex(raw); m != nil {
+			lg.Odds, _ = canonicalOdds(raw[m[2]:m[3]])
+			raw = strings.TrimSpace(raw[:m[0]])
+		}
+		toks := strings.Fields(raw)
+		if n := len(toks); n >= 2 && legLineRe.MatchString(toks[n-1]) {
+			lg.Line = toks[n-1]
+			toks = toks[:n-1]
+		}
+		switch n := len(toks); {
+		case n >= 2 && (lg.Line != "" || strings.ToUpper(toks[n-1]) == toks[n-1]):
+			lg.Market = toks[n-1] // "PTS 25+", "Lakers ML"
+			toks = toks[:n-1]
+		case n == 1 && lg.Line != "" && teamMarkets[strings.ToUpper(toks[0])]:
+			lg.Market, toks = toks[0], nil // "Over 220.5"
+		case n == 1 && strings.HasPrefix(lg.Line, "+"), n == 1 && strings.HasPrefix(lg.Line, "-"):
+			lg.Market = "spread" // "Lakers -3.5"
+		}
+		name := strings.Join(toks, " ")
+		if teamMarkets[strings.ToUpper(lg.Market)] {
+			lg.Team = name
+		} else {
+			lg.Player = name
+		}
+		if lg.Market == "" {
+			lg.Market, lg.Player = name, ""
+		}
+		out = append(out, lg)
+	}
+	return out
+}
+
+// importRow is one CSV row in the preview.
+type importRow struct {
+	Row         int      `json:"row"`    // 1-based data row (header excluded)
+	Status      string   `json:"status"` // new | duplicate | error
+	Error       string   `json:"error,omitempty"`
+	Bet         *PastBet `json:"bet,omitempty"`
+	DuplicateOf string   `json:"duplicateOf,omitempty"` // existing bet id, or "row N" within the file
+
+	fingerprint string
+	date        time.Time
+	returned    float64
+	legs        []BetLeg
+}
+
+func buildImportRow(n int, rec []string, cols map[string]int, o importOptions) importRow {
+	row := importRow{Row: n}
+	cell := func(f string) string {
+		if i, ok := cols[f]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+	fail := func(err error) importRow {
+		row.Status, row.Error = "error", err.Error()
+		return row
+	}
+
+	date, err := parseImportDate(cell(impDate))
+	if err != nil {
+		return fail(err)
+	}
+	stake, err := parseMoney(cell(impStake))
+	if err != nil || stake <= 0 {
+		return fail(fmt.Errorf("invalid stake %q", cell(impStake)))
+	}
+	stake /= o.UnitSize
+	price, dec := canonicalOdds(cell(impOdds))
+	if dec == 0 {
+		return fail(fmt.Errorf("unrecognized odds %q", cell(impOdds)))
+	}
+	result, err := parseImportResult(cell(impResult))
+	if err != nil {
+		return fail(err)
+	}
+	if needsReturnAmount(result) {
+		ret, err := parseMoney(cell(impReturned))
+		if err != nil || ret < 0 {
+			return fail(fmt.Errorf("%s needs a returned amount, got %q", result, cell(impReturned)))
+		}
+		row.returned = ret / o.UnitSize
+	}
+	book, ok := normSportsbook(orDefault(cell(impBook), o.Book))
+	if !ok {
+		return fail(fmt.Errorf("unknown sportsbook %q", cell(impBook)))
+	}
+	legs := parseImportLegs(cell(impLegs))
+	betType := normMode(cell(impType))
+	if betType == "ALL" {
+		betType = "Single"
+		if len(legs) > 1 {
+			betType = "SGP"
+		}
+	}
+
+	bet := PastBet{
+		Type:        betType,
+		Date:        date.Format(time.RFC3339),
+		Model:       normBetModel(orDefault(cell(impModel), o.Model)),
+		Sport:       strings.ToUpper(orDefault(cell(impSport), o.Sport)),
+		Event:       cell(impEvent),
+		Legs:        legs,
+		Odds:        price,
+		OddsDecimal: dec,
+		Units:       stake,
+		Result:      result,
+		Sportsbook:  book,
+	}
+	if result != "" {
+		bet.ResultUnits = math.Round(unitsForOutcome(price, result, stake, row.returned, odds.Promo{})*100) / 100
+	}
+	row.Status, row.Bet, row.date, row.legs = "new", &bet, date, legs
+	row.fingerprint = betFingerprint(date, price, stake, bet.Event, legs)
+	return row
+}
+
+/* ---------------- Fingerprints ---------------- */
+
+// betFingerprint identifies a bet by content: placement day, price, stake
+// and its legs (order-insensitive), or the event text when it has no legs.
+func betFingerprint(date time.Time, price string, stake float64, event string, legs []BetLeg) string {
+	parts := make([]string, 0, len(legs))
+	for _, l := range legs {
+		parts = append(parts, strings.ToLower(strings.Join(strings.Fields(
+			strings.Join([]string{l.Team, l.Player, l.Market, l.Line, l.Odds}, " ")), " ")))
+	}
+	sort.Strings(parts)
+	body := strings.Join(parts, "|")
+	if body == "" {
+		body = strings.ToLower(strings.Join(strings.Fields(event), " "))
+	}
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%.2f\x00%s", date.UTC().Format("2006-01-02"), price, stake, body)))
+	return hex.EncodeToString(h[:16])
+}
+
+func recordFingerprint(rec PastBetRecord, legs []PastBetLeg) string {
+	pub := make([]BetLeg, 0, len(legs))
+	for _, l := range legs {
+		pub = append(pub, legToPublic(l))
+	}
+	return betFingerprint(rec.Date, rec.Odds, rec.Stake, rec.Event, pub)
+}
+
+// existingFingerprints fingerprints the user's bets placed between from and to (whole days).
+func existingFingerprints(ctx context.Context, userKey string, from, to time.Time) (map[string]string, error) {
+	from = from.Truncate(24 * time.Hour)
+	to = to.Truncate(24 * time.Hour).Add(24 * time.Hour)
+	out := map[string]string{}
+	err := store.EachBet(ctx, userKey, pastBetQuery{From: &from, To: &to}, func(rows []betRow) error {
+		for _, b := range rows {
+			out[recordFingerprint(b.Rec, b.Legs)] = b.Rec.ID
+		}
+		return nil
+	})
+	return out, err
+}
+
+/* ---------------- HTTP ---------------- */
+
+// POST /api/past-bets/import?format=auto|draftkings|fanduel|betmgm|generic&map=date=Placed,odds=Price&unitSize=10&model=&sport=&book=&commit=true
+//
+// Body: the CSV as text/csv, or multipart/form-data with a "file" field.
+// Without commit=true nothing is saved and the response previews every row
+// (new | duplicate | error). With commit=true the "new" rows are saved
+// (graded ones count toward stats) and the rest are reported the same way.
+func handlePastBetImport(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	opts, err := parseImportOptions(r)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, importMaxBytes)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			errorJSON(w, http.StatusBadRequest, "multipart upload needs a \"file\" field")
+			return
+		}
+		defer f.Close()
+		body = f
+	}
+
+	cr := csv.NewReader(body)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, "empty or unreadable CSV")
+		return
+	}
+	format, cols, err := resolveColumns(header, opts)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if id, ok := normSportsbook(format); ok && opts.Book == "" && format != "generic" {
+		opts.Book = id // a book's own export
+	}
+
+	var rows []importRow
+	for n := 1; ; n++ {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var mbe *http.MaxBytesError
+		if errors.As(err, &mbe) {
+			errorJSON(w, http.StatusRequestEntityTooLarge, "CSV too large")
+			return
+		}
+		if err != nil {
+			rows = append(rows, importRow{Row: n, Status: "error", Error: err.Error()})
+			continue
+		}
+		if strings.TrimSpace(strings.Join(rec, "")) == "" {
+			continue
+		}
+		rows = append(rows, buildImportRow(n, rec, cols, opts))
+	}
+
+	// de-duplicate within the file, then against stored bets
+	seen := map[string]int{}
+	var from, to time.Time
+	for i := range rows {
+		rw := &rows[i]
+		if rw.Status != "new" {
+			continue
+		}
+		if first, ok := seen[rw.fingerprint]; ok {
+			rw.Status, rw.DuplicateOf = "duplicate", fmt.Sprintf("row %d", first)
+			continue
+		}
+		seen[rw.fingerprint] = rw.Row
+		if from.IsZero() || rw.date.Before(from) {
+			from = rw.date
+		}
+		if rw.date.After(to) {
+			to = rw.date
+		}
+	}
+	if !from.IsZero() {
+		existing, err := existingFingerprints(r.Context(), userKey, from, to)
+		if err != nil {
+			errorJSON(w, http.StatusInternalServerError, "db error")
+			return
+		}
+		for i := range rows {
+			if id, ok := existing[rows[i].fingerprint]; ok && rows[i].Status == "new" {
+				rows[i].Status, rows[i].DuplicateOf = "duplicate", id
+			}
+		}
+	}
+
+	summary := map[string]int{"new": 0, "duplicate": 0, "error": 0}
+	for _, rw := range rows {
+		summary[rw.Status]++
+	}
+	imported := 0
+	if opts.Commit && summary["new"] > 0 {
+		if imported, err = commitImportRows(r, userKey, rows); err != nil {
+			errorJSON(w, http.StatusInternalServerError, "db insert error")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ok":       true,
+		"dryRun":   !opts.Commit,
+		"format":   format,
+		"rows":     rows,
+		"summary":  summary,
+		"imported": imported,
+	})
+}
+
+// commitImportRows saves the "new" rows in one batch and fills in their ids.
+func commitImportRows(r *http.Request, userKey string, rows []importRow) (int, error) {
+	var bets []betRow
+	var saved []*importRow
+	for i := range rows {
+		rw := &rows[i]
+		if rw.Status != "new" {
+			continue
+		}
+		b := rw.Bet
+		id := newID()
+		rec := PastBetRecord{
+			ID:          id,
+			UserKey:     userKey,
+			Type:        b.Type,
+			Date:        rw.date,
+			Model:       b.Model,
+			Sport:       b.Sport,
+			Event:       b.Event,
+			Odds:        b.Odds,
+			OddsDecimal: b.OddsDecimal,
+			Stake:       b.Units,
+			Sportsbook:  b.Sportsbook,
+		}
+		if b.Result != "" {
+			res, units := b.Result, b.ResultUnits
+			rec.Result, rec.ResultUnits = &res, &units
+		}
+		bets = append(bets, betRow{Rec: rec, Legs: legRecordsFromPublic(id, userKey, rw.legs)})
+		saved = append(saved, rw)
+	}
+	if err := store.CreateBets(withActor(r.Context(), actorImport), bets); err != nil {
+		return 0, err
+	}
+	for i, rw := range saved {
+		*rw.Bet = bets[i].public()
+	}
+	return len(bets), nil
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type importResponse struct {
+	DryRun   bool           `json:"dryRun"`
+	Format   string         `json:"format"`
+	Rows     []importRow    `json:"rows"`
+	Summary  map[string]int `json:"summary"`
+	Imported int            `json:"imported"`
+	Error    string         `json:"error"`
+}
+
+// postImport runs the import handler on a testdata CSV as userKey.
+func postImport(t *testing.T, userKey, query, fixture string) (int, importResponse) {
+	t.Helper()
+	body, err := os.ReadFile(filepath.Join("testdata", "import", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/api/past-bets/import?"+query, strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "text/csv")
+	req.Header.Set("X-PP-User", userKey)
+	w := httptest.NewRecorder()
+	handlePastBetImport(w, req)
+	var out importResponse
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode response: %v (%s)", err, w.Body.String())
+	}
+	return w.Code, out
+}
+
+func useMemStore(t *testing.T) {
+	t.Helper()
+	prev := store
+	store = newMemStore()
+	t.Cleanup(func() { store = prev })
+}
+
+// wantRow is what one preview row should say; bet fields are checked for new rows.
+type wantRow struct {
+	status, errHas string
+	typ, odds      string
+	result         string
+	units          float64
+	legs           int
+}
+
+func checkRows(t *testing.T, got []importRow, want []wantRow) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d rows, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Status != w.status {
+			t.Errorf("row %d: status %q (%s), want %q", g.Row, g.Status, g.Error, w.status)
+			continue
+		}
+		if w.status == "error" && !strings.Contains(g.Error, w.errHas) {
+			t.Errorf("row %d: error %q, want it to mention %q", g.Row, g.Error, w.errHas)
+		}
+		if w.status != "new" {
+			continue
+		}
+		b := g.Bet
+		if b.Type != w.typ || b.Odds != w.odds || b.Result != w.result || len(b.Legs) != w.legs {
+			t.Errorf("row %d: got %s %s %q with %d legs, want %s %s %q with %d legs",
+				g.Row, b.Type, b.Odds, b.Result, len(b.Legs), w.typ, w.odds, w.result, w.legs)
+		}
+		if b.ResultUnits != w.units {
+			t.Errorf("row %d: result units %v, want %v", g.Row, b.ResultUnits, w.units)
+		}
+	}
+}
+
+func TestImportProfiles(t *testing.T) {
+	tests := []struct {
+		fixture, query, format string
+		rows                   []wantRow
+	}{
+		{"draftkings.csv", "", "draftkings", []wantRow{
+			{status: "new", typ: "Single", odds: "+150", result: "win", units: 15, legs: 1},
+			{status: "new", typ: "SGP", odds: "+264", result: "loss", units: -5, legs: 2},
+			{status: "new", typ: "Single", odds: "-110", result: "", legs: 1},
+			{status: "error", errHas: "unrecognized date"},
+			{status: "error", errHas: "invalid stake"},
+		}},
+		{"fanduel.csv", "", "fanduel", []wantRow{
+			{status: "new", typ: "SGP", odds: "+180", result: "loss", units: -20, legs: 2},
+			{status: "new", typ: "Single", odds: "-105", result: "cashout", units: 5, legs: 1},
+			{status: "error", errHas: "unrecognized result"},
+			{status: "duplicate"},
+		}},
+		{"betmgm.csv", "", "betmgm", []wantRow{
+			{status: "new", typ: "Single", odds: "+110", result: "win", units: 11, legs: 1},
+			{status: "new", typ: "Single", odds: "-115", result: "push", units: 0, legs: 1},
+			{status: "error", errHas: "unrecognized odds"},
+			{status: "error", errHas: "needs a returned amount"},
+		}},
+		{"generic.csv", "format=generic&map=date=When", "generic", []wantRow{
+			{status: "new", typ: "Single", odds: "+200", result: "win", units: 4},
+			{status: "new", typ: "Single", odds: "-150", result: "half-loss", units: -1.5},
+			{status: "error", errHas: "invalid stake"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			useMemStore(t)
+			code, res := postImport(t, "import-user", tt.query, tt.fixture)
+			if code != http.StatusOK {
+				t.Fatalf("status %d: %s", code, res.Error)
+			}
+			if res.Format != tt.format || !res.DryRun || res.Imported != 0 {
+				t.Errorf("format %q dryRun %v imported %d, want %q, true, 0", res.Format, res.DryRun, res.Imported, tt.format)
+			}
+			checkRows(t, res.Rows, tt.rows)
+		})
+	}
+}
+
+func TestImportProfileDetails(t *testing.T) {
+	useMemStore(t)
+	_, res := postImport(t, "import-user", "", "fanduel.csv")
+	if len(res.Rows) != 4 {
+		t.Fatalf("got %d rows", len(res.Rows))
+	}
+	if b := res.Rows[0].Bet; b.Sportsbook != "fanduel" || b.Sport != "NFL" || b.Model != "Imported" {
+		t.Errorf("defaults: book %q sport %q model %q", b.Sportsbook, b.Sport, b.Model)
+	}
+	if got := res.Rows[3].DuplicateOf; got != "row 1" {
+		t.Errorf("in-file duplicate points at %q, want row 1", got)
+	}
+	if res.Summary["new"] != 2 || res.Summary["duplicate"] != 1 || res.Summary["error"] != 1 {
+		t.Errorf("summary %v", res.Summary)
+	}
+
+	_, res = postImport(t, "import-user", "format=generic&map=date=When&unitSize=2", "generic.csv")
+	if b := res.Rows[0].Bet; b.Units != 1 || b.ResultUnits != 2 || b.Sport != "MLB" || b.Model != "Model A" {
+		t.Errorf("unitSize=2: got %v units, %v result units, sport %q, model %q", b.Units, b.ResultUnits, b.Sport, b.Model)
+	}
+}
+
+func TestImportCommitAndDedupe(t *testing.T) {
+	useMemStore(t)
+	code, res := postImport(t, "import-user", "commit=true", "draftkings.csv")
+	if code != http.StatusOK || res.DryRun || res.Imported != 3 {
+		t.Fatalf("commit: status %d dryRun %v imported %d", code, res.DryRun, res.Imported)
+	}
+	ids := map[string]bool{}
+	for _, rw := range res.Rows {
+		if rw.Status == "new" {
+			ids[rw.Bet.ID] = true
+		}
+	}
+	page, err := store.ListBets(t.Context(), "import-user", pastBetQuery{Limit: 10})
+	if err != nil || page.Total != 3 {
+		t.Fatalf("stored %d bets (%v), want 3", page.Total, err)
+	}
+	if evs, _ := store.BetEvents(t.Context(), "import-user", page.Bets[0].ID); len(evs) != 1 || evs[0].Actor != actorImport {
+		t.Errorf("import events: %+v", evs)
+	}
+
+	// the same file again only finds duplicates of what was saved
+	_, res = postImport(t, "import-user", "commit=true", "draftkings.csv")
+	if res.Imported != 0 || res.Summary["duplicate"] != 3 || res.Summary["error"] != 2 {
+		t.Errorf("re-import: imported %d, summary %v", res.Imported, res.Summary)
+	}
+	for _, rw := range res.Rows {
+		if rw.Status == "duplicate" && !ids[rw.DuplicateOf] {
+			t.Errorf("row %d: duplicate of %q, not one of the saved bets", rw.Row, rw.DuplicateOf)
+		}
+	}
+
+	// another user's bets never count as duplicates
+	_, res = postImport(t, "other-user", "", "draftkings.csv")
+	if res.Summary["new"] != 3 {
+		t.Errorf("other user: summary %v", res.Summary)
+	}
+}
+
+func TestImportRejectsHeaders(t *testing.T) {
+	useMemStore(t)
+	for _, tt := range []struct{ query, fixture, errHas string }{
+		{"format=fanduel", "draftkings.csv", `doesn't match format "fanduel"`},
+		{"format=nope", "draftkings.csv", `unknown format "nope"`},
+		{"", "generic.csv", "couldn't recognize the CSV header"},
+		{"map=when", "generic.csv", "bad map entry"},
+		{"book=nobook", "generic.csv", "unknown book"},
+	} {
+		code, res := postImport(t, "import-user", tt.query, tt.fixture)
+		if code != http.StatusBadRequest || !strings.Contains(res.Error, tt.errHas) {
+			t.Errorf("%s with %s: status %d error %q, want 400 mentioning %q", tt.fixture, tt.query, code, res.Error, tt.errHas)
+		}
+	}
+}
+
+func TestParseImportLegs(t *testing.T) {
+	tests := []struct {
+		cell string
+		want []BetLeg
+	}{
+		{"LeBron James PTS 25+ (-110) | Lakers ML @ +120", []BetLeg{
+			{Player: "LeBron James", Market: "PTS", Line: "25+", Odds: "-110"},
+			{Team: "Lakers", Market: "ML", Odds: "+120"},
+		}},
+		{"Over 220.5; Lakers -3.5 (-105)", []BetLeg{
+			{Market: "Over", Line: "220.5"},
+			{Team: "Lakers", Market: "spread", Line: "-3.5", Odds: "-105"},
+		}},
+		{"Anytime touchdown scorer", []BetLeg{{Market: "Anytime touchdown scorer"}}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := parseImportLegs(tt.cell)
+		if len(got) != len(tt.want) {
+			t.Errorf("%q: got %+v, want %+v", tt.cell, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%q leg %d: got %+v, want %+v", tt.cell, i, got[i], tt.want[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/* ===================== History filters & pagination ====================== */
+
+const (
+	defaultPageSize = 15
+	maxPageSize     = 100
+	eachBetBatch    = 500 // Store.EachBet page size
+)
+
+// pastBetQuery is the parsed filter set shared by the history list (and anything
+// else that walks a user's bets the same way).
+type pastBetQuery struct {
+	Sport  string
+	Book   string // sportsbook id
+	Model  string
+	Type   string // Single | SGP | SGP+
+	Result string // pending, graded or one of betOutcomes
+	From   *time.Time
+	To     *time.Time // exclusive
+	Text   string     // substring of the event summary or notes (case-insensitive)
+	Tags   []string   // normalized tag names; a bet must carry all of them
+	Limit  int
+	Cursor *betCursor
+}
+
+// betCursor is the keyset position of the last row on a page, matching the
+// list order (date DESC, created_at DESC, id DESC).
+type betCursor struct {
+	Date      time.Time `json:"d"`
+	CreatedAt time.Time `json:"c"`
+	ID        string    `json:"i"`
+}
+
+func cursorOf(rec PastBetRecord) betCursor {
+	return betCursor{Date: rec.Date, CreatedAt: rec.CreatedAt, ID: rec.ID}
+}
+
+func encodeCursor(c betCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s string) (*betCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c betCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID == "" {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
+}
+
+// parseQueryDate accepts RFC3339 or YYYY-MM-DD (midnight UTC).
+func parseQueryDate(s string) (*time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	if t, err := time.Parse("2006-01-02", s); err == nil {
+		return &t, nil
+	}
+	return nil, errors.New("invalid date " + strconv.Quote(s) + " (use RFC3339 or YYYY-MM-DD)")
+}
+
+// parsePastBetQuery reads ?sport=&model=&book=&tag=&type=&result=&from=&to=&q=&limit=&cursor=.
+// A bare YYYY-MM-DD "to" includes that whole day.
+func parsePastBetQuery(v url.Values) (pastBetQuery, error) {
+	q := pastBetQuery{
+		Sport: strings.TrimSpace(v.Get("sport")),
+		Model: strings.TrimSpace(v.Get("model")),
+		Text:  strings.TrimSpace(v.Get("q")),
+		Limit: defaultPageSize,
+	}
+	if b := strings.TrimSpace(v.Get("book")); b != "" {
+		id, ok := normSportsbook(b)
+		if !ok {
+			return q, errors.New("unknown book " + strconv.Quote(b))
+		}
+		q.Book = id
+	}
+	for _, t := range v["tag"] {
+		if name := normTagName(t); name != "" {
+			q.Tags = append(q.Tags, name)
+		}
+	}
+	if t := strings.TrimSpace(v.Get("type")); t != "" {
+		if q.Type = normMode(t); q.Type == "ALL" {
+			q.Type = ""
+		}
+	}
+	switch res := strings.ToLower(strings.TrimSpace(v.Get("result"))); res {
+	case "", "all":
+	case "pending", "graded":
+		q.Result = res
+	default:
+		o, ok := normOutcome(res)
+		if !ok {
+			return q, errors.New("result must be pending, graded or one of " + strings.Join(betOutcomes, ", "))
+		}
+		q.Result = o
+	}
+	if s := strings.TrimSpace(v.Get("from")); s != "" {
+		t, err := parseQueryDate(s)
+		if err != nil {
+			return q, err
+		}
+		q.From = t
+	}
+	if s := strings.TrimSpace(v.Get("to")); s != "" {
+		t, err := parseQueryDate(s)
+		if err != nil {
+			return q, err
+		}
+		if len(s) == len("2006-01-02") {
+			end := t.AddDate(0, 0, 1)
+			t = &end
+		}
+		q.To = t
+	}
+	if s := strings.TrimSpace(v.Get("limit")); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 1 {
+			return q, errors.New("limit must be a positive integer")
+		}
+		if n > maxPageSize {
+			n = maxPageSize
+		}
+		q.Limit = n
+	}
+	if s := strings.TrimSpace(v.Get("cursor")); s != "" {
+		c, err := decodeCursor(s)
+		if err != nil {
+			return q, err
+		}
+		q.Cursor = c
+	}
+	return q, nil
+}
+
+// apply adds the WHERE clauses for userKey and every filter (not the cursor).
+// withResult=false leaves out the result filter, for per-result counts.
+func (q pastBetQuery) apply(db *gorm.DB, userKey string, withResult bool) *gorm.DB {
+	db = db.Where("user_key = ?", userKey)
+	if q.Sport != "" {
+		db = db.Where("sport = ?", q.Sport)
+	}
+	if q.Book != "" {
+		db = db.Where("sportsbook = ?", q.Book)
+	}
+	if q.Model != "" {
+		db = db.Where("model = ?", q.Model)
+	}
+	if q.Type != "" {
+		db = db.Where("type = ?", q.Type)
+	}
+	if withResult && q.Result != "" {
+		switch q.Result {
+		case "pending":
+			db = db.Where("result IS NULL")
+		case "graded":
+			db = db.Where("result IS NOT NULL")
+		default:
+			db = db.Where("result = ?", q.Result)
+		}
+	}
+	if q.From != nil {
+		db = db.Where("date >= ?", *q.From)
+	}
+	if q.To != nil {
+		db = db.Where("date < ?", *q.To)
+	}
+	if q.Text != "" {
+		// search the human summary only, not the packed legs JSON
+		like := "%" + escapeLike(q.Text) + "%"
+		db = db.Where("(split_part(event, ?, 1) ILIKE ? OR notes ILIKE ?)", legsMarker, like, like)
+	}
+	return taggedWith(db, userKey, q.Tags)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// matches is apply for the memory store.
+func (q pastBetQuery) matches(b betRow, withResult bool) bool {
+	rec := b.Rec
+	if q.Sport != "" && rec.Sport != q.Sport ||
+		q.Book != "" && rec.Sportsbook != q.Book ||
+		q.Model != "" && rec.Model != q.Model ||
+		q.Type != "" && rec.Type != q.Type {
+		return false
+	}
+	if withResult && q.Result != "" {
+		switch q.Result {
+		case "pending":
+			if rec.Result != nil {
+				return false
+			}
+		case "graded":
+			if rec.Result == nil {
+				return false
+			}
+		default:
+			if rec.Result == nil || *rec.Result != q.Result {
+				return false
+			}
+		}
+	}
+	if q.From != nil && rec.Date.Before(*q.From) || q.To != nil && !rec.Date.Before(*q.To) {
+		return false
+	}
+	if t := strings.ToLower(q.Text); t != "" {
+		summary, _ := unpackEvent(rec.Event)
+		if !strings.Contains(strings.ToLower(summary), t) && !strings.Contains(strings.ToLower(rec.Notes), t) {
+			return false
+		}
+	}
+	return hasAllTags(b.Tags, q.Tags)
+}
+
+// after reports whether rec comes after the cursor in list order
+// (date DESC, created_at DESC, id DESC).
+func (c betCursor) after(rec PastBetRecord) bool {
+	switch {
+	case !rec.Date.Equal(c.Date):
+		return rec.Date.Before(c.Date)
+	case !rec.CreatedAt.Equal(c.CreatedAt):
+		return rec.CreatedAt.Before(c.CreatedAt)
+	}
+	return rec.ID < c.ID
+}
+
+/* ===================== Listing ====================== */
+
+type pastBetPage struct {
+	Bets       []PastBet      `json:"bets"`
+	NextCursor string         `json:"nextCursor,omitempty"`
+	Total      int64          `json:"total"`  // rows matching every filter
+	Counts     map[string]int `json:"counts"` // per betOutcomes + pending, ignoring the result filter
+}
+
+func listPastBetsDB(db *gorm.DB, userKey string, q pastBetQuery) (pastBetPage, error) {
+	page := pastBetPage{Bets: []PastBet{}, Counts: emptyResultCounts()}
+
+	if err := q.apply(db.Model(&PastBetRecord{}), userKey, true).Count(&page.Total).Error; err != nil {
+		return page, err
+	}
+
+	var counts []struct {
+		Result string
+		N      int
+	}
+	if err := q.apply(db.Model(&PastBetRecord{}), userKey, false).
+		Select("COALESCE(result, 'pending') AS result, COUNT(*) AS n").
+		Group("COALESCE(result, 'pending')").
+		Scan(&counts).Error; err != nil {
+		return page, err
+	}
+	for _, c := range counts {
+		page.Counts[c.Result] += c.N
+	}
+
+	rows, next, err := pastBetsPage(db, userKey, q)
+	if err != nil {
+		return page, err
+	}
+	if next != nil {
+		page.NextCursor = encodeCursor(*next)
+	}
+	for _, b := range rows {
+		page.Bets = append(page.Bets, b.public())
+	}
+	return page, nil
+}
+
+// pastBetsPage fetches one page (q.Limit rows after q.Cursor) with legs and
+// tags; next is nil on the last page.
+func pastBetsPage(db *gorm.DB, userKey string, q pastBetQuery) ([]betRow, *betCursor, error) {
+	rows := q.apply(db, userKey, true)
+	if c := q.Cursor; c != nil {
+		rows = rows.Where("(date, created_at, id) < (?, ?, ?)", c.Date, c.CreatedAt, c.ID)
+	}
+	var recs []PastBetRecord
+	if err := rows.Order("date DESC, created_at DESC, id DESC").Limit(q.Limit + 1).Find(&recs).Error; err != nil {
+		return nil, nil, err
+	}
+	var next *betCursor
+	if len(recs) > q.Limit {
+		c := cursorOf(recs[q.Limit-1])
+		next = &c
+		recs = recs[:q.Limit]
+	}
+	bets, err := loadBetRows(db, recs)
+	if err != nil {
+		return nil, nil, err
+	}
+	return bets, next, nil
+}
+
+// listRows is ListBets over rows already in list order (memory store).
+func listRows(rows []betRow, q pastBetQuery) pastBetPage {
+	page := pastBetPage{Bets: []PastBet{}, Counts: emptyResultCounts()}
+	var list []betRow
+	for _, b := range rows {
+		if q.matches(b, false) {
+			if b.Rec.Result == nil {
+				page.Counts["pending"]++
+			} else {
+				page.Counts[*b.Rec.Result]++
+			}
+		}
+		if q.matches(b, true) {
+			list = append(list, b)
+		}
+	}
+	page.Total = int64(len(list))
+	if c := q.Cursor; c != nil {
+		for len(list) > 0 && !c.after(list[0].Rec) {
+			list = list[1:]
+		}
+	}
+	if len(list) > q.Limit {
+		page.NextCursor = encodeCursor(cursorOf(list[q.Limit-1].Rec))
+		list = list[:q.Limit]
+	}
+	for _, b := range list {
+		page.Bets = append(page.Bets, b.public())
+	}
+	return page
+}
+
+// sortRows puts rows in list order.
+func sortRows(rows []betRow) {
+	sort.Slice(rows, func(i, j int) bool { return cursorOf(rows[i].Rec).after(rows[j].Rec) })
+}
+
+func emptyResultCounts() map[string]int {
+	c := map[string]int{"pending": 0}
+	for _, o := range betOutcomes {
+		c[o] = 0
+	}
+	return c
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/* ---------------- Prompt templates ---------------- */
+
+// promptTemplate is one frozen revision of the shared prompt blocks.
+// Once a version has been served, its wording must never change: add a new
+// version instead so results stay comparable across the experiment.
+type promptTemplate struct {
+	Version string
+	Rules   func(mode string) string
+	Payout  func(minOdds, maxOdds, boostPct float64, legs int, sport string) string
+}
+
+const defaultPromptVersion = "v1"
+
+var promptTemplates = map[string]promptTemplate{
+	// v1: the original wording.
+	"v1": {Version: "v1", Rules: sgpRules, Payout: payoutGuidance},
+	// v2: payout window is a hard constraint and every leg must carry a price.
+	"v2": {Version: "v2", Rules: sgpRules, Payout: payoutGuidanceV2},
+}
+
+// payoutGuidanceV2 is the v2 payout block: a stricter odds window and a
+// mandatory price on every leg. Its wording is written out in full rather than
+// built on payoutGuidance, so edits to v1 can't change a served version.
+func payoutGuidanceV2(minOdds, maxOdds, boostPct float64, legs int, sport string) string {
+	var b strings.Builder
+	b.WriteString("\nPayout estimation instructions:\n")
+	b.WriteString("- Convert each leg's American odds o to decimal multiple m: if o >= 0 then m = 1 + (o/100); if o < 0 then m = 1 + (100/|o|).\n")
+	b.WriteString(fmt.Sprintf("- Multiply all m across the %d legs to get parlayMultiple.\n", legs))
+	b.WriteString("- Apply an SGP correlation tax τ in [0.85, 0.95] (use 0.92 by default) → preBoostMultiple = parlayMultiple × τ.\n")
+	if boostPct > 0 {
+		b.WriteString(fmt.Sprintf("- Apply the sportsbook boost AFTER tax: postBoostMultiple = preBoostMultiple × (1 + %.0f/100).\n", boostPct))
+	} else {
+		b.WriteString("- No boost: postBoostMultiple = preBoostMultiple.\n")
+	}
+	b.WriteString("- Convert multiples to American odds (usually positive for parlays): american = '+' + round((multiple−1)×100).\n")
+	b.WriteString("- Populate \"estimatedPayout\" with preBoostMultiple, preBoostAmerican, postBoostMultiple, postBoostAmerican, and a one-line 'assumptions' summary (leg prices used, τ value, boost applied).\n")
+	b.WriteString("- Every leg MUST include \"odds\" as an American price (e.g., \"-110\", \"+145\"). Drop any leg you cannot price.\n")
+	if minOdds >= 100 || maxOdds >= 100 {
+		b.WriteString("- The POST-BOOST American payout MUST fall within ")
+		if minOdds >= 100 && maxOdds >= 100 {
+			b.WriteString(fmt.Sprintf("[+%.0f, +%.0f]", minOdds, maxOdds))
+		} else if minOdds >= 100 {
+			b.WriteString(fmt.Sprintf("[≥ +%.0f]", minOdds))
+		} else {
+			b.WriteString(fmt.Sprintf("[≤ +%.0f]", maxOdds))
+		}
+		b.WriteString(". Swap legs until it does; do not exceed the window.\n")
+	}
+	return b.String()
+}
+
+/* ---------------- Experiment assignment ---------------- */
+
+type promptArm struct {
+	Version string
+	Weight  int
+}
+
+// promptArms parses PROMPT_EXPERIMENT, e.g. "v1=50,v2=50".
+// Unknown versions and non-positive weights are ignored; empty => v1 only.
+func promptArms() []promptArm {
+	var arms []promptArm
+	for _, part := range strings.Split(os.Getenv("PROMPT_EXPERIMENT"), ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		ver, weight, found := strings.Cut(part, "=")
+		ver = strings.TrimSpace(ver)
+		w := 1
+		if found {
+			n, err := strconv.Atoi(strings.TrimSpace(weight))
+			if err != nil || n <= 0 {
+				continue
+			}
+			w = n
+		}
+		if _, ok := promptTemplates[ver]; !ok {
+			log.Printf("[prompts] PROMPT_EXPERIMENT: unknown version %q ignored", ver)
+			continue
+		}
+		arms = append(arms, promptArm{Version: ver, Weight: w})
+	}
+	if len(arms) == 0 {
+		return []promptArm{{Version: defaultPromptVersion, Weight: 1}}
+	}
+	sort.Slice(arms, func(i, j int) bool { return arms[i].Version < arms[j].Version })
+	return arms
+}
+
+// assignPromptTemplate picks the template for a request. An explicit, known
+// f.PromptVersion wins; otherwise signed-in users are bucketed by a stable
+// hash of (user, model) so they keep the same arm, and anonymous requests
+// are bucketed per request.
+func assignPromptTemplate(userKey string, f GenerateFilters) promptTemplate {
+	if tpl, ok := promptTemplates[strings.TrimSpace(f.PromptVersion)]; ok {
+		return tpl
+	}
+
+	arms := promptArms()
+	total := 0
+	for _, a := range arms {
+		total += a.Weight
+	}
+
+	var bucket uint64
+	if userKey != "" {
+		h := fnv.New64a()
+		h.Write([]byte(userKey + "|" + strings.ToLower(strings.TrimSpace(f.Model))))
+		bucket = h.Sum64() % uint64(total)
+	} else {
+		bucket = uint64(newSeed()) % uint64(total)
+	}
+
+	for _, a := range arms {
+		if bucket < uint64(a.Weight) {
+			return promptTemplates[a.Version]
+		}
+		bucket -= uint64(a.Weight)
+	}
+	return promptTemplates[defaultPromptVersion]
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Served prompt versions are frozen; a change here means a new version.
+func TestPayoutGuidanceV2Frozen(t *testing.T) {
+	want, err := os.ReadFile(filepath.Join("testdata", "prompts", "v2_payout.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := payoutGuidanceV2(200, 600, 25, 3, "NBA"); got != string(want) {
+		t.Errorf("v2 payout wording changed:\n%s", got)
+	}
+}
+
+func TestConsensusSlipPromptVersion(t *testing.T) {
+	seed := int64(3)
+	f := GenerateFilters{
+		Mode: "SGP", PromptVersion: "v2", Seed: &seed, CandidatePool: candidatePool(8),
+		// two Controlled Randomness aliases replay the pool without an LLM call
+		Ensemble: &ensembleOptions{Models: []string{"random", "controlled randomness"}},
+	}
+	slip, status, err := generateConsensusSlip(t.Context(), "ensemble-user", f)
+	if err != nil {
+		t.Fatalf("status %d: %v", status, err)
+	}
+	if slip.PromptVersion != "v2" {
+		t.Errorf("consensus slip prompt version %q, want v2", slip.PromptVersion)
+	}
+	for _, m := range slip.Members {
+		if m.Slip == nil || m.Slip.PromptVersion != "v2" {
+			t.Errorf("member %s: %+v", m.Model, m.Slip)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"example.com/go-api/odds"
+)
+
+/* ===================== Parlay settlement from leg results ====================== */
+
+// Leg results accepted on /api/past-bets/result. "" means ungraded.
+func normLegResult(s string) (string, bool) {
+	switch res := strings.ToLower(strings.TrimSpace(s)); res {
+	case "win", "loss", "push", "void", "":
+		return res, true
+	}
+	return "", false
+}
+
+// legResultIn grades one leg, addressed by leg id or by 0-based position.
+type legResultIn struct {
+	ID     string `json:"id,omitempty"`
+	Index  *int   `json:"index,omitempty"`
+	Result string `json:"result"`
+}
+
+// applyLegResults writes graded results onto legs (in place) and returns the
+// indexes it changed.
+func applyLegResults(legs []PastBetLeg, in []legResultIn) ([]int, error) {
+	changed := make([]int, 0, len(in))
+	for _, g := range in {
+		res, ok := normLegResult(g.Result)
+		if !ok {
+			return nil, fmt.Errorf("invalid leg result %q", g.Result)
+		}
+		idx := -1
+		switch {
+		case g.ID != "":
+			for i, l := range legs {
+				if l.ID == g.ID {
+					idx = i
+					break
+				}
+			}
+		case g.Index != nil && *g.Index >= 0 && *g.Index < len(legs):
+			idx = *g.Index
+		}
+		if idx < 0 {
+			return nil, errors.New("leg not found")
+		}
+		if res == "" {
+			legs[idx].Result = nil
+		} else {
+			r := res
+			legs[idx].Result = &r
+		}
+		changed = append(changed, idx)
+	}
+	return changed, nil
+}
+
+// settleParlay derives the bet outcome from its legs:
+//   - any losing leg loses the bet;
+//   - otherwise any ungraded leg leaves the bet pending ("");
+//   - a win with every leg standing pays the overall odds, the price the
+//     bet was placed at (SGP pricing and boosts make it differ from the
+//     product of the legs);
+//   - pushed/voided legs drop out and the rest is paid at the remaining
+//     legs' combined price; if every leg dropped out the bet is a push.
+//
+// When neither price is usable the win pays 0 units and ok is false.
+func settleParlay(legs []PastBetLeg, overallOdds string, stake float64, promo odds.Promo) (result string, units float64, ok bool) {
+	pending := false
+	var won []odds.Price
+	remaining, dropped := 0, 0
+	priced := true
+	for _, l := range legs {
+		res := ""
+		if l.Result != nil {
+			res = *l.Result
+		}
+		switch res {
+		case "loss":
+			return "loss", unitsForOutcome(overallOdds, "loss", stake, 0, promo), true
+		case "":
+			pending = true
+		case "push", "void":
+			dropped++
+		case "win":
+			remaining++
+			if p, ok := legPrice(l); ok {
+				won = append(won, p)
+			} else {
+				priced = false
+			}
+		}
+	}
+	switch {
+	case pending:
+		return "", 0, true
+	case remaining == 0:
+		return "push", 0, true
+	}
+	if dropped == 0 {
+		if p, ok := odds.ParseOK(overallOdds); ok {
+			return "win", odds.Units(p, stake, "win", promo), true
+		}
+	}
+	if priced {
+		return "win", odds.Units(odds.Parlay(won...), stake, "win", promo), true
+	}
+	return "win", 0, false
+}
+
+// legPrice prefers the stored canonical multiple and falls back to parsing
+// the price text (rows written before odds were canonicalized).
+func legPrice(l PastBetLeg) (odds.Price, bool) {
+	if p, err := odds.FromDecimal(l.OddsDecimal); err == nil {
+		return p, true
+	}
+	return odds.ParseOK(l.Odds)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"math"
+	"testing"
+
+	"example.com/go-api/odds"
+)
+
+func settleLeg(price, result string) PastBetLeg {
+	l := PastBetLeg{Odds: price}
+	if result != "" {
+		l.Result = &result
+	}
+	return l
+}
+
+func TestSettleParlay(t *testing.T) {
+	tests := []struct {
+		name    string
+		legs    []PastBetLeg
+		overall string
+		result  string
+		units   float64
+		ok      bool
+	}{
+		// -110 x -110 is +264, but the SGP was placed at +200
+		{"all win pays the placed price", []PastBetLeg{settleLeg("-110", "win"), settleLeg("-110", "win")}, "+200", "win", 2, true},
+		{"all win, overall unparseable", []PastBetLeg{settleLeg("+100", "win"), settleLeg("+100", "win")}, "n/a", "win", 3, true},
+		{"one leg pushed", []PastBetLeg{settleLeg("+150", "win"), settleLeg("-110", "push")}, "+400", "win", 1.5, true},
+		{"one leg voided", []PastBetLeg{settleLeg("+100", "win"), settleLeg("+100", "win"), settleLeg("-200", "void")}, "+500", "win", 3, true},
+		{"a loss", []PastBetLeg{settleLeg("+150", "win"), settleLeg("-110", "loss")}, "+400", "loss", -1, true},
+		{"pending leg", []PastBetLeg{settleLeg("+150", "win"), settleLeg("-110", "")}, "+400", "", 0, true},
+		{"every leg dropped", []PastBetLeg{settleLeg("+150", "push"), settleLeg("-110", "void")}, "+400", "push", 0, true},
+		{"unpriced leg, none dropped", []PastBetLeg{settleLeg("", "win"), settleLeg("+100", "win")}, "+300", "win", 3, true},
+		{"unpriced leg after a drop", []PastBetLeg{settleLeg("", "win"), settleLeg("+100", "push")}, "+300", "win", 0, false},
+	}
+	for _, tt := range tests {
+		result, units, ok := settleParlay(tt.legs, tt.overall, 1, odds.Promo{})
+		if result != tt.result || math.Abs(units-tt.units) > 1e-9 || ok != tt.ok {
+			t.Errorf("%s: got %q %v %v, want %q %v %v", tt.name, result, units, ok, tt.result, tt.units, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ===================== Generation result cache ======================
+Opt-in (filters.cache = true): an identical request from the same caller —
+same normalized filters, slate and prompt version — within
+GENERATE_CACHE_TTL_SEC reuses the earlier slip instead of paying for another
+LLM call. Unseeded Controlled Randomness draws are never cached, since a
+repeat is meant to draw again.
+*/
+
+var slipCacheTTL = time.Duration(envInt("GENERATE_CACHE_TTL_SEC", 300)) * time.Second
+
+type cachedSlip struct {
+	slip    betSlip
+	expires time.Time
+}
+
+var (
+	slipCacheMu sync.Mutex
+	slipCache   = map[string]cachedSlip{}
+)
+
+// slipCacheable reports whether a request may use the cache: not when a
+// Controlled Randomness draw (alone or in an ensemble) has no seed to replay.
+func slipCacheable(f GenerateFilters) bool {
+	if f.Seed != nil {
+		return true
+	}
+	models := []string{f.Model}
+	if f.Ensemble != nil {
+		models = registeredModels
+		if len(f.Ensemble.Models) > 0 {
+			models = f.Ensemble.Models
+		}
+	}
+	for _, m := range models {
+		if isControlledRandom(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// slipCacheKey hashes the caller scope (see callerScope) and the parts of
+// the filters that change the output. Case/whitespace differences and game
+// order don't matter.
+func slipCacheKey(scope string, f GenerateFilters) string {
+	norm := f
+	norm.Cache = false
+	norm.Sport = strings.ToUpper(strings.TrimSpace(f.Sport))
+	norm.Mode = normMode(f.Mode)
+	norm.Model = strings.ToLower(strings.TrimSpace(f.Model))
+	norm.Legs = legsForMode(f)
+	norm.Slips = 0 // we always produce one slip
+	if norm.Stake != nil {
+		norm.Stake = &stakeOptions{} // only its presence changes the prompt
+	}
+	norm.Games = append([]GameDTO(nil), f.Games...)
+	sort.Slice(norm.Games, func(i, j int) bool { return norm.Games[i].ID < norm.Games[j].ID })
+	for i := range norm.Games {
+		norm.Games[i].Label = "" // display only
+	}
+	if norm.Ensemble != nil {
+		e := *norm.Ensemble
+		e.Models = dedupeModels(e.Models)
+		for i := range e.Models {
+			e.Models[i] = strings.ToLower(e.Models[i])
+		}
+		sort.Strings(e.Models)
+		norm.Ensemble = &e
+	}
+	b, _ := json.Marshal(norm)
+	sum := sha256.Sum256(append([]byte(scope+"|"), b...))
+	return hex.EncodeToString(sum[:])
+}
+
+func getCachedSlip(key string) (betSlip, bool) {
+	slipCacheMu.Lock()
+	defer slipCacheMu.Unlock()
+	now := time.Now()
+	for k, c := range slipCache {
+		if now.After(c.expires) {
+			delete(slipCache, k)
+		}
+	}
+	c, ok := slipCache[key]
+	return c.slip, ok
+}
+
+func putCachedSlip(key string, slip betSlip) {
+	slipCacheMu.Lock()
+	defer slipCacheMu.Unlock()
+	slipCache[key] = cachedSlip{slip: slip, expires: time.Now().Add(slipCacheTTL)}
+}
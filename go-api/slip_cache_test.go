@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSlipCacheKeyScope(t *testing.T) {
+	f := GenerateFilters{Sport: "NBA", Model: "narrative"}
+	if slipCacheKey("user:a", f) == slipCacheKey("user:b", f) {
+		t.Errorf("two users share a cache key")
+	}
+	if slipCacheKey("user:a", f) != slipCacheKey("user:a", GenerateFilters{Sport: " nba", Model: "Narrative"}) {
+		t.Errorf("normalized filters should share a key")
+	}
+
+	a := httptest.NewRequest("POST", "/", nil)
+	a.RemoteAddr = "10.0.0.1:1234"
+	b := httptest.NewRequest("POST", "/", nil)
+	b.RemoteAddr = "10.0.0.2:1234"
+	if callerScope(a) == callerScope(b) {
+		t.Errorf("anonymous callers share a scope: %q", callerScope(a))
+	}
+	a.Header.Set("X-PP-User", "u1")
+	if got := callerScope(a); got != "user:u1" {
+		t.Errorf("callerScope = %q, want user:u1", got)
+	}
+}
+
+func TestSlipCacheable(t *testing.T) {
+	seed := int64(7)
+	tests := []struct {
+		name string
+		f    GenerateFilters
+		want bool
+	}{
+		{"persona", GenerateFilters{Model: "narrative"}, true},
+		{"random without seed", GenerateFilters{Model: "Random"}, false},
+		{"random with seed", GenerateFilters{Model: "random", Seed: &seed}, true},
+		{"default ensemble", GenerateFilters{Ensemble: &ensembleOptions{}}, false},
+		{"ensemble without random", GenerateFilters{Ensemble: &ensembleOptions{Models: []string{"weird", "micro"}}}, true},
+		{"ensemble with random", GenerateFilters{Ensemble: &ensembleOptions{Models: []string{"weird", "random"}}}, false},
+	}
+	for _, tt := range tests {
+		if got := slipCacheable(tt.f); got != tt.want {
+			t.Errorf("%s: slipCacheable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
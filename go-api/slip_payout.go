@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"example.com/go-api/odds"
+)
+
+// Correlation tax applied to parlays, matching the τ default in payoutGuidance.
+const sgpCorrelationTax = 0.92
+
+// computeSlipPayout recomputes the payout block server-side from leg prices,
+// using the same recipe the prompt asks the LLM to follow. Legs without a
+// parseable price are skipped and noted in the assumptions.
+func computeSlipPayout(legs []slipLeg, mode string, boostPct float64) *slipPayout {
+	var prices []odds.Price
+	skipped := 0
+	for _, lg := range legs {
+		p, ok := odds.ParseOK(lg.Odds)
+		if !ok {
+			skipped++
+			continue
+		}
+		prices = append(prices, p)
+	}
+	priced := len(prices)
+	if priced == 0 {
+		return nil
+	}
+	parlay := odds.Parlay(prices...).Decimal
+
+	tax := sgpCorrelationTax
+	if priced == 1 || strings.EqualFold(strings.TrimSpace(mode), "single") {
+		tax = 1
+	}
+	pre := parlay * tax
+	post := pre
+	if boostPct > 0 {
+		// the prompt's recipe boosts the whole multiple, not just the profit
+		post = pre * (1 + boostPct/100)
+	}
+
+	assumptions := fmt.Sprintf("%d priced leg(s), τ=%.2f, boost=%.0f%%", priced, tax, boostPct)
+	if skipped > 0 {
+		assumptions += fmt.Sprintf(", %d unpriced leg(s) ignored", skipped)
+	}
+	return &slipPayout{
+		PreBoostMultiple:  math.Round(pre*100) / 100,
+		PreBoostAmerican:  odds.Price{Decimal: pre}.American(),
+		PostBoostMultiple: math.Round(post*100) / 100,
+		PostBoostAmerican: odds.Price{Decimal: post}.American(),
+		Assumptions:       assumptions,
+	}
+}
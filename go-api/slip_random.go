@@ -0,0 +1,90 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	mrand "math/rand/v2"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/go-api/odds"
+)
+
+// How many candidates the Controlled Randomness model asks the LLM for.
+const randomPoolSize = 15
+
+// Candidates priced shorter than this are dropped before the draw ("heavy juice").
+const randomMaxJuice = -140
+
+func isControlledRandom(model string) bool {
+	switch strings.ToLower(strings.TrimSpace(model)) {
+	case "random", "controlled randomness", "controlled randomness (for exploration)":
+		return true
+	}
+	return false
+}
+
+// newSeed returns a fresh random seed; falls back to the clock if crypto/rand fails.
+func newSeed() int64 {
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err == nil {
+		return int64(binary.LittleEndian.Uint64(b[:]) >> 1)
+	}
+	return time.Now().UnixNano()
+}
+
+// drawLegs picks n candidates from pool with a PRNG seeded by seed, skipping
+// unpriced and heavy-juice candidates. Identical (pool, seed, n) always yields
+// identical picks; the returned indices point into pool and are in pool order.
+func drawLegs(pool []slipLeg, seed int64, n int) []int {
+	eligible := make([]int, 0, len(pool))
+	for i, lg := range pool {
+		p, ok := odds.ParseOK(lg.Odds)
+		if !ok || p.AmericanValue() < randomMaxJuice {
+			continue // unpriced or heavy juice
+		}
+		eligible = append(eligible, i)
+	}
+	if n > len(eligible) {
+		n = len(eligible)
+	}
+
+	rng := mrand.New(mrand.NewPCG(uint64(seed), uint64(seed)^0x9e3779b97f4a7c15))
+	rng.Shuffle(len(eligible), func(i, j int) { eligible[i], eligible[j] = eligible[j], eligible[i] })
+
+	picked := eligible[:n]
+	sort.Ints(picked)
+	return picked
+}
+
+// applySeededSelection replaces slip.Legs with a seeded draw from pool and
+// stamps the seed, pool and recomputed payout onto the slip.
+func applySeededSelection(slip *betSlip, pool []slipLeg, f GenerateFilters) {
+	seed := newSeed()
+	if f.Seed != nil {
+		seed = *f.Seed
+	}
+	pool = append([]slipLeg(nil), pool...)
+
+	legs := make([]slipLeg, 0)
+	for _, i := range drawLegs(pool, seed, legsForMode(f)) {
+		lg := pool[i]
+		note := fmt.Sprintf("pool #%d of %d, seed %d", i+1, len(pool), seed)
+		if strings.TrimSpace(lg.Notes) != "" {
+			note = lg.Notes + " — " + note
+		}
+		lg.Notes = note
+		legs = append(legs, lg)
+	}
+
+	slip.Legs = legs
+	slip.Seed = &seed
+	slip.CandidatePool = pool
+	slip.EstimatedPayout = computeSlipPayout(legs, f.Mode, f.BoostPct)
+	slip.CombinedOdds = ""
+	if slip.EstimatedPayout != nil {
+		slip.CombinedOdds = slip.EstimatedPayout.PreBoostAmerican
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestDrawLegsSkipsUnpricedAndJuice(t *testing.T) {
+	pool := []slipLeg{
+		{Pick: "a", Odds: "+150"},
+		{Pick: "b", Odds: ""},
+		{Pick: "c", Odds: "-200"},
+		{Pick: "d", Odds: "n/a"},
+		{Pick: "e", Odds: "-110"},
+	}
+	for seed := int64(0); seed < 20; seed++ {
+		got := drawLegs(pool, seed, 5)
+		if len(got) != 2 || got[0] != 0 || got[1] != 4 {
+			t.Fatalf("seed %d: drew %v, want only the priced legs [0 4]", seed, got)
+		}
+	}
+}
+
+func TestSeedReplayNeedsPool(t *testing.T) {
+	seed := int64(99)
+	_, status, err := generateSlip(t.Context(), "", GenerateFilters{Model: "random", Mode: "SGP", Seed: &seed})
+	if err == nil || status != http.StatusBadRequest {
+		t.Fatalf("seed without pool: status %d err %v, want 400", status, err)
+	}
+
+	pool := candidatePool(10)
+	f := GenerateFilters{Model: "random", Mode: "SGP", Seed: &seed, CandidatePool: pool}
+	a, status, err := generateSlip(t.Context(), "", f)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("replay: status %d err %v", status, err)
+	}
+	b, _, _ := generateSlip(t.Context(), "", f)
+	if len(a.Legs) == 0 || len(a.Legs) != len(b.Legs) {
+		t.Fatalf("replays drew %d and %d legs", len(a.Legs), len(b.Legs))
+	}
+	for i := range a.Legs {
+		if a.Legs[i].Pick != b.Legs[i].Pick {
+			t.Errorf("leg %d: %s then %s", i, a.Legs[i].Pick, b.Legs[i].Pick)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+)
+
+/* ===================== Sportsbooks ======================
+The managed list of books a bet can be attributed to. Bets store the id;
+names and aliases only matter for input. SPORTSBOOKS_EXTRA adds local books
+as "id=Display Name,id2=Other Name".
+*/
+
+type sportsbook struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Aliases []string `json:"-"`
+}
+
+const otherBook = "other"
+
+var sportsbooks = loadSportsbooks()
+
+func loadSportsbooks() []sportsbook {
+	books := []sportsbook{
+		{ID: "draftkings", Name: "DraftKings", Aliases: []string{"dk"}},
+		{ID: "fanduel", Name: "FanDuel", Aliases: []string{"fd"}},
+		{ID: "betmgm", Name: "BetMGM", Aliases: []string{"mgm"}},
+		{ID: "caesars", Name: "Caesars", Aliases: []string{"czr", "william hill"}},
+		{ID: "espnbet", Name: "ESPN BET", Aliases: []string{"espn", "penn", "barstool"}},
+		{ID: "fanatics", Name: "Fanatics"},
+		{ID: "bet365", Name: "bet365"},
+		{ID: "betrivers", Name: "BetRivers", Aliases: []string{"rivers", "sugarhouse"}},
+		{ID: "hardrock", Name: "Hard Rock Bet", Aliases: []string{"hard rock"}},
+		{ID: "pinnacle", Name: "Pinnacle"},
+	}
+	for _, part := range strings.Split(os.Getenv("SPORTSBOOKS_EXTRA"), ",") {
+		id, name, ok := strings.Cut(part, "=")
+		id = strings.ToLower(strings.TrimSpace(id))
+		if !ok || id == "" || id == otherBook {
+			continue
+		}
+		books = append(books, sportsbook{ID: id, Name: strings.TrimSpace(name)})
+	}
+	return append(books, sportsbook{ID: otherBook, Name: "Other"})
+}
+
+// normSportsbook maps an id, display name or alias to a book id. "" stays
+// "" (unattributed); ok is false for books not on the list.
+func normSportsbook(s string) (string, bool) {
+	key := strings.ToLower(strings.TrimSpace(s))
+	if key == "" {
+		return "", true
+	}
+	squash := strings.NewReplacer(" ", "", "-", "", "_", "").Replace(key)
+	for _, b := range sportsbooks {
+		if key == b.ID || squash == b.ID || key == strings.ToLower(b.Name) || containsFold(b.Aliases, key) {
+			return b.ID, true
+		}
+	}
+	return "", false
+}
+
+// GET /api/sportsbooks
+func handleListSportsbooks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"sportsbooks": sportsbooks})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"example.com/go-api/odds"
+)
+
+/* ===================== Staking ======================
+Kelly sizing from a price and an estimated win probability:
+
+	f* = (b·p − q) / b     b = decimal − 1, q = 1 − p
+
+Half and quarter Kelly scale f* down; flat stakes ignore it. Every option is
+capped at maxPct of the bankroll (and maxUnits when given). Bankroll and unit
+size default to the user's ledger (bankroll.go); without one, stakes are
+sized against defaultBankrollUnits units.
+*/
+
+const (
+	defaultStakeMaxPct   = 0.05 // never suggest more than 5% of the bankroll
+	defaultBankrollUnits = 100.0
+	defaultStakeStrategy = "quarter"
+)
+
+var stakeStrategies = map[string]float64{"kelly": 1, "half": 0.5, "quarter": 0.25, "flat": 0}
+
+// stakeOptions are the caller's staking inputs; zero values mean "default".
+type stakeOptions struct {
+	WinProb   *float64 `json:"winProb,omitempty"`   // 0–1 (or a percentage); slips fall back to the model's estimate
+	Strategy  string   `json:"strategy,omitempty"`  // kelly | half | quarter | flat (default quarter)
+	Bankroll  float64  `json:"bankroll,omitempty"`  // money; default: ledger balance
+	UnitSize  float64  `json:"unitSize,omitempty"`  // money per unit; default: ledger unit size
+	MaxPct    float64  `json:"maxPct,omitempty"`    // cap as a fraction of bankroll (0.05 = 5%)
+	MaxUnits  float64  `json:"maxUnits,omitempty"`  // optional cap in units
+	FlatUnits float64  `json:"flatUnits,omitempty"` // flat stake (default 1 unit)
+}
+
+type stakeOption struct {
+	Strategy   string   `json:"strategy"`
+	Fraction   float64  `json:"fraction"` // of bankroll, after caps
+	StakeUnits float64  `json:"stakeUnits"`
+	StakeMoney *float64 `json:"stakeMoney,omitempty"` // only when the bankroll is in money
+	Capped     bool     `json:"capped,omitempty"`
+}
+
+type stakeAdvice struct {
+	Odds          string        `json:"odds"`
+	ImpliedProb   float64       `json:"impliedProb"`
+	WinProb       float64       `json:"winProb"`
+	EdgePct       float64       `json:"edgePct"`       // expected return per unit staked, in percent
+	KellyFraction float64       `json:"kellyFraction"` // full Kelly, uncapped; 0 without an edge
+	Bankroll      float64       `json:"bankroll"`
+	UnitSize      float64       `json:"unitSize,omitempty"`
+	Recommended   stakeOption   `json:"recommended"`
+	Options       []stakeOption `json:"options"`
+	Note          string        `json:"note,omitempty"`
+}
+
+// normProb accepts 0–1 or a percentage.
+func normProb(p float64) (float64, error) {
+	if p > 1 && p <= 100 {
+		p /= 100
+	}
+	if p <= 0 || p >= 1 {
+		return 0, errors.New("winProb must be between 0 and 1 (exclusive)")
+	}
+	return p, nil
+}
+
+// kellyFraction is full Kelly for price at win probability p (0 without an edge).
+func kellyFraction(price odds.Price, p float64) float64 {
+	b := price.Profit()
+	if b <= 0 {
+		return 0
+	}
+	return math.Max(0, (b*p-(1-p))/b)
+}
+
+// adviseStake sizes a bet. bankroll/unitSize are in money; unitSize 0 means
+// the bankroll is already in units.
+func adviseStake(price odds.Price, p float64, o stakeOptions, bankroll, unitSize float64) stakeAdvice {
+	strategy := strings.ToLower(strings.TrimSpace(o.Strategy))
+	if _, ok := stakeStrategies[strategy]; !ok {
+		strategy = defaultStakeStrategy
+	}
+	maxPct := o.MaxPct
+	if maxPct <= 0 || maxPct > 1 {
+		maxPct = defaultStakeMaxPct
+	}
+	flat := o.FlatUnits
+	if flat <= 0 {
+		flat = 1
+	}
+	perUnit := unitSize
+	if perUnit <= 0 {
+		perUnit = 1
+	}
+	bankrollUnits := bankroll / perUnit
+
+	full := kellyFraction(price, p)
+	adv := stakeAdvice{
+		Odds:          price.American(),
+		ImpliedProb:   round4(price.ImpliedProb()),
+		WinProb:       round4(p),
+		EdgePct:       round2((p*price.Decimal - 1) * 100),
+		KellyFraction: round4(full),
+		Bankroll:      round2(bankroll),
+		UnitSize:      unitSize,
+	}
+	if full == 0 {
+		adv.Note = "no edge at this price: Kelly stakes are 0"
+	}
+
+	for _, name := range []string{"kelly", "half", "quarter", "flat"} {
+		frac := full * stakeStrategies[name]
+		if name == "flat" && bankrollUnits > 0 {
+			frac = flat / bankrollUnits
+		}
+		opt := stakeOption{Strategy: name}
+		if frac > maxPct {
+			frac, opt.Capped = maxPct, true
+		}
+		units := frac * bankrollUnits
+		if o.MaxUnits > 0 && units > o.MaxUnits {
+			units, opt.Capped = o.MaxUnits, true
+			frac = units / bankrollUnits
+		}
+		opt.Fraction = round4(frac)
+		opt.StakeUnits = round2(units)
+		if unitSize > 0 {
+			m := round2(units * unitSize)
+			opt.StakeMoney = &m
+		}
+		adv.Options = append(adv.Options, opt)
+		if name == strategy {
+			adv.Recommended = opt
+		}
+	}
+	return adv
+}
+
+func round4(v float64) float64 { return math.Round(v*10000) / 10000 }
+
+// stakeContext resolves bankroll and unit size: explicit options first, then
+// the user's ledger, then defaultBankrollUnits in units.
+func stakeContext(r *http.Request, userKey string, o stakeOptions) (bankroll, unitSize float64, err error) {
+	bankroll, unitSize = o.Bankroll, o.UnitSize
+	if (bankroll <= 0 || unitSize <= 0) && userKey != "" {
+		ledger, err := loadLedger(r.Context(), userKey)
+		if err != nil {
+			return 0, 0, err
+		}
+		if unitSize <= 0 {
+			unitSize = ledger.unitSizeAt(time.Now().UTC())
+		}
+		if bankroll <= 0 && len(ledger) > 0 {
+			bets, err := loadSettledUnits(r.Context(), userKey)
+			if err != nil {
+				return 0, 0, err
+			}
+			if s := bankrollSeries(ledger, bets); len(s) > 0 {
+				bankroll = s[len(s)-1].Balance
+			}
+		}
+	}
+	if bankroll <= 0 {
+		if unitSize > 0 {
+			bankroll = defaultBankrollUnits * unitSize
+		} else {
+			bankroll = defaultBankrollUnits
+		}
+	}
+	return bankroll, unitSize, nil
+}
+
+// POST /api/stake/suggest
+//
+//	{ "odds": "+150", "winProb": 0.45, "strategy"?: "half", "bankroll"?: 1000, "unitSize"?: 10,
+//	  "maxPct"?: 0.05, "maxUnits"?: 3, "flatUnits"?: 1 }
+func handleSuggestStake(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		Odds string `json:"odds"`
+		stakeOptions
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		errorJSON(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	price, ok := odds.ParseOK(in.Odds)
+	if !ok {
+		errorJSON(w, http.StatusBadRequest, "odds: unrecognized price")
+		return
+	}
+	if in.WinProb == nil {
+		errorJSON(w, http.StatusBadRequest, "winProb is required")
+		return
+	}
+	p, err := normProb(*in.WinProb)
+	if err != nil {
+		errorJSON(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	bankroll, unitSize, err := stakeContext(r, userKeyFromRequest(r), in.stakeOptions)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, adviseStake(price, p, in.stakeOptions, bankroll, unitSize))
+}
+
+// suggestSlipStake fills slip.SuggestedStake when staking was requested and
+// both a price and a win probability (caller's, else the model's) exist.
+func suggestSlipStake(r *http.Request, userKey string, f GenerateFilters, slip *betSlip) error {
+	if f.Stake == nil {
+		return nil
+	}
+	prob := f.Stake.WinProb
+	if prob == nil {
+		prob = slip.WinProbability
+	}
+	if prob == nil {
+		return nil
+	}
+	p, err := normProb(*prob)
+	if err != nil {
+		return nil // an out-of-range model estimate just means no suggestion
+	}
+	price, ok := slipPrice(*slip, f)
+	if !ok {
+		return nil
+	}
+	bankroll, unitSize, err := stakeContext(r, userKey, *f.Stake)
+	if err != nil {
+		return err
+	}
+	adv := adviseStake(price, p, *f.Stake, bankroll, unitSize)
+	slip.SuggestedStake = &adv
+	return nil
+}
+
+// slipPrice is the slip's payable price: post-boost payout, then the quoted
+// combined odds, then a recomputation from the legs.
+func slipPrice(slip betSlip, f GenerateFilters) (odds.Price, bool) {
+	if ep := slip.EstimatedPayout; ep != nil {
+		if p, ok := odds.ParseOK(ep.PostBoostAmerican); ok {
+			return p, true
+		}
+	}
+	if p, ok := odds.ParseOK(slip.CombinedOdds); ok {
+		return p, true
+	}
+	if ep := computeSlipPayout(slip.Legs, f.Mode, f.BoostPct); ep != nil {
+		return odds.ParseOK(ep.PostBoostAmerican)
+	}
+	return odds.Price{}, false
+}
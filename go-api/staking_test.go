@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/go-api/odds"
+)
+
+func TestNormProb(t *testing.T) {
+	for in, want := range map[float64]float64{0.55: 0.55, 55: 0.55, 2: 0.02, 99.5: 0.995} {
+		if got, err := normProb(in); err != nil || math.Abs(got-want) > 1e-12 {
+			t.Errorf("normProb(%v) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []float64{0, 1, 100, 150, -0.2} {
+		if _, err := normProb(in); err == nil {
+			t.Errorf("normProb(%v) accepted", in)
+		}
+	}
+}
+
+func TestKellyFraction(t *testing.T) {
+	even, _ := odds.ParseOK("+100")
+	plus150, _ := odds.ParseOK("+150")
+	minus110, _ := odds.ParseOK("-110")
+	tests := []struct {
+		name  string
+		price odds.Price
+		p     float64
+		want  float64
+	}{
+		{"even money, 55%", even, 0.55, 0.1},
+		{"+150, 45%", plus150, 0.45, (1.5*0.45 - 0.55) / 1.5},
+		{"-110, 55%", minus110, 0.55, (100.0/110*0.55 - 0.45) / (100.0 / 110)},
+		{"no edge", even, 0.5, 0},
+		{"negative edge", minus110, 0.5, 0},
+		{"invalid price", odds.Price{}, 0.6, 0},
+	}
+	for _, tt := range tests {
+		if got := kellyFraction(tt.price, tt.p); math.Abs(got-tt.want) > 1e-12 {
+			t.Errorf("%s: kellyFraction = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestAdviseStake(t *testing.T) {
+	even, _ := odds.ParseOK("+100")
+	// 1000 money at 10 per unit is 100 units; full Kelly 8% is capped at 5%
+	adv := adviseStake(even, 0.54, stakeOptions{}, 1000, 10)
+	want := map[string]struct {
+		units, money float64
+		capped       bool
+	}{
+		"kelly":   {5, 50, true},
+		"half":    {4, 40, false},
+		"quarter": {2, 20, false},
+		"flat":    {1, 10, false},
+	}
+	if len(adv.Options) != 4 {
+		t.Fatalf("options: %+v", adv.Options)
+	}
+	for _, o := range adv.Options {
+		w := want[o.Strategy]
+		if o.StakeUnits != w.units || o.StakeMoney == nil || *o.StakeMoney != w.money || o.Capped != w.capped {
+			t.Errorf("%s: %+v, want %v units / %v money capped=%v", o.Strategy, o, w.units, w.money, w.capped)
+		}
+	}
+	if adv.Recommended.Strategy != "quarter" || adv.KellyFraction != 0.08 || adv.EdgePct != 8 || adv.Note != "" {
+		t.Errorf("advice: %+v", adv)
+	}
+
+	// caps from the caller, bankroll in units
+	adv = adviseStake(even, 0.55, stakeOptions{Strategy: "Half", MaxPct: 0.02, MaxUnits: 1.5, FlatUnits: 3}, 100, 0)
+	for _, o := range adv.Options {
+		if o.StakeMoney != nil {
+			t.Errorf("%s: money %v without a unit size", o.Strategy, *o.StakeMoney)
+		}
+		if o.StakeUnits > 1.5 || !o.Capped {
+			t.Errorf("%s: %+v, want capped at 1.5 units", o.Strategy, o)
+		}
+	}
+	if adv.Recommended.Strategy != "half" {
+		t.Errorf("recommended %q, want half", adv.Recommended.Strategy)
+	}
+
+	// no edge: Kelly options stake nothing, flat still stakes
+	adv = adviseStake(even, 0.45, stakeOptions{Strategy: "kelly"}, 100, 0)
+	if adv.KellyFraction != 0 || adv.EdgePct >= 0 || adv.Note == "" || adv.Recommended.StakeUnits != 0 {
+		t.Errorf("no edge: %+v", adv)
+	}
+	if flat := adv.Options[3]; flat.Strategy != "flat" || flat.StakeUnits != 1 {
+		t.Errorf("no edge flat: %+v", flat)
+	}
+}
+
+func TestSuggestStakeHandler(t *testing.T) {
+	post := func(body string) (int, stakeAdvice, string) {
+		w := httptest.NewRecorder()
+		handleSuggestStake(w, httptest.NewRequest(http.MethodPost, "/api/stake/suggest", strings.NewReader(body)))
+		var adv stakeAdvice
+		_ = json.Unmarshal(w.Body.Bytes(), &adv)
+		return w.Code, adv, w.Body.String()
+	}
+	// probability as a percentage, explicit bankroll and unit size
+	code, adv, body := post(`{"odds":"+100","winProb":55,"strategy":"quarter","bankroll":1000,"unitSize":10}`)
+	if code != http.StatusOK || adv.WinProb != 0.55 || adv.Recommended.StakeUnits != 2.5 {
+		t.Errorf("status %d: %s", code, body)
+	}
+	for _, bad := range []string{`{"odds":"+100"}`, `{"odds":"nope","winProb":0.5}`, `{"odds":"+100","winProb":150}`} {
+		if code, _, body := post(bad); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d %s, want 400", bad, code, body)
+		}
+	}
+}
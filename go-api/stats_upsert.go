@@ -1,8 +1,12 @@
 package main
 
 import (
-	"gorm.io/gorm"
+	"sort"
 	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Normalize mode to canonical values: "Single" | "SGP" | "SGP+" | "ALL"
@@ -19,81 +23,149 @@ func normMode(in string) string {
 	}
 }
 
-// Update/create ONE aggregate row for (user, model, sport, mode).
-func upsertOneMode(
-	db *gorm.DB,
-	userKey, model, sport, mode, prev, next string,
-	prevUnits, nextUnits float64,
-) error {
-	var s UserModelStat
-	err := db.Where(&UserModelStat{
-		UserKey: userKey, Model: model, Sport: sport, Mode: mode,
-	}).First(&s).Error
-	if err == gorm.ErrRecordNotFound {
-		s = UserModelStat{UserKey: userKey, Model: model, Sport: sport, Mode: mode}
-	} else if err != nil {
-		return err
-	}
+// statDelta is what one or more grading transitions change in a UserModelStat row.
+type statDelta struct {
+	Bets, Wins, Losses, Pushes int
+	Units                      float64
+}
 
-	// Count a bet only when it transitions from ungraded -> graded
+type statKey struct{ UserKey, Model, Sport, Mode string }
+
+// transitionDelta is the change for one bet going from prev to next.
+func transitionDelta(prev, next string, prevUnits, nextUnits float64) statDelta {
+	var d statDelta
+	// Count a bet only while it is graded
 	if next != "" && prev == "" {
-		s.Bets += 1
+		d.Bets = 1
+	} else if next == "" && prev != "" {
+		d.Bets = -1
+	}
+	// Adjust W/L/P tallies based on transition (see tallyOf)
+	if pt, nt := tallyOf(prev, prevUnits), tallyOf(next, nextUnits); pt != nt {
+		d.addTally(pt, -1)
+		d.addTally(nt, +1)
 	}
+	// Units delta (new - old)
+	d.Units = nextUnits - prevUnits
+	return d
+}
 
-	// Adjust W/L/P tallies based on transition
-	if prev == "" && next == "" {
-		// nothing
-	} else if prev == "" && next != "" {
-		switch next {
-		case "win":
-			s.Wins += 1
-		case "loss":
-			s.Losses += 1
-		case "push":
-			s.Pushes += 1
-		}
-	} else if prev != next {
-		switch prev {
-		case "win":
-			s.Wins -= 1
-		case "loss":
-			s.Losses -= 1
-		case "push":
-			s.Pushes -= 1
-		}
-		switch next {
-		case "win":
-			s.Wins += 1
-		case "loss":
-			s.Losses += 1
-		case "push":
-			s.Pushes += 1
-		}
+func (d *statDelta) addTally(tally string, n int) {
+	switch tally {
+	case "win":
+		d.Wins += n
+	case "loss":
+		d.Losses += n
+	case "push":
+		d.Pushes += n
 	}
+}
 
-	// Units delta (new - old)
-	s.Units += (nextUnits - prevUnits)
+func (d *statDelta) plus(o statDelta) {
+	d.Bets += o.Bets
+	d.Wins += o.Wins
+	d.Losses += o.Losses
+	d.Pushes += o.Pushes
+	d.Units += o.Units
+}
+
+// applyStatDelta adds d to one aggregate row in a single upsert, so
+// concurrent writers to the same row cannot lose each other's updates.
+func applyStatDelta(db *gorm.DB, k statKey, d statDelta) error {
+	s := UserModelStat{UserKey: k.UserKey, Model: k.Model, Sport: k.Sport, Mode: k.Mode}
+	s.add(d)
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_key"}, {Name: "model"}, {Name: "sport"}, {Name: "mode"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"bets":   gorm.Expr("user_model_stats.bets + ?", d.Bets),
+			"wins":   gorm.Expr("user_model_stats.wins + ?", d.Wins),
+			"losses": gorm.Expr("user_model_stats.losses + ?", d.Losses),
+			"pushes": gorm.Expr("user_model_stats.pushes + ?", d.Pushes),
+			"units":  gorm.Expr("user_model_stats.units + ?", d.Units),
+			// the right-hand sides all see the row as it was before this update
+			"roi_pct": gorm.Expr("CASE WHEN user_model_stats.bets + ? > 0 THEN (user_model_stats.units + ?) / (user_model_stats.bets + ?) * 100.0 ELSE 0 END",
+				d.Bets, d.Units, d.Bets),
+			"updated_at": time.Now(),
+		}),
+	}).Create(&s).Error
+}
+
+func (s *UserModelStat) add(d statDelta) {
+	s.Bets += d.Bets
+	s.Wins += d.Wins
+	s.Losses += d.Losses
+	s.Pushes += d.Pushes
+	s.Units += d.Units
 	if s.Bets > 0 {
 		s.RoiPct = (s.Units / float64(s.Bets)) * 100.0
 	} else {
 		s.RoiPct = 0
 	}
+}
+
+// statDeltas batches transitions so each affected row is written once.
+type statDeltas map[statKey]*statDelta
 
-	return db.Save(&s).Error
+// add records a transition for the per-mode row and the ALL row.
+func (m statDeltas) add(userKey, model, sport, mode, prev, next string, prevUnits, nextUnits float64) {
+	d := transitionDelta(prev, next, prevUnits, nextUnits)
+	for _, md := range []string{normMode(mode), "ALL"} {
+		k := statKey{userKey, model, sport, md}
+		if m[k] == nil {
+			m[k] = &statDelta{}
+		}
+		m[k].plus(d)
+	}
 }
 
-// Public helper: update BOTH the per-mode row and the ALL row.
-// mode should be "Single" | "SGP" | "SGP+" (we'll also write "ALL").
-func upsertUserModelStat(
-	db *gorm.DB,
-	userKey, model, sport, mode, prev, next string,
-	prevUnits, nextUnits float64,
-) error {
-	cMode := normMode(mode)
-	// per-mode row
-	if err := upsertOneMode(db, userKey, model, sport, cMode, prev, next, prevUnits, nextUnits); err != nil {
-		return err
+// addBet counts a graded bet into (+1) or out of (-1) its rows; ungraded
+// bets change nothing.
+func (m statDeltas) addBet(rec PastBetRecord, sign int) {
+	if rec.Result == nil {
+		return
+	}
+	var units float64
+	if rec.ResultUnits != nil {
+		units = *rec.ResultUnits
+	}
+	if sign > 0 {
+		m.add(rec.UserKey, rec.Model, rec.Sport, rec.Type, "", *rec.Result, 0, units)
+	} else {
+		m.add(rec.UserKey, rec.Model, rec.Sport, rec.Type, *rec.Result, "", units, 0)
+	}
+}
+
+// keys lists the rows in a fixed order, so concurrent batches take the
+// upserts' row locks in the same order and cannot deadlock.
+func (m statDeltas) keys() []statKey {
+	keys := make([]statKey, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.UserKey != b.UserKey {
+			return a.UserKey < b.UserKey
+		}
+		if a.Model != b.Model {
+			return a.Model < b.Model
+		}
+		if a.Sport != b.Sport {
+			return a.Sport < b.Sport
+		}
+		return a.Mode < b.Mode
+	})
+	return keys
+}
+
+// flush writes every changed row once.
+func (m statDeltas) flush(db *gorm.DB) error {
+	for _, k := range m.keys() {
+		if d := m[k]; *d != (statDelta{}) {
+			if err := applyStatDelta(db, k, *d); err != nil {
+				return err
+			}
+		}
 	}
-	// ALL row (keeps your existing "ALL-time" aggregates working)
-	return upsertOneMode(db, userKey, model, sport, "ALL", prev, next, prevUnits, nextUnits)
+	return nil
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"errors"
+)
+
+/* ===================== Storage ======================
+Store is everything the handlers persist about users, bets (with legs and
+tags), model stats and bankroll ledgers. pgStore (store_postgres.go) is the production
+backend; memStore (store_memory.go) keeps the same data in process so the
+server runs without Postgres for demos and tests. Both must pass
+the conformance suite in store_test.go. Bet changes append a BetEvent
+(bet_events.go) in the same write; the actor comes from ctx (withActor).
+
+Idempotency keys are per process either way.
+*/
+
+var (
+	errNotFound = errors.New("not found")
+	errConflict = errors.New("already exists")
+	// errRolledBack is returned by GradeBets when an atomic batch had a
+	// failing item; the per-item results say which.
+	errRolledBack = errors.New("batch rolled back")
+)
+
+// store is the backend chosen at startup (see main).
+var store Store = newMemStore()
+
+// betRow is a stored bet with its legs (in position order) and tag names (sorted).
+type betRow struct {
+	Rec  PastBetRecord
+	Legs []PastBetLeg
+	Tags []string
+}
+
+func (b betRow) public() PastBet {
+	out := toPublic(b.Rec, b.Legs)
+	out.Tags = b.Tags
+	return out
+}
+
+// gradeResult is the outcome of one GradeBets item: G is valid when Err is nil.
+type gradeResult struct {
+	G   graded
+	Err error // errNotFound, *badRequestError or a storage error
+}
+
+type Store interface {
+	// Users. Emails are matched case-insensitively.
+	CreateUser(ctx context.Context, u *User) error // errConflict when the email is taken
+	UserByID(ctx context.Context, id string) (User, error)
+	UserByEmail(ctx context.Context, email string) (User, error)
+
+	// CreateBets saves bets with their legs and tags, all or nothing. Graded
+	// bets count toward the stats. Zero CreatedAt is set to now.
+	CreateBets(ctx context.Context, bets []betRow) error
+	GetBet(ctx context.Context, userKey, id string) (betRow, error)
+	// ListBets is one page of the history list (see pastBetQuery).
+	ListBets(ctx context.Context, userKey string, q pastBetQuery) (pastBetPage, error)
+	// EachBet hands every bet matching q (cursor and limit ignored) to fn in
+	// list order, a batch at a time.
+	EachBet(ctx context.Context, userKey string, q pastBetQuery, fn func([]betRow) error) error
+	// EachBetRecord streams the record of every bet matching q to fn, one at
+	// a time and without legs, tags or ToolTranscript, for aggregates over
+	// the whole history that need nothing else.
+	EachBetRecord(ctx context.Context, userKey string, q pastBetQuery, fn func(PastBetRecord) error) error
+	// UpdateBet runs fn on the stored bet and saves the record, leg fields
+	// and tags it leaves behind (fn must not add or remove legs). A graded
+	// bet's stats contribution moves with it. An error from fn aborts.
+	UpdateBet(ctx context.Context, userKey, id string, fn func(*betRow) error) (betRow, error)
+	DeleteBet(ctx context.Context, userKey, id string) error
+	// GradeBets applies items in order in one transaction and writes each
+	// affected stats row once. Atomic batches save nothing if any item fails
+	// (errRolledBack); best-effort batches save the items that worked.
+	GradeBets(ctx context.Context, userKey string, items []gradeInput, bestEffort bool) ([]gradeResult, error)
+
+	// Tags with their bet counts, most used first; DeleteTag unlinks a tag
+	// from every bet.
+	ListTags(ctx context.Context, userKey string) ([]tagRow, error)
+	DeleteTag(ctx context.Context, userKey, name string) error
+
+	// BetEvents is a bet's history, oldest first (empty if it has none).
+	BetEvents(ctx context.Context, userKey, betID string) ([]BetEvent, error)
+
+	// ModelStats are the aggregate rows for one mode ("ALL" included).
+	ModelStats(ctx context.Context, userKey, mode string) ([]UserModelStat, error)
+
+	// Bankroll ledger, listed in ledger order (see sortLedger). Adding sets
+	// a zero CreatedAt to now.
+	BankrollEntries(ctx context.Context, userKey string) ([]BankrollEntry, error)
+	AddBankrollEntry(ctx context.Context, e *BankrollEntry) error
+	DeleteBankrollEntry(ctx context.Context, userKey, id string) error // errNotFound for another user's entry
+
+	// ResetUser deletes the user's bets, legs, tags, history, stats and
+	// bankroll entries (not the user).
+	ResetUser(ctx context.Context, userKey string) error
+}
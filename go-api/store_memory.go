@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ===================== Memory store ======================
+Keeps the same records as pgStore in maps, for running without Postgres.
+Rows are copied in and out so callers never share slices with the store.
+Nothing survives a restart.
+*/
+
+type memStore struct {
+	mu      sync.Mutex
+	users   map[string]User            // by id
+	bets    map[string][]betRow        // userKey -> rows in list order
+	tags    map[string]map[string]bool // userKey -> tag names in use or kept
+	events  map[string][]BetEvent      // userKey -> history, append order
+	ledger  map[string][]BankrollEntry // userKey -> entries in ledger order
+	stats   map[statKey]UserModelStat
+	statID  uint
+	eventID uint
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		users:  map[string]User{},
+		bets:   map[string][]betRow{},
+		tags:   map[string]map[string]bool{},
+		events: map[string][]BetEvent{},
+		ledger: map[string][]BankrollEntry{},
+		stats:  map[statKey]UserModelStat{},
+	}
+}
+
+func copyRow(b betRow) betRow {
+	b.Legs = append([]PastBetLeg(nil), b.Legs...)
+	b.Tags = append([]string(nil), b.Tags...)
+	if len(b.Legs) == 0 {
+		b.Legs = nil
+	}
+	if len(b.Tags) == 0 {
+		b.Tags = nil
+	}
+	return b
+}
+
+/* ---------------- Users ---------------- */
+
+func (s *memStore) CreateUser(_ context.Context, u *User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u.Email = strings.ToLower(strings.TrimSpace(u.Email))
+	for _, x := range s.users {
+		if x.Email == u.Email {
+			return errConflict
+		}
+	}
+	if _, ok := s.users[u.ID]; ok {
+		return errConflict
+	}
+	now := time.Now()
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = now
+	}
+	u.UpdatedAt = now
+	s.users[u.ID] = *u
+	return nil
+}
+
+func (s *memStore) UserByID(_ context.Context, id string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		return u, nil
+	}
+	return User{}, errNotFound
+}
+
+func (s *memStore) UserByEmail(_ context.Context, email string) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	email = strings.ToLower(strings.TrimSpace(email))
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, nil
+		}
+	}
+	return User{}, errNotFound
+}
+
+/* ---------------- Bets ---------------- */
+
+// find returns the index of a user's bet, or -1.
+func (s *memStore) find(userKey, id string) int {
+	for i, b := range s.bets[userKey] {
+		if b.Rec.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *memStore) addTags(userKey string, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	if s.tags[userKey] == nil {
+		s.tags[userKey] = map[string]bool{}
+	}
+	for _, n := range names {
+		s.tags[userKey][n] = true
+	}
+}
+
+func (s *memStore) appendEvents(events ...BetEvent) {
+	for _, e := range events {
+		s.eventID++
+		e.ID = s.eventID
+		s.events[e.UserKey] = append(s.events[e.UserKey], e)
+	}
+}
+
+// flush is statDeltas.flush for the memory store.
+func (s *memStore) flush(m statDeltas) {
+	for _, k := range m.keys() {
+		d := m[k]
+		if *d == (statDelta{}) {
+			continue
+		}
+		row, ok := s.stats[k]
+		if !ok {
+			s.statID++
+			now := time.Now()
+			row = UserModelStat{ID: s.statID, UserKey: k.UserKey, Model: k.Model, Sport: k.Sport, Mode: k.Mode, CreatedAt: now}
+		}
+		row.add(*d)
+		row.UpdatedAt = time.Now()
+		s.stats[k] = row
+	}
+}
+
+func (s *memStore) CreateBets(ctx context.Context, bets []betRow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	deltas := statDeltas{}
+	touched := map[string]bool{}
+	for _, b := range bets {
+		b = copyRow(b)
+		if b.Rec.CreatedAt.IsZero() {
+			b.Rec.CreatedAt = now
+		}
+		b.Rec.UpdatedAt = now
+		sort.Strings(b.Tags)
+		userKey := b.Rec.UserKey
+		s.bets[userKey] = append(s.bets[userKey], b)
+		s.addTags(userKey, b.Tags)
+		s.appendEvents(newBetEvent(ctx, eventCreate, nil, &b))
+		deltas.addBet(b.Rec, +1)
+		touched[userKey] = true
+	}
+	for userKey := range touched {
+		sortRows(s.bets[userKey])
+	}
+	s.flush(deltas)
+	return nil
+}
+
+func (s *memStore) GetBet(_ context.Context, userKey, id string) (betRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(userKey, id)
+	if i < 0 {
+		return betRow{}, errNotFound
+	}
+	return copyRow(s.bets[userKey][i]), nil
+}
+
+func (s *memStore) ListBets(_ context.Context, userKey string, q pastBetQuery) (pastBetPage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return listRows(s.bets[userKey], q), nil
+}
+
+func (s *memStore) EachBet(ctx context.Context, userKey string, q pastBetQuery, fn func([]betRow) error) error {
+	s.mu.Lock()
+	var rows []betRow
+	for _, b := range s.bets[userKey] {
+		if q.matches(b, true) {
+			rows = append(rows, copyRow(b))
+		}
+	}
+	s.mu.Unlock()
+	for len(rows) > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n := min(len(rows), eachBetBatch)
+		if err := fn(rows[:n]); err != nil {
+			return err
+		}
+		rows = rows[n:]
+	}
+	return nil
+}
+
+func (s *memStore) EachBetRecord(ctx context.Context, userKey string, q pastBetQuery, fn func(PastBetRecord) error) error {
+	s.mu.Lock()
+	var recs []PastBetRecord
+	for _, b := range s.bets[userKey] {
+		if q.matches(b, true) {
+			rec := copyRow(b).Rec
+			rec.ToolTranscript = ""
+			recs = append(recs, rec)
+		}
+	}
+	s.mu.Unlock()
+	for _, rec := range recs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memStore) UpdateBet(ctx context.Context, userKey, id string, fn func(*betRow) error) (betRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(userKey, id)
+	if i < 0 {
+		return betRow{}, errNotFound
+	}
+	old := s.bets[userKey][i]
+	b := copyRow(old)
+	if err := fn(&b); err != nil {
+		return betRow{}, err
+	}
+	b = copyRow(b)
+	b.Rec.UpdatedAt = time.Now()
+	sort.Strings(b.Tags)
+	s.addTags(userKey, b.Tags)
+	s.bets[userKey][i] = b
+	sortRows(s.bets[userKey])
+	if e := newBetEvent(ctx, eventEdit, &old, &b); e.After != e.Before {
+		s.appendEvents(e)
+	}
+
+	deltas := statDeltas{}
+	deltas.addBet(old.Rec, -1)
+	deltas.addBet(b.Rec, +1)
+	s.flush(deltas)
+	return copyRow(b), nil
+}
+
+func (s *memStore) DeleteBet(ctx context.Context, userKey, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(userKey, id)
+	if i < 0 {
+		return errNotFound
+	}
+	list := s.bets[userKey]
+	rec := list[i].Rec
+	s.appendEvents(newBetEvent(ctx, eventDelete, &list[i], nil))
+	s.bets[userKey] = append(list[:i:i], list[i+1:]...)
+	deltas := statDeltas{}
+	deltas.addBet(rec, -1)
+	s.flush(deltas)
+	return nil
+}
+
+func (s *memStore) GradeBets(ctx context.Context, userKey string, items []gradeInput, bestEffort bool) ([]gradeResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]gradeResult, len(items))
+	// work on copies; nothing is written back until the batch is done
+	list := make([]betRow, len(s.bets[userKey]))
+	for i, b := range s.bets[userKey] {
+		list[i] = copyRow(b)
+	}
+	deltas := statDeltas{}
+	var events []BetEvent
+	failed := false
+	for i, item := range items {
+		res, returned, err := item.validate()
+		if err != nil {
+			results[i].Err, failed = &badRequestError{err.Error()}, true
+			continue
+		}
+		at := -1
+		for j := range list {
+			if list[j].Rec.ID == item.ID {
+				at = j
+				break
+			}
+		}
+		if at < 0 {
+			results[i].Err, failed = errNotFound, true
+			continue
+		}
+		b := copyRow(list[at]) // a failed item leaves the bet untouched
+		g, _, err := b.grade(item, res, returned)
+		if err != nil {
+			results[i].Err, failed = err, true
+			continue
+		}
+		b.Rec.UpdatedAt = time.Now()
+		events = append(events, gradeEvent(ctx, g.Prev, &list[at], &b))
+		list[at] = b
+		g.betRow = copyRow(b)
+		results[i].G = g
+		deltas.add(userKey, g.Rec.Model, g.Rec.Sport, g.Rec.Type, g.Prev, g.Next, g.PrevUnits, g.NextUnits)
+	}
+	if failed && !bestEffort {
+		return results, errRolledBack
+	}
+	s.bets[userKey] = list
+	s.appendEvents(events...)
+	s.flush(deltas)
+	return results, nil
+}
+
+/* ---------------- Tags ---------------- */
+
+func (s *memStore) ListTags(_ context.Context, userKey string) ([]tagRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := map[string]int{}
+	for name := range s.tags[userKey] {
+		counts[name] = 0
+	}
+	for _, b := range s.bets[userKey] {
+		for _, t := range b.Tags {
+			counts[t]++
+		}
+	}
+	out := make([]tagRow, 0, len(counts))
+	for name, n := range counts {
+		out = append(out, tagRow{name, n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Bets != out[j].Bets {
+			return out[i].Bets > out[j].Bets
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out, nil
+}
+
+func (s *memStore) DeleteTag(_ context.Context, userKey, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.tags[userKey][name] {
+		return errNotFound
+	}
+	delete(s.tags[userKey], name)
+	for i, b := range s.bets[userKey] {
+		kept := make([]string, 0, len(b.Tags))
+		for _, t := range b.Tags {
+			if t != name {
+				kept = append(kept, t)
+			}
+		}
+		if len(kept) == 0 {
+			kept = nil
+		}
+		s.bets[userKey][i].Tags = kept
+	}
+	return nil
+}
+
+/* ---------------- History ---------------- */
+
+func (s *memStore) BetEvents(_ context.Context, userKey, betID string) ([]BetEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []BetEvent
+	for _, e := range s.events[userKey] {
+		if e.BetID == betID {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+/* ---------------- Bankroll ---------------- */
+
+func (s *memStore) BankrollEntries(_ context.Context, userKey string) ([]BankrollEntry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]BankrollEntry(nil), s.ledger[userKey]...), nil
+}
+
+func (s *memStore) AddBankrollEntry(_ context.Context, e *BankrollEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	list := append(s.ledger[e.UserKey], *e)
+	sortLedger(list)
+	s.ledger[e.UserKey] = list
+	return nil
+}
+
+func (s *memStore) DeleteBankrollEntry(_ context.Context, userKey, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.ledger[userKey]
+	for i, e := range list {
+		if e.ID == id {
+			s.ledger[userKey] = append(list[:i:i], list[i+1:]...)
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+/* ---------------- Stats ---------------- */
+
+func (s *memStore) ModelStats(_ context.Context, userKey, mode string) ([]UserModelStat, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []UserModelStat
+	for k, row := range s.stats {
+		if k.UserKey == userKey && k.Mode == mode {
+			out = append(out, row)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Model != out[j].Model {
+			return out[i].Model < out[j].Model
+		}
+		return out[i].Sport < out[j].Sport
+	})
+	return out, nil
+}
+
+func (s *memStore) ResetUser(_ context.Context, userKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.bets, userKey)
+	delete(s.tags, userKey)
+	delete(s.events, userKey)
+	delete(s.ledger, userKey)
+	for k := range s.stats {
+		if k.UserKey == userKey {
+			delete(s.stats, k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/* ===================== Postgres store ====================== */
+
+type pgStore struct{ db *gorm.DB }
+
+func newPgStore(db *gorm.DB) *pgStore { return &pgStore{db: db} }
+
+func (s *pgStore) conn(ctx context.Context) *gorm.DB { return s.db.WithContext(ctx) }
+
+// notFound maps GORM's sentinel to the store's.
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return errNotFound
+	}
+	return err
+}
+
+/* ---------------- Users ---------------- */
+
+func (s *pgStore) CreateUser(ctx context.Context, u *User) error {
+	u.Email = strings.ToLower(strings.TrimSpace(u.Email))
+	if _, err := s.UserByEmail(ctx, u.Email); err == nil {
+		return errConflict
+	} else if !errors.Is(err, errNotFound) {
+		return err
+	}
+	return s.conn(ctx).Create(u).Error
+}
+
+func (s *pgStore) UserByID(ctx context.Context, id string) (User, error) {
+	var u User
+	err := s.conn(ctx).First(&u, "id = ?", id).Error
+	return u, notFound(err)
+}
+
+func (s *pgStore) UserByEmail(ctx context.Context, email string) (User, error) {
+	var u User
+	err := s.conn(ctx).Where("LOWER(email) = ?", strings.ToLower(strings.TrimSpace(email))).First(&u).Error
+	return u, notFound(err)
+}
+
+/* ---------------- Bets ---------------- */
+
+func (s *pgStore) CreateBets(ctx context.Context, bets []betRow) error {
+	if len(bets) == 0 {
+		return nil
+	}
+	return s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		recs := make([]PastBetRecord, 0, len(bets))
+		var legs []PastBetLeg
+		deltas := statDeltas{}
+		for _, b := range bets {
+			recs = append(recs, b.Rec)
+			legs = append(legs, b.Legs...)
+			deltas.addBet(b.Rec, +1)
+		}
+		if err := tx.Create(&recs).Error; err != nil {
+			return err
+		}
+		if len(legs) > 0 {
+			if err := tx.Create(&legs).Error; err != nil {
+				return err
+			}
+		}
+		events := make([]BetEvent, 0, len(bets))
+		for i, b := range bets {
+			if err := setBetTags(tx, b.Rec.UserKey, b.Rec.ID, b.Tags); err != nil {
+				return err
+			}
+			b.Rec = recs[i] // with the stored timestamps
+			b.Tags = append([]string(nil), b.Tags...)
+			sort.Strings(b.Tags)
+			events = append(events, newBetEvent(ctx, eventCreate, nil, &b))
+		}
+		if err := tx.Create(&events).Error; err != nil {
+			return err
+		}
+		return deltas.flush(tx)
+	})
+}
+
+// getBet loads one bet with legs and tags; tx may be a transaction.
+func getBet(tx *gorm.DB, userKey, id string) (betRow, error) {
+	return loadBet(tx, userKey, id, false)
+}
+
+// lockBet is getBet for a read-modify-write: the bet row stays locked
+// (SELECT ... FOR UPDATE) until tx ends, so concurrent edits or grades of
+// one bet run one after another and each sees the other's result.
+func lockBet(tx *gorm.DB, userKey, id string) (betRow, error) {
+	return loadBet(tx, userKey, id, true)
+}
+
+func loadBet(tx *gorm.DB, userKey, id string, lock bool) (betRow, error) {
+	q := tx.Where("id = ? AND user_key = ?", id, userKey)
+	if lock {
+		q = q.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var rec PastBetRecord
+	if err := q.First(&rec).Error; err != nil {
+		return betRow{}, notFound(err)
+	}
+	rows, err := loadBetRows(tx, []PastBetRecord{rec})
+	if err != nil {
+		return betRow{}, err
+	}
+	return rows[0], nil
+}
+
+func (s *pgStore) GetBet(ctx context.Context, userKey, id string) (betRow, error) {
+	return getBet(s.conn(ctx), userKey, id)
+}
+
+func (s *pgStore) ListBets(ctx context.Context, userKey string, q pastBetQuery) (pastBetPage, error) {
+	return listPastBetsDB(s.conn(ctx), userKey, q)
+}
+
+func (s *pgStore) EachBet(ctx context.Context, userKey string, q pastBetQuery, fn func([]betRow) error) error {
+	db := s.conn(ctx)
+	q.Limit, q.Cursor = eachBetBatch, nil
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows, next, err := pastBetsPage(db, userKey, q)
+		if err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			if err := fn(rows); err != nil {
+				return err
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		q.Cursor = next
+	}
+}
+
+func (s *pgStore) EachBetRecord(ctx context.Context, userKey string, q pastBetQuery, fn func(PastBetRecord) error) error {
+	db := s.conn(ctx)
+	rows, err := q.apply(db.Model(&PastBetRecord{}), userKey, true).Omit("tool_transcript").Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var rec PastBetRecord
+		if err := db.ScanRows(rows, &rec); err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *pgStore) UpdateBet(ctx context.Context, userKey, id string, fn func(*betRow) error) (betRow, error) {
+	var b betRow
+	err := s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		if b, err = lockBet(tx, userKey, id); err != nil {
+			return err
+		}
+		before := b
+		before.Legs = append([]PastBetLeg(nil), b.Legs...)
+		before.Tags = append([]string(nil), b.Tags...)
+		if err := fn(&b); err != nil {
+			return err
+		}
+		if err := tx.Save(&b.Rec).Error; err != nil {
+			return err
+		}
+		for i := range b.Legs {
+			if err := tx.Save(&b.Legs[i]).Error; err != nil {
+				return err
+			}
+		}
+		sort.Strings(b.Tags)
+		if !sameStrings(before.Tags, b.Tags) {
+			if err := setBetTags(tx, userKey, b.Rec.ID, b.Tags); err != nil {
+				return err
+			}
+		}
+		if e := newBetEvent(ctx, eventEdit, &before, &b); e.After != e.Before {
+			if err := tx.Create(&e).Error; err != nil {
+				return err
+			}
+		}
+		deltas := statDeltas{}
+		deltas.addBet(before.Rec, -1)
+		deltas.addBet(b.Rec, +1)
+		return deltas.flush(tx)
+	})
+	return b, err
+}
+
+func (s *pgStore) DeleteBet(ctx context.Context, userKey, id string) error {
+	return s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		b, err := lockBet(tx, userKey, id)
+		if err != nil {
+			return err
+		}
+		rec := b.Rec
+		e := newBetEvent(ctx, eventDelete, &b, nil)
+		if err := tx.Create(&e).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bet_id = ?", rec.ID).Delete(&PastBetLeg{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("bet_id = ?", rec.ID).Delete(&PastBetTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&rec).Error; err != nil {
+			return err
+		}
+		deltas := statDeltas{}
+		deltas.addBet(rec, -1)
+		return deltas.flush(tx)
+	})
+}
+
+func (s *pgStore) GradeBets(ctx context.Context, userKey string, items []gradeInput, bestEffort bool) ([]gradeResult, error) {
+	results := make([]gradeResult, len(items))
+	err := s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		deltas := statDeltas{}
+		failed := false
+		for i, item := range items {
+			grade := func(tx *gorm.DB) error {
+				res, returned, err := item.validate()
+				if err != nil {
+					return &badRequestError{err.Error()}
+				}
+				b, err := lockBet(tx, userKey, item.ID)
+				if err != nil {
+					return err
+				}
+				before := b
+				before.Legs = append([]PastBetLeg(nil), b.Legs...)
+				g, changed, err := b.grade(item, res, returned)
+				if err != nil {
+					return err
+				}
+				for _, li := range changed {
+					if err := tx.Model(&PastBetLeg{}).Where("id = ?", b.Legs[li].ID).
+						Update("result", b.Legs[li].Result).Error; err != nil {
+						return err
+					}
+				}
+				if err := tx.Save(&b.Rec).Error; err != nil {
+					return err
+				}
+				e := gradeEvent(ctx, g.Prev, &before, &b)
+				if err := tx.Create(&e).Error; err != nil {
+					return err
+				}
+				results[i].G = g
+				return nil
+			}
+			var err error
+			if bestEffort {
+				err = tx.Transaction(grade) // savepoint: a failure undoes only this item
+			} else {
+				err = grade(tx)
+			}
+			if err != nil {
+				if !isItemError(err) {
+					return err // storage failures end the batch in either mode
+				}
+				results[i].Err, failed = err, true
+				continue
+			}
+			g := results[i].G
+			deltas.add(userKey, g.Rec.Model, g.Rec.Sport, g.Rec.Type, g.Prev, g.Next, g.PrevUnits, g.NextUnits)
+		}
+		if failed && !bestEffort {
+			return errRolledBack
+		}
+		return deltas.flush(tx)
+	})
+	return results, err
+}
+
+// isItemError reports whether err belongs to one grading item (bad input or
+// a missing bet) rather than to the storage.
+func isItemError(err error) bool {
+	var bad *badRequestError
+	return errors.Is(err, errNotFound) || errors.As(err, &bad)
+}
+
+/* ---------------- Tags ---------------- */
+
+func (s *pgStore) ListTags(ctx context.Context, userKey string) ([]tagRow, error) {
+	out := []tagRow{}
+	err := s.conn(ctx).Model(&Tag{}).
+		Select("tags.name, COUNT(past_bet_tags.bet_id) AS bets").
+		Joins("LEFT JOIN past_bet_tags ON past_bet_tags.tag_id = tags.id").
+		Where("tags.user_key = ?", userKey).
+		Group("tags.name").
+		Order("bets DESC, tags.name").
+		Scan(&out).Error
+	return out, err
+}
+
+func (s *pgStore) DeleteTag(ctx context.Context, userKey, name string) error {
+	return s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		var t Tag
+		if err := tx.Where("user_key = ? AND name = ?", userKey, name).First(&t).Error; err != nil {
+			return notFound(err)
+		}
+		if err := tx.Where("tag_id = ?", t.ID).Delete(&PastBetTag{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&t).Error
+	})
+}
+
+/* ---------------- History ---------------- */
+
+func (s *pgStore) BetEvents(ctx context.Context, userKey, betID string) ([]BetEvent, error) {
+	var out []BetEvent
+	err := s.conn(ctx).Where("user_key = ? AND bet_id = ?", userKey, betID).Order("id").Find(&out).Error
+	return out, err
+}
+
+/* ---------------- Bankroll ---------------- */
+
+func (s *pgStore) BankrollEntries(ctx context.Context, userKey string) ([]BankrollEntry, error) {
+	var out []BankrollEntry
+	err := s.conn(ctx).Where("user_key = ?", userKey).Order("at, created_at").Find(&out).Error
+	return out, err
+}
+
+func (s *pgStore) AddBankrollEntry(ctx context.Context, e *BankrollEntry) error {
+	return s.conn(ctx).Create(e).Error
+}
+
+func (s *pgStore) DeleteBankrollEntry(ctx context.Context, userKey, id string) error {
+	res := s.conn(ctx).Where("id = ? AND user_key = ?", id, userKey).Delete(&BankrollEntry{})
+	if res.Error == nil && res.RowsAffected == 0 {
+		return errNotFound
+	}
+	return res.Error
+}
+
+/* ---------------- Stats ---------------- */
+
+func (s *pgStore) ModelStats(ctx context.Context, userKey, mode string) ([]UserModelStat, error) {
+	var rows []UserModelStat
+	err := s.conn(ctx).Where("user_key = ? AND mode = ?", userKey, mode).
+		Order("model, sport").Find(&rows).Error
+	return rows, err
+}
+
+func (s *pgStore) ResetUser(ctx context.Context, userKey string) error {
+	return s.conn(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, m := range []any{&PastBetLeg{}, &PastBetTag{}, &Tag{}, &PastBetRecord{}, &BetEvent{}, &UserModelStat{}, &BankrollEntry{}} {
+			if err := tx.Where("user_key = ?", userKey).Delete(m).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
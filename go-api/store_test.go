@@ -0,0 +1,452 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+/* ===================== Store conformance ======================
+One scenario every Store must pass, so the memory backend can stand in for
+Postgres. It only touches its own user (a fresh "conformance-" id) and
+resets that user's data when done. The Postgres run needs a database of its
+own: set TEST_DATABASE_URL to one that may be migrated and written to.
+*/
+
+const conformancePrefix = "conformance-"
+
+func TestMemStoreConformance(t *testing.T) {
+	runStoreConformance(t, newMemStore())
+}
+
+func TestPgStoreConformance(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	connectDB(dsn)
+	t.Cleanup(func() {
+		_ = DB.Where("id LIKE ?", conformancePrefix+"%").Delete(&User{}).Error
+	})
+	runStoreConformance(t, newPgStore(DB))
+}
+
+type conformance struct {
+	t       *testing.T
+	ctx     context.Context
+	s       Store
+	userKey string
+}
+
+func (c *conformance) failf(format string, args ...any) {
+	c.t.Helper()
+	c.t.Errorf(format, args...)
+}
+
+// must reports err and whether it was nil.
+func (c *conformance) must(what string, err error) bool {
+	c.t.Helper()
+	if err != nil {
+		c.failf("%s: %v", what, err)
+		return false
+	}
+	return true
+}
+
+func (c *conformance) wantErr(what string, got, want error) {
+	c.t.Helper()
+	if !errors.Is(got, want) {
+		c.failf("%s: got error %v, want %v", what, got, want)
+	}
+}
+
+func (c *conformance) wantIDs(what string, got []string, want ...string) {
+	c.t.Helper()
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		c.failf("%s: got %v, want %v", what, got, want)
+	}
+}
+
+func (c *conformance) list(q pastBetQuery) pastBetPage {
+	if q.Limit == 0 {
+		q.Limit = defaultPageSize
+	}
+	page, err := c.s.ListBets(c.ctx, c.userKey, q)
+	c.must("ListBets", err)
+	return page
+}
+
+func pageIDs(p pastBetPage) []string {
+	ids := make([]string, 0, len(p.Bets))
+	for _, b := range p.Bets {
+		ids = append(ids, b.ID)
+	}
+	return ids
+}
+
+// wantStat checks one aggregate row; a missing row counts as all zeros.
+func (c *conformance) wantStat(model, sport, mode string, bets, wins, losses int, units float64) {
+	c.t.Helper()
+	rows, err := c.s.ModelStats(c.ctx, c.userKey, mode)
+	if !c.must("ModelStats", err) {
+		return
+	}
+	var got UserModelStat
+	for _, r := range rows {
+		if r.Model == model && r.Sport == sport {
+			got = r
+		}
+	}
+	if got.Bets != bets || got.Wins != wins || got.Losses != losses || math.Abs(got.Units-units) > 1e-9 {
+		c.failf("stats %s/%s/%s: got %d bets %d-%d %.2fu, want %d bets %d-%d %.2fu",
+			model, sport, mode, got.Bets, got.Wins, got.Losses, got.Units, bets, wins, losses, units)
+	}
+}
+
+func (c *conformance) bet(id, typ, model, sport string, daysAgo int) betRow {
+	price, dec := canonicalOdds("+150")
+	return betRow{Rec: PastBetRecord{
+		ID: id, UserKey: c.userKey, Type: typ, Model: model, Sport: sport,
+		Date:  time.Now().UTC().Truncate(time.Second).AddDate(0, 0, -daysAgo),
+		Event: id, Odds: price, OddsDecimal: dec, Stake: 1,
+	}}
+}
+
+// runStoreConformance runs the scenario against s.
+func runStoreConformance(t *testing.T, s Store) {
+	c := &conformance{t: t, ctx: context.Background(), s: s, userKey: conformancePrefix + newID()}
+	defer func() { c.must("ResetUser", s.ResetUser(c.ctx, c.userKey)) }()
+	c.users()
+	c.bets()
+	if t.Failed() { // the rest builds on the bets above
+		return
+	}
+	c.grading()
+	c.edits()
+	c.history()
+	c.bankroll()
+	c.reset()
+}
+
+func (c *conformance) users() {
+	email := strings.ToUpper(c.userKey) + "@Example.com"
+	u := User{ID: c.userKey, Email: email, DisplayName: "Conformance"}
+	if !c.must("CreateUser", c.s.CreateUser(c.ctx, &u)) {
+		return
+	}
+	if got, err := c.s.UserByEmail(c.ctx, strings.ToLower(email)); c.must("UserByEmail", err) && got.ID != c.userKey {
+		c.failf("UserByEmail: got user %q", got.ID)
+	}
+	if got, err := c.s.UserByID(c.ctx, c.userKey); c.must("UserByID", err) && got.Email != strings.ToLower(email) {
+		c.failf("UserByID: email %q not stored lowercased", got.Email)
+	}
+	dup := User{ID: newID(), Email: " " + email}
+	c.wantErr("CreateUser duplicate email", c.s.CreateUser(c.ctx, &dup), errConflict)
+	_, err := c.s.UserByID(c.ctx, newID())
+	c.wantErr("UserByID unknown", err, errNotFound)
+	_, err = c.s.UserByEmail(c.ctx, "nobody-"+c.userKey+"@example.com")
+	c.wantErr("UserByEmail unknown", err, errNotFound)
+}
+
+// bets stores three bets, newest first in list order: b (SGP with two legs),
+// a (pending, tagged) and c (graded win).
+func (c *conformance) bets() {
+	a := c.bet("a-"+c.userKey, "Single", "Model A", "NBA", 2)
+	a.Tags = []string{"late", "boosted"}
+	a.Rec.Notes = "fade the public"
+	b := c.bet("b-"+c.userKey, "SGP", "Model A", "NBA", 1)
+	b.Legs = legRecordsFromPublic(b.Rec.ID, c.userKey, []BetLeg{
+		{Player: "Leg One", Market: "Points", Line: "25+", Odds: "-110"},
+		{Player: "Leg Two", Market: "Assists", Line: "8+", Odds: "+120"},
+	})
+	cc := c.bet("c-"+c.userKey, "Single", "Model B", "NFL", 3)
+	cc.Tags = []string{"late"}
+	win, units := "win", 1.5
+	cc.Rec.Result, cc.Rec.ResultUnits = &win, &units
+	if !c.must("CreateBets", c.s.CreateBets(withActor(c.ctx, actorImport), []betRow{a, b, cc})) {
+		return
+	}
+
+	got, err := c.s.GetBet(c.ctx, c.userKey, b.Rec.ID)
+	if c.must("GetBet", err) {
+		if len(got.Legs) != 2 || got.Legs[0].Player != "Leg One" || got.Legs[1].Player != "Leg Two" {
+			c.failf("GetBet: legs not returned in position order: %+v", got.Legs)
+		}
+		if len(got.Tags) != 0 {
+			c.failf("GetBet: untagged bet has tags %v", got.Tags)
+		}
+	}
+	if got, err := c.s.GetBet(c.ctx, c.userKey, a.Rec.ID); c.must("GetBet", err) {
+		c.wantIDs("GetBet tags sorted", got.Tags, "boosted", "late")
+	}
+	_, err = c.s.GetBet(c.ctx, "other-"+c.userKey, a.Rec.ID)
+	c.wantErr("GetBet as another user", err, errNotFound)
+
+	// order, paging and counts
+	first := c.list(pastBetQuery{Limit: 2})
+	c.wantIDs("ListBets page 1", pageIDs(first), b.Rec.ID, a.Rec.ID)
+	if first.Total != 3 || first.Counts["pending"] != 2 || first.Counts["win"] != 1 {
+		c.failf("ListBets: total %d counts %v, want 3 with 2 pending and 1 win", first.Total, first.Counts)
+	}
+	if first.NextCursor == "" {
+		c.failf("ListBets page 1: no next cursor")
+	} else if cur, err := decodeCursor(first.NextCursor); c.must("decodeCursor", err) {
+		second := c.list(pastBetQuery{Limit: 2, Cursor: cur})
+		c.wantIDs("ListBets page 2", pageIDs(second), cc.Rec.ID)
+		if second.NextCursor != "" {
+			c.failf("ListBets page 2: unexpected next cursor")
+		}
+	}
+
+	// filters
+	c.wantIDs("filter tag", pageIDs(c.list(pastBetQuery{Tags: []string{"late"}})), a.Rec.ID, cc.Rec.ID)
+	c.wantIDs("filter tags (all)", pageIDs(c.list(pastBetQuery{Tags: []string{"late", "boosted"}})), a.Rec.ID)
+	c.wantIDs("filter text in notes", pageIDs(c.list(pastBetQuery{Text: "PUBLIC"})), a.Rec.ID)
+	c.wantIDs("filter sport", pageIDs(c.list(pastBetQuery{Sport: "NFL"})), cc.Rec.ID)
+	c.wantIDs("filter type", pageIDs(c.list(pastBetQuery{Type: "SGP"})), b.Rec.ID)
+	pending := c.list(pastBetQuery{Result: "pending"})
+	c.wantIDs("filter pending", pageIDs(pending), b.Rec.ID, a.Rec.ID)
+	if pending.Counts["win"] != 1 {
+		c.failf("ListBets: result filter changed the per-result counts: %v", pending.Counts)
+	}
+	c.wantIDs("filter graded", pageIDs(c.list(pastBetQuery{Result: "graded"})), cc.Rec.ID)
+	from := time.Now().UTC().AddDate(0, 0, -2).Add(-time.Hour)
+	c.wantIDs("filter from", pageIDs(c.list(pastBetQuery{From: &from})), b.Rec.ID, a.Rec.ID)
+
+	var each []string
+	c.must("EachBet", c.s.EachBet(c.ctx, c.userKey, pastBetQuery{Limit: 1}, func(rows []betRow) error {
+		for _, r := range rows {
+			each = append(each, r.Rec.ID)
+		}
+		return nil
+	}))
+	c.wantIDs("EachBet ignores limit", each, b.Rec.ID, a.Rec.ID, cc.Rec.ID)
+
+	var recs []string
+	c.must("EachBetRecord", c.s.EachBetRecord(c.ctx, c.userKey, pastBetQuery{Tags: []string{"late"}}, func(rec PastBetRecord) error {
+		recs = append(recs, rec.ID)
+		return nil
+	}))
+	sort.Strings(recs)
+	c.wantIDs("EachBetRecord filter tag", recs, a.Rec.ID, cc.Rec.ID)
+
+	c.wantStat("Model B", "NFL", "Single", 1, 1, 0, 1.5)
+	c.wantStat("Model B", "NFL", "ALL", 1, 1, 0, 1.5)
+	c.wantStat("Model A", "NBA", "ALL", 0, 0, 0, 0)
+}
+
+func (c *conformance) grading() {
+	a, b := "a-"+c.userKey, "b-"+c.userKey
+
+	res, err := c.s.GradeBets(c.ctx, c.userKey, []gradeInput{{ID: a, Result: "win"}, {ID: "missing"}}, false)
+	c.wantErr("GradeBets atomic with a bad item", err, errRolledBack)
+	if len(res) == 2 {
+		c.wantErr("GradeBets atomic missing item", res[1].Err, errNotFound)
+	}
+	if got, err := c.s.GetBet(c.ctx, c.userKey, a); c.must("GetBet", err) && got.Rec.Result != nil {
+		c.failf("GradeBets atomic: rolled-back item was saved")
+	}
+	c.wantStat("Model A", "NBA", "Single", 0, 0, 0, 0)
+
+	res, err = c.s.GradeBets(c.ctx, c.userKey, []gradeInput{{ID: a, Result: "win"}, {ID: b, Result: "nope"}}, true)
+	if c.must("GradeBets best effort", err) && len(res) == 2 {
+		if res[0].Err != nil || res[0].G.Next != "win" || res[0].G.Rec.ResultUnits == nil {
+			c.failf("GradeBets best effort: first item %+v", res[0])
+		}
+		var bad *badRequestError
+		if !errors.As(res[1].Err, &bad) {
+			c.failf("GradeBets best effort: bad item got %v, want a bad request", res[1].Err)
+		}
+	}
+	c.wantStat("Model A", "NBA", "Single", 1, 1, 0, 1.5)
+
+	// per-leg grading settles the parlay from its legs
+	zero, one := 0, 1
+	res, err = c.s.GradeBets(c.ctx, c.userKey, []gradeInput{{ID: b, Legs: []legResultIn{
+		{Index: &zero, Result: "win"}, {Index: &one, Result: "loss"},
+	}}}, false)
+	if c.must("GradeBets legs", err) && res[0].G.Next != "loss" {
+		c.failf("GradeBets legs: bet graded %q, want loss", res[0].G.Next)
+	}
+	if got, err := c.s.GetBet(c.ctx, c.userKey, b); c.must("GetBet", err) {
+		if len(got.Legs) != 2 || got.Legs[0].Result == nil || *got.Legs[0].Result != "win" ||
+			got.Legs[1].Result == nil || *got.Legs[1].Result != "loss" {
+			c.failf("GradeBets legs: leg results not saved")
+		}
+	}
+	c.wantStat("Model A", "NBA", "SGP", 1, 0, 1, -1)
+	c.wantStat("Model A", "NBA", "ALL", 2, 1, 1, 0.5)
+
+	// regrading moves the bet between tallies
+	_, err = c.s.GradeBets(c.ctx, c.userKey, []gradeInput{{ID: a, Result: "loss"}}, false)
+	c.must("GradeBets regrade", err)
+	c.wantStat("Model A", "NBA", "Single", 1, 0, 1, -1)
+	_, err = c.s.GradeBets(c.ctx, c.userKey, []gradeInput{{ID: a, Result: ""}}, false)
+	c.must("GradeBets ungrade", err)
+	c.wantStat("Model A", "NBA", "Single", 0, 0, 0, 0)
+}
+
+func (c *conformance) edits() {
+	a, cc := "a-"+c.userKey, "c-"+c.userKey
+
+	// moving a graded bet moves its stats
+	got, err := c.s.UpdateBet(c.ctx, c.userKey, cc, func(b *betRow) error {
+		b.Rec.Model = "Model A"
+		b.Tags = []string{"sharp", "late"}
+		return nil
+	})
+	if c.must("UpdateBet", err) {
+		c.wantIDs("UpdateBet tags sorted", got.Tags, "late", "sharp")
+	}
+	c.wantStat("Model B", "NFL", "ALL", 0, 0, 0, 0)
+	c.wantStat("Model A", "NFL", "Single", 1, 1, 0, 1.5)
+
+	errNope := errors.New("nope")
+	_, err = c.s.UpdateBet(c.ctx, c.userKey, cc, func(b *betRow) error {
+		b.Rec.Model = "Model C"
+		return errNope
+	})
+	c.wantErr("UpdateBet aborted", err, errNope)
+	if got, err := c.s.GetBet(c.ctx, c.userKey, cc); c.must("GetBet", err) && got.Rec.Model != "Model A" {
+		c.failf("UpdateBet aborted: change was saved")
+	}
+	_, err = c.s.UpdateBet(c.ctx, c.userKey, "missing", func(*betRow) error { return nil })
+	c.wantErr("UpdateBet unknown", err, errNotFound)
+
+	// leg fields written through UpdateBet
+	b := "b-" + c.userKey
+	_, err = c.s.UpdateBet(c.ctx, c.userKey, b, func(r *betRow) error {
+		r.Legs[1].ClosingOdds, r.Legs[1].ClosingDecimal = "+100", 2
+		return nil
+	})
+	if c.must("UpdateBet legs", err) {
+		if got, err := c.s.GetBet(c.ctx, c.userKey, b); c.must("GetBet", err) && got.Legs[1].ClosingOdds != "+100" {
+			c.failf("UpdateBet legs: leg change not saved")
+		}
+	}
+
+	// tags
+	tags, err := c.s.ListTags(c.ctx, c.userKey)
+	if c.must("ListTags", err) {
+		got := make([]string, 0, len(tags))
+		for _, t := range tags {
+			got = append(got, fmt.Sprintf("%s:%d", t.Name, t.Bets))
+		}
+		c.wantIDs("ListTags", got, "late:2", "boosted:1", "sharp:1")
+	}
+	c.must("DeleteTag", c.s.DeleteTag(c.ctx, c.userKey, "boosted"))
+	c.wantErr("DeleteTag again", c.s.DeleteTag(c.ctx, c.userKey, "boosted"), errNotFound)
+	if got, err := c.s.GetBet(c.ctx, c.userKey, a); c.must("GetBet", err) {
+		c.wantIDs("DeleteTag unlinks", got.Tags, "late")
+	}
+
+	// delete takes a graded bet out of its stats
+	c.must("DeleteBet", c.s.DeleteBet(c.ctx, c.userKey, cc))
+	c.wantErr("DeleteBet again", c.s.DeleteBet(c.ctx, c.userKey, cc), errNotFound)
+	_, err = c.s.GetBet(c.ctx, c.userKey, cc)
+	c.wantErr("GetBet deleted", err, errNotFound)
+	c.wantStat("Model A", "NFL", "Single", 0, 0, 0, 0)
+	if page := c.list(pastBetQuery{Tags: []string{"sharp"}}); page.Total != 0 {
+		c.failf("DeleteBet: deleted bet still listed under its tag")
+	}
+}
+
+// history checks the events left by everything above.
+func (c *conformance) history() {
+	a, b, cc := "a-"+c.userKey, "b-"+c.userKey, "c-"+c.userKey
+	_, err := c.s.UpdateBet(c.ctx, c.userKey, b, func(*betRow) error { return nil })
+	c.must("UpdateBet no-op", err)
+
+	events := func(id string) []BetEvent {
+		evs, err := c.s.BetEvents(c.ctx, c.userKey, id)
+		c.must("BetEvents", err)
+		return evs
+	}
+	kinds := func(evs []BetEvent) []string {
+		out := make([]string, 0, len(evs))
+		for _, e := range evs {
+			out = append(out, e.Kind+"/"+e.Actor)
+		}
+		return out
+	}
+	evA := events(a)
+	c.wantIDs("BetEvents a", kinds(evA), "create/import", "grade/user", "regrade/user", "regrade/user")
+	if len(evA) == 4 {
+		if evA[0].Before != "" || evA[0].After == "" {
+			c.failf("BetEvents create: want only an after snapshot")
+		}
+		c.wantIDs("BetEvents grade changes", changedFields(evA[1].Before, evA[1].After), "result", "resultUnits")
+		if evA[1].After != evA[2].Before {
+			c.failf("BetEvents: regrade does not start where the grade ended")
+		}
+	}
+	c.wantIDs("BetEvents b (no-op edit not recorded)", kinds(events(b)), "create/import", "grade/user", "edit/user")
+	evC := events(cc)
+	c.wantIDs("BetEvents c (aborted edit not recorded)", kinds(evC), "create/import", "edit/user", "delete/user")
+	if n := len(evC); n == 3 && (evC[2].Before == "" || evC[2].After != "") {
+		c.failf("BetEvents delete: want only a before snapshot")
+	}
+	if evs := events("missing"); len(evs) != 0 {
+		c.failf("BetEvents unknown bet: got %d events", len(evs))
+	}
+}
+
+func (c *conformance) bankroll() {
+	day := time.Now().UTC().Truncate(time.Second).AddDate(0, 0, -5)
+	add := func(id, kind string, amount float64, at time.Time) {
+		e := BankrollEntry{ID: id + "-" + c.userKey, UserKey: c.userKey, Kind: kind, Amount: amount, At: at}
+		if c.must("AddBankrollEntry", c.s.AddBankrollEntry(c.ctx, &e)) && e.CreatedAt.IsZero() {
+			c.failf("AddBankrollEntry: CreatedAt not set")
+		}
+	}
+	// added out of order; listed by At, then by when they were added
+	add("size", entryUnitSize, 10, day.AddDate(0, 0, 1))
+	add("start", entryStart, 500, day)
+	add("deposit", entryDeposit, 100, day.AddDate(0, 0, 1))
+	ids := func() []string {
+		entries, err := c.s.BankrollEntries(c.ctx, c.userKey)
+		c.must("BankrollEntries", err)
+		out := make([]string, 0, len(entries))
+		for _, e := range entries {
+			out = append(out, strings.TrimSuffix(e.ID, "-"+c.userKey))
+		}
+		return out
+	}
+	c.wantIDs("BankrollEntries order", ids(), "start", "size", "deposit")
+
+	c.wantErr("DeleteBankrollEntry as another user",
+		c.s.DeleteBankrollEntry(c.ctx, "other-"+c.userKey, "start-"+c.userKey), errNotFound)
+	c.must("DeleteBankrollEntry", c.s.DeleteBankrollEntry(c.ctx, c.userKey, "deposit-"+c.userKey))
+	c.wantErr("DeleteBankrollEntry again", c.s.DeleteBankrollEntry(c.ctx, c.userKey, "deposit-"+c.userKey), errNotFound)
+	c.wantIDs("BankrollEntries after delete", ids(), "start", "size")
+}
+
+func (c *conformance) reset() {
+	if !c.must("ResetUser", c.s.ResetUser(c.ctx, c.userKey)) {
+		return
+	}
+	if page := c.list(pastBetQuery{}); page.Total != 0 || len(page.Bets) != 0 {
+		c.failf("ResetUser: %d bets left", page.Total)
+	}
+	if tags, err := c.s.ListTags(c.ctx, c.userKey); c.must("ListTags", err) && len(tags) != 0 {
+		c.failf("ResetUser: tags left: %v", tags)
+	}
+	if rows, err := c.s.ModelStats(c.ctx, c.userKey, "ALL"); c.must("ModelStats", err) && len(rows) != 0 {
+		c.failf("ResetUser: %d stats rows left", len(rows))
+	}
+	if evs, err := c.s.BetEvents(c.ctx, c.userKey, "a-"+c.userKey); c.must("BetEvents", err) && len(evs) != 0 {
+		c.failf("ResetUser: %d events left", len(evs))
+	}
+	if entries, err := c.s.BankrollEntries(c.ctx, c.userKey); c.must("BankrollEntries", err) && len(entries) != 0 {
+		c.failf("ResetUser: %d bankroll entries left", len(entries))
+	}
+	if _, err := c.s.UserByID(c.ctx, c.userKey); err != nil {
+		c.failf("ResetUser: user removed: %v", err)
+	}
+}
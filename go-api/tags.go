@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+/* ===================== Tags ======================
+User-defined labels ("late-night card", "tailing friend", "boosted") on past
+bets. Tags are per user and created on first use; PastBetTag links them to
+bets. Names are stored lowercased with whitespace collapsed, so "Boosted"
+and " boosted " are one tag.
+*/
+
+const (
+	maxTagsPerBet = 20
+	maxTagLen     = 40
+)
+
+type Tag struct {
+	ID        string    `gorm:"primaryKey;type:text"`
+	UserKey   string    `gorm:"index:idx_tag_user_name,unique,priority:1;type:text;not null"`
+	Name      string    `gorm:"index:idx_tag_user_name,unique,priority:2;type:text;not null"`
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+type PastBetTag struct {
+	BetID   string `gorm:"primaryKey;type:text"`
+	TagID   string `gorm:"primaryKey;index;type:text"`
+	UserKey string `gorm:"index;type:text;not null"` // denormalized, like PastBetLeg
+}
+
+// normTagName lowercases and collapses whitespace; "" when empty.
+func normTagName(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+// normTags cleans and dedupes a bet's tags, keeping first-seen order.
+func normTags(in []string) ([]string, error) {
+	out := make([]string, 0, len(in))
+	seen := map[string]bool{}
+	for _, t := range in {
+		name := normTagName(t)
+		if name == "" || seen[name] {
+			continue
+		}
+		if len([]rune(name)) > maxTagLen {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", name, maxTagLen)
+		}
+		seen[name] = true
+		out = append(out, name)
+	}
+	if len(out) > maxTagsPerBet {
+		return nil, fmt.Errorf("at most %d tags per bet", maxTagsPerBet)
+	}
+	return out, nil
+}
+
+// setBetTags replaces a bet's tags, creating any the user doesn't have yet.
+// names must already be normalized (normTags).
+func setBetTags(tx *gorm.DB, userKey, betID string, names []string) error {
+	if err := tx.Where("bet_id = ?", betID).Delete(&PastBetTag{}).Error; err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	tags := make([]Tag, 0, len(names))
+	for _, n := range names {
+		tags = append(tags, Tag{ID: newID(), UserKey: userKey, Name: n})
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return err
+	}
+	// re-read: ids of tags that already existed aren't the ones generated above
+	tags = tags[:0]
+	if err := tx.Where("user_key = ? AND name IN ?", userKey, names).Find(&tags).Error; err != nil {
+		return err
+	}
+	links := make([]PastBetTag, 0, len(tags))
+	for _, t := range tags {
+		links = append(links, PastBetTag{BetID: betID, TagID: t.ID, UserKey: userKey})
+	}
+	return tx.Create(&links).Error
+}
+
+// loadTags fetches tag names for the given bets, grouped by bet id, sorted.
+func loadTags(db *gorm.DB, betIDs []string) (map[string][]string, error) {
+	out := map[string][]string{}
+	if len(betIDs) == 0 {
+		return out, nil
+	}
+	var rows []struct{ BetID, Name string }
+	if err := db.Table("past_bet_tags").
+		Select("past_bet_tags.bet_id, tags.name").
+		Joins("JOIN tags ON tags.id = past_bet_tags.tag_id").
+		Where("past_bet_tags.bet_id IN ?", betIDs).
+		Order("past_bet_tags.bet_id, tags.name").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, r := range rows {
+		out[r.BetID] = append(out[r.BetID], r.Name)
+	}
+	return out, nil
+}
+
+// taggedWith restricts a PastBetRecord query to bets carrying every tag.
+func taggedWith(db *gorm.DB, userKey string, tags []string) *gorm.DB {
+	for _, t := range tags {
+		db = db.Where("id IN (?)", db.Session(&gorm.Session{NewDB: true}).
+			Table("past_bet_tags").
+			Select("past_bet_tags.bet_id").
+			Joins("JOIN tags ON tags.id = past_bet_tags.tag_id").
+			Where("tags.user_key = ? AND tags.name = ?", userKey, t))
+	}
+	return db
+}
+
+func hasAllTags(have, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+/* ---------------- HTTP ---------------- */
+
+type tagRow struct {
+	Name string `json:"name"`
+	Bets int    `json:"bets"`
+}
+
+// GET /api/tags
+// The user's tags with how many bets carry each, most used first.
+func handleListTags(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	out, err := store.ListTags(r.Context(), userKey)
+	if err != nil {
+		errorJSON(w, http.StatusInternalServerError, "db error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tags": out})
+}
+
+// DELETE /api/tags/{name}
+// Removes the tag from every bet; the bets themselves are untouched.
+func handleDeleteTag(w http.ResponseWriter, r *http.Request) {
+	userKey := userKeyFromRequest(r)
+	if userKey == "" {
+		errorJSON(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	name := normTagName(chi.URLParam(r, "name"))
+	switch err := store.DeleteTag(r.Context(), userKey, name); {
+	case errors.Is(err, errNotFound):
+		errorJSON(w, http.StatusNotFound, "not found")
+		return
+	case err != nil:
+		errorJSON(w, http.StatusInternalServerError, "db delete error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"ok": true})
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+/* ---------------- Upstream clients ---------------- */
+
+// Shared clients. They carry no fixed Timeout: every call is bounded by its
+// request context (see withDeadline), so a closed tab stops the work.
+var (
+	openAIHTTPClient = &http.Client{}
+	espnHTTPClient   = &http.Client{}
+)
+
+/* ---------------- Per-route deadlines ---------------- */
+
+// Deadlines applied to each route's request context. Generation is long
+// because a single gpt-5 call can take a minute or more.
+var (
+	deadlineGenerate = time.Duration(envInt("GENERATE_DEADLINE_SEC", 180)) * time.Second
+	deadlineGames    = 30 * time.Second
+	deadlineExport   = time.Duration(envInt("EXPORT_DEADLINE_SEC", 300)) * time.Second
+	deadlineDefault  = 15 * time.Second
+)
+
+// withDeadline is middleware bounding the request context; the context is
+// also canceled when the client disconnects.
+func withDeadline(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+/* ---------------- Metrics ---------------- */
+
+// upstreamMetrics counts outbound calls by "<target>.<outcome>", e.g.
+// "openai.ok", "espn.canceled", "db.deadline". Served at /debug/vars on DEBUG_ADDR (see main).
+var upstreamMetrics = expvar.NewMap("upstream")
+
+// Non-standard status (nginx convention) for "client closed request".
+const statusClientClosed = 499
+
+// upstreamOutcome classifies an error as ok | canceled | deadline | error.
+func upstreamOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "deadline"
+	}
+	return "error"
+}
+
+// recordUpstream counts one outbound call and logs cancellations distinctly
+// from failures. It returns the outcome for callers that branch on it.
+func recordUpstream(target string, err error) string {
+	outcome := upstreamOutcome(err)
+	upstreamMetrics.Add(target+"."+outcome, 1)
+	switch outcome {
+	case "canceled":
+		log.Printf("[%s] canceled: client went away", target)
+	case "deadline":
+		log.Printf("[%s] deadline exceeded", target)
+	}
+	return outcome
+}
+
+// statusForUpstream maps an upstream failure to the HTTP status a handler should answer with.
+func statusForUpstream(err error) int {
+	switch upstreamOutcome(err) {
+	case "canceled":
+		return statusClientClosed
+	case "deadline":
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusBadGateway
+}
+
+// registerDBMetrics hooks GORM so every statement is counted under "db.*",
+// with canceled/deadline contexts reported separately.
+func registerDBMetrics(db *gorm.DB) error {
+	after := func(tx *gorm.DB) {
+		err := tx.Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		}
+		recordUpstream("db", err)
+	}
+	cb := db.Callback()
+	for name, reg := range map[string]func(string, func(*gorm.DB)) error{
+		"create": cb.Create().After("gorm:create").Register,
+		"query":  cb.Query().After("gorm:query").Register,
+		"update": cb.Update().After("gorm:update").Register,
+		"delete": cb.Delete().After("gorm:delete").Register,
+		"row":    cb.Row().After("gorm:row").Register,
+		"raw":    cb.Raw().After("gorm:raw").Register,
+	} {
+		if err := reg("metrics:"+name, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}